@@ -41,6 +41,8 @@ message SendButtonsRequest {
   string body = 5;
   string footer = 6;
   repeated Button buttons = 7;
+  // See MessageRequest.idempotencyKey
+  string idempotencyKey = 8;
 }
 EOF
 fi
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math/rand"
 
+	"github.com/devlikeapro/gows/gows"
 	__ "github.com/devlikeapro/gows/proto"
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/proto/waE2E"
@@ -68,7 +69,12 @@ func (s *Server) SendButtons(ctx context.Context, req *__.SendButtonsRequest) (*
 	if err != nil {
 		return nil, err
 	}
+	return s.idempotent(ctx, cli, req.GetIdempotencyKey(), __.MessageService_SendButtons_FullMethodName, req, func() (*__.MessageResponse, error) {
+		return s.sendButtons(ctx, cli, req)
+	})
+}
 
+func (s *Server) sendButtons(ctx context.Context, cli *gows.GoWS, req *__.SendButtonsRequest) (*__.MessageResponse, error) {
 	jid, err := types.ParseJID(req.GetJid())
 	if err != nil {
 		return nil, err
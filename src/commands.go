@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/devlikeapro/gows/gateway"
+	"github.com/devlikeapro/gows/gows"
+	gowsLog "github.com/devlikeapro/gows/log"
+	"github.com/devlikeapro/gows/server"
+)
+
+// commands run instead of the server: gows <command> [flags]
+var commands = map[string]func(args []string) error{
+	"export":  exportCommand,
+	"import":  importCommand,
+	"openapi": openAPICommand,
+}
+
+// runCommand runs the command from the args,
+// returns false if args don't start with a command - the server must be started
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		return false
+	}
+	err := command(args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+	return true
+}
+
+func storeFlags(fs *flag.FlagSet) (dialect *string, address *string) {
+	dialect = fs.String("dialect", "sqlite3", "Session store dialect: sqlite3 or postgres")
+	address = fs.String("address", "", "Session store address, the same as in SessionConfig")
+	return dialect, address
+}
+
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dialect, address := storeFlags(fs)
+	out := fs.String("out", "", "Archive file to write")
+	_ = fs.Parse(args)
+	if *address == "" || *out == "" {
+		return errors.New("-address and -out are required")
+	}
+
+	store, err := gows.BuildStoreConfig(*dialect, *address)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	log := gowsLog.Stdout("Export", "INFO", false)
+	err = gows.ExportSession(context.Background(), store, file, log)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(*out)
+		return err
+	}
+	log.Infof("Session has been exported to %s", *out)
+	return nil
+}
+
+func importCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dialect, address := storeFlags(fs)
+	in := fs.String("in", "", "Archive file to read")
+	_ = fs.Parse(args)
+	if *address == "" || *in == "" {
+		return errors.New("-address and -in are required")
+	}
+
+	store, err := gows.BuildStoreConfig(*dialect, *address)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	log := gowsLog.Stdout("Import", "INFO", false)
+	err = gows.ImportSession(context.Background(), store, file, log)
+	if err != nil {
+		return err
+	}
+	log.Infof("Session has been imported from %s", *in)
+	return nil
+}
+
+// openAPICommand writes the OpenAPI document of the HTTP gateway
+func openAPICommand(args []string) error {
+	fs := flag.NewFlagSet("openapi", flag.ExitOnError)
+	out := fs.String("out", "", "File to write, stdout if empty")
+	_ = fs.Parse(args)
+
+	doc, err := gateway.OpenAPI(server.Version)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(append(doc, '\n'))
+		return err
+	}
+	return os.WriteFile(*out, append(doc, '\n'), 0644)
+}
@@ -0,0 +1,146 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// maxBodySize - the largest JSON body accepted, the same as the gRPC message size limit
+const maxBodySize = 128 * 1024 * 1024
+
+var unmarshalOptions = protojson.UnmarshalOptions{}
+
+// reservedQuery - query parameters used by the gateway itself
+var reservedQuery = map[string]bool{"access_token": true}
+
+// bind fills the request from the JSON body, the query and the path - in this order, so the path wins.
+// Query parameters set fields by their JSON names, nested fields are separated with ".": ?pagination.limit=10
+func bind(r *http.Request, route Route, msg proto.Message, body bool) error {
+	if body && r.Method != http.MethodGet {
+		data, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodySize))
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "failed to read the body: %v", err)
+		}
+		if len(strings.TrimSpace(string(data))) > 0 {
+			err = unmarshalOptions.Unmarshal(data, msg)
+			if err != nil {
+				return status.Errorf(codes.InvalidArgument, "invalid JSON body: %v", err)
+			}
+		}
+	}
+	for key, values := range r.URL.Query() {
+		if reservedQuery[key] {
+			continue
+		}
+		err := setField(msg.ProtoReflect(), key, values)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid query parameter %s: %v", key, err)
+		}
+	}
+	for name, field := range pathFields(route.Path) {
+		err := setField(msg.ProtoReflect(), field, []string{r.PathValue(name)})
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid path parameter %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// setField sets the scalar field by its path, nested messages are created on the way
+func setField(msg protoreflect.Message, path string, values []string) error {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		field := findField(msg.Descriptor(), name)
+		if field == nil {
+			return fmt.Errorf("unknown field '%s'", name)
+		}
+		if i < len(names)-1 {
+			if field.Kind() != protoreflect.MessageKind || field.IsList() || field.IsMap() {
+				return fmt.Errorf("field '%s' has no nested fields", name)
+			}
+			msg = msg.Mutable(field).Message()
+			continue
+		}
+		if field.IsMap() || field.Kind() == protoreflect.MessageKind || field.Kind() == protoreflect.GroupKind {
+			return fmt.Errorf("field '%s' is not a scalar, set its fields or send it in the body", name)
+		}
+		if field.IsList() {
+			list := msg.Mutable(field).List()
+			for _, value := range values {
+				parsed, err := parseValue(field, value)
+				if err != nil {
+					return err
+				}
+				list.Append(parsed)
+			}
+			return nil
+		}
+		parsed, err := parseValue(field, values[len(values)-1])
+		if err != nil {
+			return err
+		}
+		msg.Set(field, parsed)
+	}
+	return nil
+}
+
+func findField(desc protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	if field := desc.Fields().ByJSONName(name); field != nil {
+		return field
+	}
+	return desc.Fields().ByName(protoreflect.Name(name))
+}
+
+func parseValue(field protoreflect.FieldDescriptor, value string) (protoreflect.Value, error) {
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(value), nil
+	case protoreflect.BoolKind:
+		v, err := strconv.ParseBool(value)
+		return protoreflect.ValueOfBool(v), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := strconv.ParseInt(value, 10, 32)
+		return protoreflect.ValueOfInt32(int32(v)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := strconv.ParseInt(value, 10, 64)
+		return protoreflect.ValueOfInt64(v), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := strconv.ParseUint(value, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(v)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := strconv.ParseUint(value, 10, 64)
+		return protoreflect.ValueOfUint64(v), err
+	case protoreflect.FloatKind:
+		v, err := strconv.ParseFloat(value, 32)
+		return protoreflect.ValueOfFloat32(float32(v)), err
+	case protoreflect.DoubleKind:
+		v, err := strconv.ParseFloat(value, 64)
+		return protoreflect.ValueOfFloat64(v), err
+	case protoreflect.BytesKind:
+		v, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			v, err = base64.URLEncoding.DecodeString(value)
+		}
+		return protoreflect.ValueOfBytes(v), err
+	case protoreflect.EnumKind:
+		if enum := field.Enum().Values().ByName(protoreflect.Name(value)); enum != nil {
+			return protoreflect.ValueOfEnum(enum.Number()), nil
+		}
+		v, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("unknown %s value '%s'", field.Enum().Name(), value)
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), nil
+	}
+	return protoreflect.Value{}, fmt.Errorf("unsupported field type %s", field.Kind())
+}
@@ -0,0 +1,269 @@
+// Package gateway serves the gRPC services as REST/JSON over HTTP, see Routes.
+// RPCs are called in-process through the same interceptors as on the gRPC server,
+// server streams are sent as Server-Sent Events or WebSocket messages.
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/devlikeapro/gows/proto"
+	"github.com/devlikeapro/gows/tracing"
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Server implements the services served by the gateway
+type Server interface {
+	__.MessageServiceServer
+	__.EventStreamServer
+}
+
+// Config configures the gateway
+type Config struct {
+	// Unary and Stream interceptors - the same as on the gRPC server (auth, metrics, timeouts)
+	Unary  []grpc.UnaryServerInterceptor
+	Stream []grpc.StreamServerInterceptor
+	// CORSOrigins - origins allowed to call the gateway from browsers, "*" - any origin
+	CORSOrigins []string
+	// Version - the server version shown in the OpenAPI document
+	Version string
+	// UploadMaxSize - the largest media accepted by UploadMedia, bodies of client streams are limited to it
+	// in base64 (see streamBodySize). 0 - not limited.
+	UploadMaxSize int64
+}
+
+// Gateway is an http.Handler calling the RPCs
+type Gateway struct {
+	log    waLog.Logger
+	mux    *http.ServeMux
+	unary  grpc.UnaryServerInterceptor
+	stream grpc.StreamServerInterceptor
+	cors   map[string]bool
+	// originPatterns - hosts of CORSOrigins, allowed to open WebSocket connections
+	originPatterns []string
+	openAPI        []byte
+	// maxStreamBodySize - the largest body of client streams, 0 - not limited
+	maxStreamBodySize int64
+}
+
+// forwardedHeaders - HTTP headers passed to RPCs as metadata
+var forwardedHeaders = []string{"authorization", "traceparent", "tracestate", "baggage"}
+
+var marshalOptions = protojson.MarshalOptions{}
+
+// New builds the gateway for the server, every route in Routes must be served by the server
+func New(log waLog.Logger, srv Server, cfg Config) (*Gateway, error) {
+	g := &Gateway{
+		log:    log,
+		mux:    http.NewServeMux(),
+		unary:  chainUnary(cfg.Unary),
+		stream: chainStream(cfg.Stream),
+		cors:   map[string]bool{},
+	}
+	if cfg.UploadMaxSize > 0 {
+		g.maxStreamBodySize = streamBodySize(cfg.UploadMaxSize)
+	}
+	for _, origin := range cfg.CORSOrigins {
+		g.cors[origin] = true
+		if origin == "*" {
+			g.originPatterns = append(g.originPatterns, "*")
+		} else if u, err := url.Parse(origin); err == nil && u.Host != "" {
+			g.originPatterns = append(g.originPatterns, u.Host)
+		}
+	}
+	services := []*grpc.ServiceDesc{&__.MessageService_ServiceDesc, &__.EventStream_ServiceDesc}
+	for _, service := range services {
+		for i := range service.Methods {
+			method := &service.Methods[i]
+			fullMethod := "/" + service.ServiceName + "/" + method.MethodName
+			route, ok := Routes[fullMethod]
+			if !ok {
+				return nil, fmt.Errorf("no route for %s", fullMethod)
+			}
+			g.mux.HandleFunc(route.Method+" "+route.Path, g.unaryHandler(srv, fullMethod, route, method))
+		}
+		for i := range service.Streams {
+			stream := &service.Streams[i]
+			fullMethod := "/" + service.ServiceName + "/" + stream.StreamName
+			route, ok := Routes[fullMethod]
+			if !ok {
+				return nil, fmt.Errorf("no route for %s", fullMethod)
+			}
+			handler := g.streamHandler(srv, fullMethod, route, stream)
+			g.mux.HandleFunc(route.Method+" "+route.Path, handler)
+			if route.Method != http.MethodGet {
+				// WebSocket handshake is always GET
+				g.mux.HandleFunc("GET "+route.Path, handler)
+			}
+		}
+	}
+	doc, err := OpenAPI(cfg.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OpenAPI document: %w", err)
+	}
+	g.openAPI = doc
+	g.mux.HandleFunc("GET /openapi.json", g.openAPIHandler)
+	return g, nil
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if origin := r.Header.Get("Origin"); origin != "" && (g.cors["*"] || g.cors[origin]) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Vary", "Origin")
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Last-Event-ID")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	g.mux.ServeHTTP(w, r)
+}
+
+func (g *Gateway) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(g.openAPI)
+}
+
+// rpcContext passes the forwarded headers as incoming metadata, like the gRPC server does
+func rpcContext(r *http.Request, fullMethod string) context.Context {
+	md := metadata.MD{}
+	for _, header := range forwardedHeaders {
+		if values := r.Header.Values(header); len(values) > 0 {
+			md.Set(header, values...)
+		}
+	}
+	// Browsers can't set headers for EventSource and WebSocket
+	if token := r.URL.Query().Get("access_token"); token != "" && md.Get("authorization") == nil {
+		md.Set("authorization", "Bearer "+token)
+	}
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx = grpc.NewContextWithServerTransportStream(ctx, &transportStream{method: fullMethod})
+	return metadata.NewIncomingContext(ctx, md)
+}
+
+func (g *Gateway) unaryHandler(srv Server, fullMethod string, route Route, method *grpc.MethodDesc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.Start(rpcContext(r, fullMethod), "HTTP "+route.Method+" "+route.Path)
+		decode := func(req interface{}) error {
+			return bind(r, route, req.(proto.Message), true)
+		}
+		resp, err := method.Handler(srv, ctx, decode, g.unary)
+		tracing.End(span, err)
+		if err != nil {
+			g.writeError(w, err)
+			return
+		}
+		g.writeMessage(w, resp.(proto.Message))
+	}
+}
+
+func (g *Gateway) writeMessage(w http.ResponseWriter, msg proto.Message) {
+	data, err := marshalOptions.Marshal(msg)
+	if err != nil {
+		g.writeError(w, status.Errorf(codes.Internal, "failed to marshal the response: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// writeError writes the status as JSON (google.rpc.Status) with the matching HTTP code
+func (g *Gateway) writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	data, marshalErr := marshalOptions.Marshal(st.Proto())
+	if marshalErr != nil {
+		g.log.Errorf("Failed to marshal error: %v", marshalErr)
+		data = []byte(`{"code":13,"message":"internal error"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(HTTPStatus(st.Code()))
+	_, _ = w.Write(data)
+}
+
+// HTTPStatus maps the gRPC code to the HTTP status
+func HTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func chainUnary(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+func chainStream(interceptors []grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(srv interface{}, stream grpc.ServerStream) error {
+				return interceptor(srv, stream, info, next)
+			}
+		}
+		return handler(srv, stream)
+	}
+}
+
+// transportStream lets grpc.Method work in the handlers, headers and trailers are not sent over HTTP
+type transportStream struct {
+	method string
+}
+
+func (s *transportStream) Method() string                  { return s.method }
+func (s *transportStream) SetHeader(md metadata.MD) error  { return nil }
+func (s *transportStream) SendHeader(md metadata.MD) error { return nil }
+func (s *transportStream) SetTrailer(md metadata.MD) error { return nil }
+
+// pathFields - the request fields set by the path wildcards
+func pathFields(path string) map[string]string {
+	fields := map[string]string{}
+	for _, segment := range strings.Split(path, "/") {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			name = strings.TrimSuffix(name, "}")
+			fields[name] = strings.ReplaceAll(name, "_", ".")
+		}
+	}
+	return fields
+}
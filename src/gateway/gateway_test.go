@@ -0,0 +1,228 @@
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/coder/websocket"
+	"github.com/devlikeapro/gows/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeServer struct {
+	__.UnimplementedMessageServiceServer
+	__.UnimplementedEventStreamServer
+}
+
+func (s *fakeServer) GetSessionState(ctx context.Context, req *__.Session) (*__.SessionStateResponse, error) {
+	if req.GetId() != "default" {
+		return nil, status.Errorf(codes.NotFound, "session '%s' not found", req.GetId())
+	}
+	return &__.SessionStateResponse{Found: true, Connected: true}, nil
+}
+
+func (s *fakeServer) StreamEvents(req *__.StreamEventsRequest, stream grpc.ServerStreamingServer[__.EventJson]) error {
+	if req.GetId() != "default" {
+		return status.Errorf(codes.NotFound, "session '%s' not found", req.GetId())
+	}
+	for i := req.GetSinceSequence() + 1; i <= 3; i++ {
+		err := stream.Send(&__.EventJson{Session: req.GetId(), Event: "message", Sequence: i})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fakeServer) UploadMedia(stream __.MessageService_UploadMediaServer) error {
+	var session string
+	var size uint64
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&__.UploadMediaResponse{UploadId: "upload-" + session, Size: size})
+		}
+		if err != nil {
+			return err
+		}
+		if session == "" {
+			session = req.GetSession().GetId()
+		}
+		size += uint64(len(req.GetData()))
+	}
+}
+
+func newTestGateway(t *testing.T) *Gateway {
+	g, err := New(waLog.Noop, &fakeServer{}, Config{Version: "test"})
+	require.NoError(t, err)
+	return g
+}
+
+func TestUnary(t *testing.T) {
+	g := newTestGateway(t)
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/sessions/default/state", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"found":true,"connected":true}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/sessions/other/state", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"code":5,"message":"session 'other' not found"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("POST", "/sessions/default/messages", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
+
+func TestServerSentEvents(t *testing.T) {
+	g := newTestGateway(t)
+
+	r := httptest.NewRequest("GET", "/sessions/default/events", nil)
+	r.Header.Set("Last-Event-ID", "1")
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, r)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	// Resumed after the Last-Event-ID
+	events := strings.Split(strings.TrimSuffix(string(body), "\n\n"), "\n\n")
+	require.Len(t, events, 2)
+	for i, event := range events {
+		lines := strings.Split(event, "\n")
+		require.Len(t, lines, 2)
+		sequence := strconv.Itoa(i + 2)
+		assert.Equal(t, "id: "+sequence, lines[0])
+		data, ok := strings.CutPrefix(lines[1], "data: ")
+		assert.True(t, ok)
+		assert.JSONEq(t, `{"session":"default","event":"message","sequence":"`+sequence+`"}`, data)
+	}
+}
+
+func TestHTTPClientStream(t *testing.T) {
+	g := newTestGateway(t)
+
+	// Newline-delimited JSON, the path applies to the first message
+	body := `{"data":"` + base64.StdEncoding.EncodeToString([]byte("hello ")) + `"}` + "\n" +
+		`{"data":"` + base64.StdEncoding.EncodeToString([]byte("world")) + `"}` + "\n"
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("POST", "/sessions/default/media/uploads", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"uploadId":"upload-default","size":"11"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("POST", "/sessions/default/media/uploads", strings.NewReader(`{"data":`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid JSON message")
+}
+
+func webSocketURL(server *httptest.Server, path string) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http") + path
+}
+
+func TestWebSocketEvents(t *testing.T) {
+	server := httptest.NewServer(newTestGateway(t))
+	defer server.Close()
+	ctx := context.Background()
+
+	conn, _, err := websocket.Dial(ctx, webSocketURL(server, "/sessions/default/events?sinceSequence=1"), nil)
+	require.NoError(t, err)
+	defer conn.CloseNow()
+	for _, sequence := range []string{"2", "3"} {
+		typ, data, err := conn.Read(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, websocket.MessageText, typ)
+		assert.JSONEq(t, `{"session":"default","event":"message","sequence":"`+sequence+`"}`, string(data))
+	}
+	_, _, err = conn.Read(ctx)
+	assert.Equal(t, websocket.StatusNormalClosure, websocket.CloseStatus(err))
+
+	// Errors close the connection with 4000 + gRPC code
+	conn, _, err = websocket.Dial(ctx, webSocketURL(server, "/sessions/other/events"), nil)
+	require.NoError(t, err)
+	defer conn.CloseNow()
+	_, _, err = conn.Read(ctx)
+	var closeErr websocket.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, websocket.StatusCode(4000+int(codes.NotFound)), closeErr.Code)
+	assert.Equal(t, "session 'other' not found", closeErr.Reason)
+}
+
+func TestWebSocketClientStream(t *testing.T) {
+	server := httptest.NewServer(newTestGateway(t))
+	defer server.Close()
+	ctx := context.Background()
+
+	conn, _, err := websocket.Dial(ctx, webSocketURL(server, "/sessions/default/media/uploads"), nil)
+	require.NoError(t, err)
+	defer conn.CloseNow()
+	for _, chunk := range []string{"hello ", "world"} {
+		data := `{"data":"` + base64.StdEncoding.EncodeToString([]byte(chunk)) + `"}`
+		require.NoError(t, conn.Write(ctx, websocket.MessageText, []byte(data)))
+	}
+	// An empty message ends the requests, the response follows
+	require.NoError(t, conn.Write(ctx, websocket.MessageText, nil))
+	_, data, err := conn.Read(ctx)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"uploadId":"upload-default","size":"11"}`, string(data))
+	_, _, err = conn.Read(ctx)
+	assert.Equal(t, websocket.StatusNormalClosure, websocket.CloseStatus(err))
+
+	// Invalid messages close the connection with InvalidArgument
+	conn, _, err = websocket.Dial(ctx, webSocketURL(server, "/sessions/default/media/uploads"), nil)
+	require.NoError(t, err)
+	defer conn.CloseNow()
+	require.NoError(t, conn.Write(ctx, websocket.MessageText, []byte(`{"data":`)))
+	_, _, err = conn.Read(ctx)
+	assert.Equal(t, websocket.StatusCode(4000+int(codes.InvalidArgument)), websocket.CloseStatus(err))
+}
+
+func TestOpenAPI(t *testing.T) {
+	data, err := OpenAPI("test")
+	require.NoError(t, err)
+	var doc struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(data, &doc))
+	for _, route := range Routes {
+		assert.Contains(t, doc.Paths[route.Path], strings.ToLower(route.Method), route.Path)
+	}
+}
+
+func TestClientStreamBodyLimit(t *testing.T) {
+	const maxSize = 1024 * 1024
+	g, err := New(waLog.Noop, &fakeServer{}, Config{UploadMaxSize: maxSize})
+	require.NoError(t, err)
+	upload := func(size int) *httptest.ResponseRecorder {
+		chunk := base64.StdEncoding.EncodeToString(make([]byte, 64*1024))
+		var body strings.Builder
+		for i := 0; i < size/(64*1024); i++ {
+			body.WriteString(`{"data":"` + chunk + `"}` + "\n")
+		}
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, httptest.NewRequest("POST", "/sessions/default/media/uploads", strings.NewReader(body.String())))
+		return w
+	}
+
+	// The largest upload fits in base64
+	w := upload(maxSize)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"uploadId":"upload-default","size":"1048576"}`, w.Body.String())
+
+	w = upload(2 * maxSize)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "request body too large")
+}
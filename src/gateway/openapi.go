@@ -0,0 +1,262 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// queryDepth - how deep nested fields of GET requests are listed as query parameters
+const queryDepth = 2
+
+// OpenAPI builds the OpenAPI 3 document of the routes from the descriptors of proto/gows.proto
+func OpenAPI(version string) ([]byte, error) {
+	b := &openAPIBuilder{schemas: map[string]any{}}
+	paths := map[string]map[string]any{}
+	tags := map[string]bool{}
+	for fullMethod, route := range Routes {
+		operation, err := b.operation(fullMethod, route)
+		if err != nil {
+			return nil, err
+		}
+		if paths[route.Path] == nil {
+			paths[route.Path] = map[string]any{}
+		}
+		paths[route.Path][strings.ToLower(route.Method)] = operation
+		tags[route.Tag] = true
+	}
+	tagList := make([]map[string]any, 0, len(tags))
+	for _, tag := range sortedKeys(tags) {
+		tagList = append(tagList, map[string]any{"name": tag})
+	}
+	b.schemas["google.rpc.Status"] = map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"code":    map[string]any{"type": "integer", "format": "int32", "description": "gRPC status code"},
+			"message": map[string]any{"type": "string"},
+			"details": map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+		},
+	}
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "GOWS",
+			"version": version,
+			"description": "REST/JSON gateway to the gRPC API. Server streams are sent as Server-Sent Events " +
+				"or as WebSocket messages when the request is a WebSocket handshake.",
+		},
+		"tags":  tagList,
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": b.schemas,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []map[string]any{{"bearer": []string{}}},
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+type openAPIBuilder struct {
+	// schemas - message full name -> schema
+	schemas map[string]any
+}
+
+func (b *openAPIBuilder) operation(fullMethod string, route Route) (map[string]any, error) {
+	name := protoreflect.FullName(strings.ReplaceAll(strings.TrimPrefix(fullMethod, "/"), "/", "."))
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("no descriptor for %s: %w", fullMethod, err)
+	}
+	method, ok := desc.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a method", fullMethod)
+	}
+	input := method.Input()
+
+	parameters := []map[string]any{}
+	bound := map[string]bool{}
+	wildcards := pathFields(route.Path)
+	for _, wildcard := range sortedKeys(wildcards) {
+		field, err := fieldByPath(input, wildcards[wildcard])
+		if err != nil {
+			return nil, fmt.Errorf("%s path %s: %w", fullMethod, route.Path, err)
+		}
+		bound[wildcards[wildcard]] = true
+		parameters = append(parameters, map[string]any{
+			"name":     wildcard,
+			"in":       "path",
+			"required": true,
+			"schema":   b.fieldSchema(field),
+		})
+	}
+
+	operation := map[string]any{
+		"operationId": string(method.Name()),
+		"summary":     string(method.Name()),
+		"tags":        []string{route.Tag},
+		"responses": map[string]any{
+			"200": map[string]any{
+				"description": "OK",
+				"content":     b.content(method.Output(), method.IsStreamingServer(), "text/event-stream"),
+			},
+			"default": map[string]any{
+				"description": "Error",
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": ref("google.rpc.Status")},
+				},
+			},
+		},
+	}
+	if route.Method == http.MethodGet {
+		parameters = append(parameters, b.queryParameters(input, "", queryDepth, bound)...)
+	} else {
+		operation["requestBody"] = map[string]any{
+			"content": b.content(input, method.IsStreamingClient(), "application/x-ndjson"),
+		}
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+	if method.IsStreamingServer() || method.IsStreamingClient() {
+		operation["description"] = "Streaming RPC - also available as WebSocket with GET on the same path."
+	}
+	if method.IsStreamingClient() {
+		operation["description"] = operation["description"].(string) +
+			" Over WebSocket every request is a text message, an empty message ends the requests."
+	}
+	return operation, nil
+}
+
+// content - JSON of the message, streams use the stream media type
+func (b *openAPIBuilder) content(desc protoreflect.MessageDescriptor, stream bool, streamType string) map[string]any {
+	mediaType := "application/json"
+	if stream {
+		mediaType = streamType
+	}
+	return map[string]any{mediaType: map[string]any{"schema": b.messageSchema(desc)}}
+}
+
+// queryParameters lists scalar fields of the message with dotted JSON names
+func (b *openAPIBuilder) queryParameters(desc protoreflect.MessageDescriptor, prefix string, depth int, bound map[string]bool) []map[string]any {
+	var parameters []map[string]any
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		name := prefix + field.JSONName()
+		if bound[prefix+string(field.Name())] || bound[name] || field.IsMap() {
+			continue
+		}
+		if field.Kind() == protoreflect.MessageKind || field.Kind() == protoreflect.GroupKind {
+			if depth > 1 && !field.IsList() {
+				parameters = append(parameters, b.queryParameters(field.Message(), name+".", depth-1, bound)...)
+			}
+			continue
+		}
+		parameters = append(parameters, map[string]any{
+			"name":   name,
+			"in":     "query",
+			"schema": b.fieldSchema(field),
+		})
+	}
+	return parameters
+}
+
+// messageSchema adds the message to the components, returns the reference to it
+func (b *openAPIBuilder) messageSchema(desc protoreflect.MessageDescriptor) map[string]any {
+	name := string(desc.FullName())
+	if _, ok := b.schemas[name]; ok {
+		return ref(name)
+	}
+	// Placeholder for recursive messages
+	b.schemas[name] = nil
+	properties := map[string]any{}
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		properties[field.JSONName()] = b.fieldSchema(field)
+	}
+	b.schemas[name] = map[string]any{"type": "object", "properties": properties}
+	return ref(name)
+}
+
+func (b *openAPIBuilder) fieldSchema(field protoreflect.FieldDescriptor) map[string]any {
+	if field.IsMap() {
+		return map[string]any{"type": "object", "additionalProperties": b.valueSchema(field.MapValue())}
+	}
+	if field.IsList() {
+		return map[string]any{"type": "array", "items": b.valueSchema(field)}
+	}
+	return b.valueSchema(field)
+}
+
+// valueSchema - the schema of a single value, protojson mapping: 64-bit integers are strings, bytes are base64
+func (b *openAPIBuilder) valueSchema(field protoreflect.FieldDescriptor) map[string]any {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		return map[string]any{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return map[string]any{"type": "integer", "format": "int32", "minimum": 0}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return map[string]any{"type": "string", "format": "int64"}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return map[string]any{"type": "string", "format": "uint64"}
+	case protoreflect.FloatKind:
+		return map[string]any{"type": "number", "format": "float"}
+	case protoreflect.DoubleKind:
+		return map[string]any{"type": "number", "format": "double"}
+	case protoreflect.StringKind:
+		return map[string]any{"type": "string"}
+	case protoreflect.BytesKind:
+		return map[string]any{"type": "string", "format": "byte"}
+	case protoreflect.EnumKind:
+		values := field.Enum().Values()
+		names := make([]string, values.Len())
+		for i := range names {
+			names[i] = string(values.Get(i).Name())
+		}
+		return map[string]any{"type": "string", "enum": names}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return b.messageSchema(field.Message())
+	}
+	return map[string]any{}
+}
+
+// fieldByPath finds the field by the dotted path of names or JSON names
+func fieldByPath(desc protoreflect.MessageDescriptor, path string) (protoreflect.FieldDescriptor, error) {
+	var field protoreflect.FieldDescriptor
+	for i, name := range strings.Split(path, ".") {
+		if i > 0 {
+			if field.Kind() != protoreflect.MessageKind {
+				return nil, fmt.Errorf("field '%s' has no nested fields", field.Name())
+			}
+			desc = field.Message()
+		}
+		field = findField(desc, name)
+		if field == nil {
+			return nil, fmt.Errorf("unknown field '%s' in %s", name, desc.FullName())
+		}
+	}
+	return field, nil
+}
+
+func ref(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,123 @@
+package gateway
+
+import (
+	"github.com/devlikeapro/gows/proto"
+)
+
+// Route maps an RPC to an HTTP method and path.
+// Path wildcards set request fields, "_" separates nested fields: {session_id} sets session.id
+type Route struct {
+	Method string
+	Path   string
+	// Tag groups the routes in the OpenAPI document
+	Tag string
+}
+
+// Routes - the HTTP route of every RPC, full method name -> route
+var Routes = map[string]Route{
+	// Events
+	__.EventStream_StreamEvents_FullMethodName:         {"GET", "/sessions/{id}/events", "Events"},
+	__.EventStream_StreamTypedEvents_FullMethodName:    {"GET", "/sessions/{id}/events/typed", "Events"},
+	__.EventStream_StreamSessionsEvents_FullMethodName: {"GET", "/events", "Events"},
+
+	// Session management
+	__.MessageService_GetServerInfo_FullMethodName:       {"GET", "/server/info", "Server"},
+	__.MessageService_ListSessions_FullMethodName:        {"GET", "/sessions", "Sessions"},
+	__.MessageService_StartSession_FullMethodName:        {"POST", "/sessions/{id}/start", "Sessions"},
+	__.MessageService_StopSession_FullMethodName:         {"POST", "/sessions/{id}/stop", "Sessions"},
+	__.MessageService_GetSessionState_FullMethodName:     {"GET", "/sessions/{id}/state", "Sessions"},
+	__.MessageService_RequestCode_FullMethodName:         {"POST", "/sessions/{session_id}/pair-code", "Sessions"},
+	__.MessageService_Logout_FullMethodName:              {"POST", "/sessions/{id}/logout", "Sessions"},
+	__.MessageService_UpdateSessionConfig_FullMethodName: {"PATCH", "/sessions/{session_id}/config", "Sessions"},
+	__.MessageService_GetSendQueue_FullMethodName:        {"GET", "/sessions/{id}/send-queue", "Sessions"},
+	__.MessageService_SetLogLevel_FullMethodName:         {"PUT", "/server/log-level", "Server"},
+	__.MessageService_ExportSession_FullMethodName:       {"POST", "/sessions/export", "Sessions"},
+	__.MessageService_ImportSession_FullMethodName:       {"POST", "/sessions/import", "Sessions"},
+
+	// Profile
+	__.MessageService_SetProfileName_FullMethodName:    {"PUT", "/sessions/{session_id}/profile/name", "Profile"},
+	__.MessageService_SetProfileStatus_FullMethodName:  {"PUT", "/sessions/{session_id}/profile/status", "Profile"},
+	__.MessageService_SetProfilePicture_FullMethodName: {"PUT", "/sessions/{session_id}/profile/picture", "Profile"},
+
+	// Lids
+	__.MessageService_GetAllLids_FullMethodName:           {"GET", "/sessions/{session_id}/lids", "Lids"},
+	__.MessageService_GetLidsCount_FullMethodName:         {"GET", "/sessions/{id}/lids/count", "Lids"},
+	__.MessageService_FindPNByLid_FullMethodName:          {"GET", "/sessions/{session_id}/lids/{id}/pn", "Lids"},
+	__.MessageService_FindLIDByPhoneNumber_FullMethodName: {"GET", "/sessions/{session_id}/pn/{id}/lid", "Lids"},
+
+	// Groups
+	__.MessageService_FetchGroups_FullMethodName:             {"POST", "/sessions/{id}/groups/refresh", "Groups"},
+	__.MessageService_GetGroups_FullMethodName:               {"GET", "/sessions/{id}/groups", "Groups"},
+	__.MessageService_GetGroupInfo_FullMethodName:            {"GET", "/sessions/{session_id}/groups/{jid}", "Groups"},
+	__.MessageService_CreateGroup_FullMethodName:             {"POST", "/sessions/{session_id}/groups", "Groups"},
+	__.MessageService_LeaveGroup_FullMethodName:              {"POST", "/sessions/{session_id}/groups/{jid}/leave", "Groups"},
+	__.MessageService_GetGroupInviteLink_FullMethodName:      {"GET", "/sessions/{session_id}/groups/{jid}/invite-link", "Groups"},
+	__.MessageService_RevokeGroupInviteLink_FullMethodName:   {"POST", "/sessions/{session_id}/groups/{jid}/invite-link/revoke", "Groups"},
+	__.MessageService_GetGroupInfoFromLink_FullMethodName:    {"GET", "/sessions/{session_id}/group-invites/{code}", "Groups"},
+	__.MessageService_JoinGroupWithLink_FullMethodName:       {"POST", "/sessions/{session_id}/group-invites/{code}/join", "Groups"},
+	__.MessageService_SetGroupName_FullMethodName:            {"PUT", "/sessions/{session_id}/groups/{jid}/name", "Groups"},
+	__.MessageService_SetGroupDescription_FullMethodName:     {"PUT", "/sessions/{session_id}/groups/{jid}/description", "Groups"},
+	__.MessageService_SetGroupPicture_FullMethodName:         {"PUT", "/sessions/{session_id}/groups/{jid}/picture", "Groups"},
+	__.MessageService_SetGroupLocked_FullMethodName:          {"PUT", "/sessions/{session_id}/groups/{jid}/locked", "Groups"},
+	__.MessageService_SetGroupAnnounce_FullMethodName:        {"PUT", "/sessions/{session_id}/groups/{jid}/announce", "Groups"},
+	__.MessageService_UpdateGroupParticipants_FullMethodName: {"POST", "/sessions/{session_id}/groups/{jid}/participants", "Groups"},
+
+	// Actions
+	__.MessageService_GetProfilePicture_FullMethodName: {"GET", "/sessions/{session_id}/contacts/{jid}/picture", "Actions"},
+	__.MessageService_SendPresence_FullMethodName:      {"POST", "/sessions/{session_id}/presence", "Actions"},
+	__.MessageService_SendChatPresence_FullMethodName:  {"POST", "/sessions/{session_id}/chats/{jid}/presence", "Actions"},
+	__.MessageService_SubscribePresence_FullMethodName: {"POST", "/sessions/{session_id}/contacts/{jid}/presence/subscribe", "Actions"},
+	__.MessageService_CheckPhones_FullMethodName:       {"POST", "/sessions/{session_id}/phones/check", "Actions"},
+	__.MessageService_MarkChatUnread_FullMethodName:    {"POST", "/sessions/{session_id}/chats/{jid}/unread", "Actions"},
+
+	// Messages
+	__.MessageService_GenerateNewMessageID_FullMethodName: {"GET", "/sessions/{id}/messages/new-id", "Messages"},
+	__.MessageService_SendMessage_FullMethodName:          {"POST", "/sessions/{session_id}/messages", "Messages"},
+	__.MessageService_SendReaction_FullMethodName:         {"POST", "/sessions/{session_id}/messages/{messageId}/reaction", "Messages"},
+	__.MessageService_MarkRead_FullMethodName:             {"POST", "/sessions/{session_id}/messages/read", "Messages"},
+	__.MessageService_EditMessage_FullMethodName:          {"PUT", "/sessions/{session_id}/messages/{messageId}", "Messages"},
+	__.MessageService_RevokeMessage_FullMethodName:        {"DELETE", "/sessions/{session_id}/messages/{messageId}", "Messages"},
+	__.MessageService_SendButtonReply_FullMethodName:      {"POST", "/sessions/{session_id}/messages/button-reply", "Messages"},
+	__.MessageService_SendButtons_FullMethodName:          {"POST", "/sessions/{session_id}/messages/buttons", "Messages"},
+	__.MessageService_CancelEventMessage_FullMethodName:   {"POST", "/sessions/{session_id}/messages/{messageId}/cancel-event", "Messages"},
+	__.MessageService_DownloadMedia_FullMethodName:        {"POST", "/sessions/{session_id}/media/download", "Messages"},
+	__.MessageService_DownloadMediaStream_FullMethodName:  {"POST", "/sessions/{session_id}/media/download/stream", "Messages"},
+	__.MessageService_UploadMedia_FullMethodName:          {"POST", "/sessions/{session_id}/media/uploads", "Messages"},
+
+	// Outbox
+	__.MessageService_EnqueueMessage_FullMethodName:      {"POST", "/sessions/{session_id}/outbox", "Outbox"},
+	__.MessageService_ListQueuedMessages_FullMethodName:  {"GET", "/sessions/{session_id}/outbox", "Outbox"},
+	__.MessageService_CancelQueuedMessage_FullMethodName: {"DELETE", "/sessions/{session_id}/outbox/{id}", "Outbox"},
+
+	// Newsletters
+	__.MessageService_GetSubscribedNewsletters_FullMethodName:      {"GET", "/sessions/{session_id}/newsletters", "Newsletters"},
+	__.MessageService_GetNewsletterInfo_FullMethodName:             {"GET", "/sessions/{session_id}/newsletters/{id}", "Newsletters"},
+	__.MessageService_GetNewsletterMessagesByInvite_FullMethodName: {"GET", "/sessions/{session_id}/newsletter-invites/{invite}/messages", "Newsletters"},
+	__.MessageService_SearchNewslettersByView_FullMethodName:       {"POST", "/sessions/{session_id}/newsletters/search/view", "Newsletters"},
+	__.MessageService_SearchNewslettersByText_FullMethodName:       {"POST", "/sessions/{session_id}/newsletters/search/text", "Newsletters"},
+	__.MessageService_CreateNewsletter_FullMethodName:              {"POST", "/sessions/{session_id}/newsletters", "Newsletters"},
+	__.MessageService_NewsletterToggleMute_FullMethodName:          {"PUT", "/sessions/{session_id}/newsletters/{jid}/mute", "Newsletters"},
+	__.MessageService_NewsletterToggleFollow_FullMethodName:        {"PUT", "/sessions/{session_id}/newsletters/{jid}/follow", "Newsletters"},
+
+	// Labels
+	__.MessageService_GetLabels_FullMethodName:         {"GET", "/sessions/{session_id}/labels", "Labels"},
+	__.MessageService_UpsertLabel_FullMethodName:       {"PUT", "/sessions/{session_id}/labels", "Labels"},
+	__.MessageService_DeleteLabel_FullMethodName:       {"DELETE", "/sessions/{session_id}/labels/{label_id}", "Labels"},
+	__.MessageService_AddChatLabel_FullMethodName:      {"PUT", "/sessions/{session_id}/chats/{chatId}/labels/{labelId}", "Labels"},
+	__.MessageService_RemoveChatLabel_FullMethodName:   {"DELETE", "/sessions/{session_id}/chats/{chatId}/labels/{labelId}", "Labels"},
+	__.MessageService_GetLabelsByJid_FullMethodName:    {"GET", "/sessions/{session_id}/chats/{id}/labels", "Labels"},
+	__.MessageService_GetChatsByLabelId_FullMethodName: {"GET", "/sessions/{session_id}/labels/{id}/chats", "Labels"},
+
+	// Contacts
+	__.MessageService_UpdateContact_FullMethodName:  {"PUT", "/sessions/{session_id}/contacts/{jid}", "Contacts"},
+	__.MessageService_GetContacts_FullMethodName:    {"GET", "/sessions/{session_id}/contacts", "Contacts"},
+	__.MessageService_GetContactById_FullMethodName: {"GET", "/sessions/{session_id}/contacts/{id}", "Contacts"},
+
+	// Calls
+	__.MessageService_RejectCall_FullMethodName: {"POST", "/sessions/{session_id}/calls/{id}/reject", "Calls"},
+
+	// Storage
+	__.MessageService_GetMessageById_FullMethodName: {"GET", "/sessions/{session_id}/messages/{id}", "Storage"},
+	__.MessageService_GetMessages_FullMethodName:    {"GET", "/sessions/{session_id}/messages", "Storage"},
+	__.MessageService_GetChats_FullMethodName:       {"GET", "/sessions/{session_id}/chats", "Storage"},
+}
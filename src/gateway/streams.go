@@ -0,0 +1,322 @@
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/devlikeapro/gows/tracing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	// sseStartDelay - headers of an event stream are sent with the first message or after the delay,
+	// so errors on the stream start still get their HTTP status
+	sseStartDelay = time.Second
+	// sseKeepAlive - how often a comment is sent to keep idle event streams open behind proxies
+	sseKeepAlive = 15 * time.Second
+)
+
+// streamBodySize returns the largest newline-delimited JSON body of client streams carrying up to maxSize bytes:
+// bytes are base64 in JSON, the JSON around chunks gets 1/16 on top of it and 64KB more for the first message
+func streamBodySize(maxSize int64) int64 {
+	encoded := int64(base64.StdEncoding.EncodedLen(int(maxSize)))
+	return encoded + encoded/16 + 64*1024
+}
+
+// httpStream is grpc.ServerStream over HTTP, messages come from recv and go to send
+type httpStream struct {
+	ctx  context.Context
+	recv func(msg proto.Message) error
+	send func(msg proto.Message) error
+}
+
+func (s *httpStream) SetHeader(metadata.MD) error  { return nil }
+func (s *httpStream) SendHeader(metadata.MD) error { return nil }
+func (s *httpStream) SetTrailer(metadata.MD)       {}
+func (s *httpStream) Context() context.Context     { return s.ctx }
+func (s *httpStream) SendMsg(m interface{}) error  { return s.send(m.(proto.Message)) }
+func (s *httpStream) RecvMsg(m interface{}) error  { return s.recv(m.(proto.Message)) }
+
+// streamHandler serves the streaming RPC:
+//   - WebSocket - the request comes from the path and the query (client streams - from text messages,
+//     an empty message ends them), every response is a text message,
+//     the connection is closed with 4000 + gRPC code on errors
+//   - HTTP - client streams read the body as newline-delimited JSON,
+//     server streams are sent as Server-Sent Events (text/event-stream)
+//
+// The path and the query of client streams apply to the first message.
+func (g *Gateway) streamHandler(srv Server, fullMethod string, route Route, desc *grpc.StreamDesc) http.HandlerFunc {
+	info := &grpc.StreamServerInfo{
+		FullMethod:     fullMethod,
+		IsClientStream: desc.ClientStreams,
+		IsServerStream: desc.ServerStreams,
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.Start(rpcContext(r, fullMethod), "HTTP "+route.Method+" "+route.Path)
+		var err error
+		switch {
+		case strings.EqualFold(r.Header.Get("Upgrade"), "websocket"):
+			err = g.serveWebSocket(ctx, w, r, srv, route, desc, info)
+		case r.Method != route.Method:
+			err = status.Errorf(codes.InvalidArgument, "use %s or WebSocket", route.Method)
+			g.writeError(w, err)
+		default:
+			err = g.serveHTTPStream(ctx, w, r, srv, route, desc, info)
+		}
+		tracing.End(span, err)
+	}
+}
+
+// singleRequest reads the only request of a server stream from the HTTP request.
+// Last-Event-ID resumes event streams (sinceSequence) after a reconnect.
+func singleRequest(r *http.Request, route Route, body bool) func(msg proto.Message) error {
+	done := false
+	return func(msg proto.Message) error {
+		if done {
+			return io.EOF
+		}
+		done = true
+		if id := r.Header.Get("Last-Event-ID"); id != "" && findField(msg.ProtoReflect().Descriptor(), "sinceSequence") != nil {
+			err := setField(msg.ProtoReflect(), "sinceSequence", []string{id})
+			if err != nil {
+				return status.Errorf(codes.InvalidArgument, "invalid Last-Event-ID: %v", err)
+			}
+		}
+		return bind(r, route, msg, body)
+	}
+}
+
+func (g *Gateway) serveHTTPStream(ctx context.Context, w http.ResponseWriter, r *http.Request, srv Server, route Route, desc *grpc.StreamDesc, info *grpc.StreamServerInfo) error {
+	stream := &httpStream{ctx: ctx}
+	if desc.ClientStreams {
+		body := r.Body
+		if g.maxStreamBodySize > 0 {
+			body = http.MaxBytesReader(nil, body, g.maxStreamBodySize)
+		}
+		decoder := json.NewDecoder(body)
+		first := true
+		stream.recv = func(msg proto.Message) error {
+			var raw json.RawMessage
+			err := decoder.Decode(&raw)
+			if err == io.EOF {
+				return io.EOF
+			}
+			if err != nil {
+				return status.Errorf(codes.InvalidArgument, "invalid JSON message: %v", err)
+			}
+			err = unmarshalMessage(raw, msg)
+			if err != nil || !first {
+				return err
+			}
+			first = false
+			return bind(r, route, msg, false)
+		}
+	} else {
+		stream.recv = singleRequest(r, route, true)
+	}
+
+	if !desc.ServerStreams {
+		written := false
+		stream.send = func(msg proto.Message) error {
+			written = true
+			g.writeMessage(w, msg)
+			return nil
+		}
+		err := g.stream(srv, stream, info, desc.Handler)
+		if err != nil && !written {
+			g.writeError(w, err)
+		}
+		return err
+	}
+
+	events := newSSEWriter(w)
+	stream.send = events.send
+	stop := make(chan struct{})
+	go events.keepAlive(stop)
+	err := g.stream(srv, stream, info, desc.Handler)
+	close(stop)
+	events.finish(g, err)
+	return err
+}
+
+func (g *Gateway) serveWebSocket(ctx context.Context, w http.ResponseWriter, r *http.Request, srv Server, route Route, desc *grpc.StreamDesc, info *grpc.StreamServerInfo) error {
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: g.originPatterns})
+	if err != nil {
+		// Accept has written the response
+		return err
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(maxBodySize)
+
+	stream := &httpStream{ctx: ctx}
+	if desc.ClientStreams {
+		first := true
+		stream.recv = func(msg proto.Message) error {
+			_, data, err := conn.Read(ctx)
+			if websocket.CloseStatus(err) == websocket.StatusNormalClosure {
+				return io.EOF
+			}
+			if err != nil {
+				return err
+			}
+			if len(data) == 0 {
+				// The client is done sending and waits for the response
+				return io.EOF
+			}
+			err = unmarshalMessage(data, msg)
+			if err != nil || !first {
+				return err
+			}
+			first = false
+			// The path and the query apply to the first message, like the session of UploadMedia
+			return bind(r, route, msg, false)
+		}
+	} else {
+		// Nothing is read, but the context is canceled when the client goes away
+		stream.ctx = conn.CloseRead(ctx)
+		stream.recv = singleRequest(r, route, false)
+	}
+	stream.send = func(msg proto.Message) error {
+		data, err := marshalOptions.Marshal(msg)
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to marshal the message: %v", err)
+		}
+		return conn.Write(stream.ctx, websocket.MessageText, data)
+	}
+
+	err = g.stream(srv, stream, info, desc.Handler)
+	if err == nil {
+		_ = conn.Close(websocket.StatusNormalClosure, "")
+		return nil
+	}
+	st := status.Convert(err)
+	reason := st.Message()
+	// Close frames are limited to 125 bytes, 2 of them are the code
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	_ = conn.Close(websocket.StatusCode(4000+int(st.Code())), reason)
+	return err
+}
+
+func unmarshalMessage(data []byte, msg proto.Message) error {
+	err := unmarshalOptions.Unmarshal(data, msg)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid JSON message: %v", err)
+	}
+	return nil
+}
+
+// sseWriter writes stream messages as Server-Sent Events.
+// Messages with a sequence (events) get it as the event id, so EventSource resumes from it on reconnect.
+type sseWriter struct {
+	lock    sync.Mutex
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	started bool
+}
+
+func newSSEWriter(w http.ResponseWriter) *sseWriter {
+	return &sseWriter{w: w, rc: http.NewResponseController(w)}
+}
+
+// start sends the headers, must be called with the lock held
+func (s *sseWriter) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	header := s.w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// Disable response buffering in nginx
+	header.Set("X-Accel-Buffering", "no")
+	s.w.WriteHeader(http.StatusOK)
+}
+
+func (s *sseWriter) write(chunk string) error {
+	_, err := io.WriteString(s.w, chunk)
+	if err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *sseWriter) send(msg proto.Message) error {
+	data, err := marshalOptions.Marshal(msg)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to marshal the message: %v", err)
+	}
+	var chunk strings.Builder
+	if sequence := sequenceOf(msg); sequence != 0 {
+		fmt.Fprintf(&chunk, "id: %d\n", sequence)
+	}
+	fmt.Fprintf(&chunk, "data: %s\n\n", data)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.start()
+	return s.write(chunk.String())
+}
+
+func (s *sseWriter) keepAlive(stop <-chan struct{}) {
+	timer := time.NewTimer(sseStartDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+		s.lock.Lock()
+		s.start()
+		err := s.write(": keep-alive\n\n")
+		s.lock.Unlock()
+		if err != nil {
+			return
+		}
+		timer.Reset(sseKeepAlive)
+	}
+}
+
+// finish reports the error as an "error" event, or with the HTTP status if nothing has been sent yet
+func (s *sseWriter) finish(g *Gateway, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err == nil {
+		s.start()
+		return
+	}
+	if !s.started {
+		g.writeError(s.w, err)
+		return
+	}
+	data, marshalErr := marshalOptions.Marshal(status.Convert(err).Proto())
+	if marshalErr != nil {
+		return
+	}
+	_ = s.write(fmt.Sprintf("event: error\ndata: %s\n\n", data))
+}
+
+// sequenceOf returns the "sequence" field of the message, 0 if it has none
+func sequenceOf(msg proto.Message) uint64 {
+	m := msg.ProtoReflect()
+	field := m.Descriptor().Fields().ByName("sequence")
+	if field == nil || field.Kind() != protoreflect.Uint64Kind || field.IsList() {
+		return 0
+	}
+	return m.Get(field).Uint()
+}
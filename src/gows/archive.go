@@ -0,0 +1,44 @@
+package gows
+
+import (
+	"context"
+	"io"
+
+	"github.com/devlikeapro/gows/storage/sqlstorage"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// ErrStoreNotEmpty - sessions can be imported only into an empty store
+var ErrStoreNotEmpty = sqlstorage.ErrStoreNotEmpty
+
+// ExportSession writes the session store (whatsmeow device store and gows_* tables) to w as a portable archive.
+// The session must not be running - keys change while it's connected.
+func ExportSession(ctx context.Context, store StoreConfig, w io.Writer, log waLog.Logger) error {
+	lock, err := sqlstorage.LockStore(ctx, store.Dialect, store.Address, 0)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	container, err := sqlstorage.New(store.Dialect, store.Address, log.Sub("Database"))
+	if err != nil {
+		return err
+	}
+	defer container.Close()
+	return container.Export(ctx, w)
+}
+
+// ImportSession restores the archive written by ExportSession into the store, the dialect may differ.
+// The store must be empty.
+func ImportSession(ctx context.Context, store StoreConfig, r io.Reader, log waLog.Logger) error {
+	lock, err := sqlstorage.LockStore(ctx, store.Dialect, store.Address, 0)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	container, err := sqlstorage.New(store.Dialect, store.Address, log.Sub("Database"))
+	if err != nil {
+		return err
+	}
+	defer container.Close()
+	return container.Import(ctx, r)
+}
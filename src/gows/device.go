@@ -0,0 +1,119 @@
+package gows
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waCompanionReg"
+	"go.mau.fi/whatsmeow/proto/waWa6"
+	"go.mau.fi/whatsmeow/store"
+	"google.golang.org/protobuf/proto"
+)
+
+// DeviceConfig describes how the session is shown in "Linked devices" on the phone.
+// Empty fields fall back to DefaultDeviceConfig.
+type DeviceConfig struct {
+	// OsName - the device name, e.g. "Ubuntu" or your brand
+	OsName string
+	// PlatformType - the device icon, one of DeviceProps.PlatformType names: CHROME, FIREFOX, SAFARI, DESKTOP...
+	PlatformType string
+	// PairClient - the browser used when pairing by code: CHROME, EDGE, FIREFOX, IE, OPERA, SAFARI, ELECTRON, UWP, OTHER
+	PairClient string
+	// DisplayName - the client name shown when pairing by code, e.g. "Chrome (Linux)"
+	DisplayName string
+}
+
+// DefaultDeviceConfig - Firefox (Ubuntu) for QR, Chrome (Linux) for pairing code
+var DefaultDeviceConfig = DeviceConfig{
+	OsName:       "Ubuntu",
+	PlatformType: "FIREFOX",
+	PairClient:   "CHROME",
+	DisplayName:  "Chrome (Linux)",
+}
+
+var deviceOsVersion = [3]uint32{22, 0, 4}
+
+var pairClientTypes = map[string]whatsmeow.PairClientType{
+	"CHROME":   whatsmeow.PairClientChrome,
+	"EDGE":     whatsmeow.PairClientEdge,
+	"FIREFOX":  whatsmeow.PairClientFirefox,
+	"IE":       whatsmeow.PairClientIE,
+	"OPERA":    whatsmeow.PairClientOpera,
+	"SAFARI":   whatsmeow.PairClientSafari,
+	"ELECTRON": whatsmeow.PairClientElectron,
+	"UWP":      whatsmeow.PairClientUWP,
+	"OTHER":    whatsmeow.PairClientOtherWebClient,
+}
+
+// withDefaults fills empty fields from DefaultDeviceConfig
+func (c DeviceConfig) withDefaults() DeviceConfig {
+	if c.OsName == "" {
+		c.OsName = DefaultDeviceConfig.OsName
+	}
+	if c.PlatformType == "" {
+		c.PlatformType = DefaultDeviceConfig.PlatformType
+	}
+	if c.PairClient == "" {
+		c.PairClient = DefaultDeviceConfig.PairClient
+	}
+	if c.DisplayName == "" {
+		c.DisplayName = DefaultDeviceConfig.DisplayName
+	}
+	return c
+}
+
+// Validate checks platform type and pairing client names
+func (c DeviceConfig) Validate() error {
+	c = c.withDefaults()
+	if _, ok := waCompanionReg.DeviceProps_PlatformType_value[strings.ToUpper(c.PlatformType)]; !ok {
+		return fmt.Errorf("unknown device platform type: %s", c.PlatformType)
+	}
+	if _, ok := pairClientTypes[strings.ToUpper(c.PairClient)]; !ok {
+		return fmt.Errorf("unknown pairing client: %s", c.PairClient)
+	}
+	return nil
+}
+
+// deviceProps builds props sent on pairing, the same as store.SetOSInfo does but for the session only
+func (c DeviceConfig) deviceProps() *waCompanionReg.DeviceProps {
+	props := proto.Clone(store.DeviceProps).(*waCompanionReg.DeviceProps)
+	platform := waCompanionReg.DeviceProps_PlatformType(waCompanionReg.DeviceProps_PlatformType_value[strings.ToUpper(c.PlatformType)])
+	props.PlatformType = platform.Enum()
+	props.Os = proto.String(c.OsName)
+	props.Version = &waCompanionReg.DeviceProps_AppVersion{
+		Primary:   proto.Uint32(deviceOsVersion[0]),
+		Secondary: proto.Uint32(deviceOsVersion[1]),
+		Tertiary:  proto.Uint32(deviceOsVersion[2]),
+	}
+	return props
+}
+
+func (c DeviceConfig) pairClient() (whatsmeow.PairClientType, string) {
+	return pairClientTypes[strings.ToUpper(c.PairClient)], c.DisplayName
+}
+
+// applyDeviceConfig makes the client present itself with the session device config
+// instead of process-wide store.DeviceProps
+func applyDeviceConfig(client *whatsmeow.Client, device DeviceConfig) error {
+	deviceProps, err := proto.Marshal(device.deviceProps())
+	if err != nil {
+		return err
+	}
+	osVersion := fmt.Sprintf("%d.%d.%d", deviceOsVersion[0], deviceOsVersion[1], deviceOsVersion[2])
+	client.GetClientPayload = func() *waWa6.ClientPayload {
+		payload := client.Store.GetClientPayload()
+		payload.UserAgent.OsVersion = proto.String(osVersion)
+		payload.UserAgent.OsBuildNumber = proto.String(osVersion)
+		if payload.DevicePairingData != nil {
+			payload.DevicePairingData.DeviceProps = deviceProps
+		}
+		return payload
+	}
+	return nil
+}
+
+// PairClient returns the client type and display name to request a pairing code with
+func (gows *GoWS) PairClient() (whatsmeow.PairClientType, string) {
+	return gows.device.pairClient()
+}
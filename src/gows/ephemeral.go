@@ -1,17 +1,22 @@
 package gows
 
 import (
+	"context"
 	"errors"
 	"github.com/devlikeapro/gows/storage"
+	"github.com/devlikeapro/gows/tracing"
 	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/proto/waHistorySync"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/protobuf/proto"
 )
 
-func (gows *GoWS) PopulateContextInfoDisappearingSettings(info *waE2E.ContextInfo, jid types.JID) (*waE2E.ContextInfo, error) {
-	setting, err := gows.getEphemeralSettings(jid)
+func (gows *GoWS) PopulateContextInfoDisappearingSettings(ctx context.Context, info *waE2E.ContextInfo, jid types.JID) (result *waE2E.ContextInfo, err error) {
+	ctx, span := tracing.Start(ctx, "gows.EphemeralSettings", attribute.String("chat", jid.String()))
+	defer func() { tracing.End(span, err) }()
+	setting, err := gows.getEphemeralSettings(ctx, jid)
 	if errors.Is(err, storage.ErrNotFound) {
 		gows.Log.Debugf("Ephemeral settings not found for %s", jid)
 		return info, nil
@@ -44,9 +49,11 @@ func (gows *GoWS) PopulateContextInfoDisappearingSettings(info *waE2E.ContextInf
 	return info, nil
 }
 
-func (gows *GoWS) getEphemeralSettings(jid types.JID) (*storage.StoredChatEphemeralSetting, error) {
+func (gows *GoWS) getEphemeralSettings(ctx context.Context, jid types.JID) (*storage.StoredChatEphemeralSetting, error) {
 	if jid.Server == types.GroupServer {
-		err := gows.Storage.Groups.FetchGroups(false)
+		ctx, span := tracing.Start(ctx, "gows.FetchGroups")
+		err := gows.Storage.Groups.FetchGroups(ctx, false)
+		tracing.End(span, err)
 		if err != nil {
 			gows.Log.Warnf("Failed fetching groups for ephemeral settings: %v", err)
 		}
@@ -54,7 +61,7 @@ func (gows *GoWS) getEphemeralSettings(jid types.JID) (*storage.StoredChatEpheme
 
 	switch jid.Server {
 	case types.DefaultUserServer, types.HiddenUserServer, types.GroupServer:
-		setting, err := gows.Storage.ChatEphemeralSetting.GetChatEphemeralSetting(jid)
+		setting, err := gows.Storage.ChatEphemeralSetting.GetChatEphemeralSetting(ctx, jid)
 		if err != nil {
 			return nil, err
 		}
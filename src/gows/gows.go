@@ -3,10 +3,13 @@ package gows
 import (
 	"context"
 	"runtime/debug"
+	"sync"
 	"time"
 
+	"github.com/devlikeapro/gows/metrics"
 	"github.com/devlikeapro/gows/storage"
 	"github.com/devlikeapro/gows/storage/sqlstorage"
+	"github.com/devlikeapro/gows/tracing"
 	_ "github.com/jackc/pgx/v5"     // Import the Postgres driver
 	_ "github.com/mattn/go-sqlite3" // Import the SQLite driver
 	"go.mau.fi/whatsmeow"
@@ -14,8 +17,12 @@ import (
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 	waLog "go.mau.fi/whatsmeow/util/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// StorageFlushTimeout limits how long Stop waits for in-flight storage writes
+var StorageFlushTimeout = 30 * time.Second
+
 // GoWS it's Go WebSocket or WhatSapp ;)
 type GoWS struct {
 	*whatsmeow.Client
@@ -27,6 +34,30 @@ type GoWS struct {
 	cancelContext       context.CancelFunc
 	container           *sqlstorage.GContainer
 	storageEventHandler *StorageEventHandler
+	state               *stateMachine
+	// supervisor restarts the session after failures, nil if disabled
+	supervisor *sessionSupervisor
+	// handlerOnce - Start can be called again by the supervisor, subscribe to events only once
+	handlerOnce sync.Once
+	// device - how the session is shown in "Linked devices"
+	device DeviceConfig
+	// storeLock - exclusive lock on the store while the session is running, nil if not locked
+	storeLock sqlstorage.StoreLock
+	// webhooks delivers events to the session webhooks, nil if there are none
+	webhooks *webhookDispatcher
+	// sendGovernor paces outgoing messages, see SendRateConfig
+	sendGovernor *sendGovernor
+	// outbox sends queued messages, nil if the manager has no OutboxSender
+	outbox *outbox
+	// eventsLock - events are not emitted once the channel is closed
+	eventsLock   sync.RWMutex
+	eventsClosed bool
+	// stopping - closed when Stop starts, unblocks events waiting for the buffer
+	stopping chan struct{}
+	// forwarded - closed when ForwardEvents has handled all events, nil if nobody forwards them.
+	// It has its own lock - emitting events holds eventsLock while waiting for the forwarder
+	forwarded   chan struct{}
+	forwardLock sync.Mutex
 }
 
 func (gows *GoWS) reissueEvent(event interface{}) {
@@ -64,19 +95,40 @@ func (gows *GoWS) reissueEvent(event interface{}) {
 }
 
 func (gows *GoWS) handleEvent(event interface{}) {
+	// Statuses must change in order, events are reissued in parallel.
+	// Doesn't block - status events are emitted in background
+	gows.updateStatusFromEvent(event)
 	go gows.reissueEvent(event)
-	go gows.storageEventHandler.handleEvent(event)
+	gows.storageEventHandler.handleEventAsync(event)
 }
 
 func (gows *GoWS) Start() error {
-	gows.AddEventHandler(gows.handleEvent)
+	gows.handlerOnce.Do(func() {
+		gows.AddEventHandler(gows.handleEvent)
+	})
 
 	// Not connected, listen for QR code events
 	if gows.Store.ID == nil {
 		gows.listenQRCodeEvents()
+	} else {
+		gows.setStatus(StatusConnecting, nil)
 	}
 
-	return gows.Connect()
+	err := gows.Connect()
+	if err != nil {
+		gows.fail(err)
+		return err
+	}
+	return nil
+}
+
+// fail hands the failure to the supervisor or marks the session as FAILED if it's not supervised
+func (gows *GoWS) fail(reason error) {
+	if gows.supervisor != nil {
+		gows.supervisor.failed(reason)
+		return
+	}
+	gows.setStatus(StatusFailed, reason)
 }
 
 func (gows *GoWS) listenQRCodeEvents() {
@@ -95,21 +147,110 @@ func (gows *GoWS) listenQRCodeEvents() {
 					return
 				}
 				gows.emitEvent(qr)
+				gows.updateStatusFromEvent(qr)
 			}
 		}
 	}()
 }
 
+// watchStoreLock fails the session if the store lock is lost -
+// another process can take the store, so we must not keep the connection
+func (gows *GoWS) watchStoreLock(lost <-chan struct{}) {
+	select {
+	case <-gows.Context.Done():
+		return
+	case <-lost:
+	}
+	if gows.supervisor != nil {
+		gows.supervisor.stop()
+	}
+	gows.Disconnect()
+	gows.setStatus(StatusFailed, sqlstorage.ErrStoreLockLost)
+}
+
 func (gows *GoWS) Stop() {
+	if gows.supervisor != nil {
+		gows.supervisor.stop()
+	}
+	if gows.outbox != nil {
+		gows.outbox.stop()
+	}
 	gows.Disconnect()
-	err := gows.container.Close()
+	// Let in-flight writes finish before closing the database
+	if !gows.storageEventHandler.flush(StorageFlushTimeout) {
+		gows.Log.Warnf("Storage writes are still running after %v, closing the database anyway", StorageFlushTimeout)
+	}
+	// Forwarded events are journaled and sent to webhooks - both need the database
+	if forwarded := gows.closeEvents(); forwarded != nil {
+		select {
+		case <-forwarded:
+		case <-time.After(StorageFlushTimeout):
+			gows.Log.Warnf("Events are still being forwarded after %v, closing the database anyway", StorageFlushTimeout)
+		}
+	}
+	// Journal writes are batched - record the last ones
+	err := gows.Storage.Events.Flush()
+	if err != nil {
+		gows.Log.Errorf("Error recording events in the journal: %v", err)
+	}
+	// Pending webhook deliveries go to the retry queue, it needs the database
+	if gows.webhooks != nil {
+		gows.webhooks.stop()
+	}
+	err = gows.container.Close()
 	if err != nil {
 		gows.Log.Errorf("Error closing container: %v", err)
 	}
-	close(gows.events)
+	// The store is closed, another process can take it now
+	if gows.storeLock != nil {
+		err = gows.storeLock.Unlock()
+		if err != nil {
+			gows.Log.Errorf("Error releasing store lock: %v", err)
+		}
+	}
 	gows.cancelContext()
 }
 
+// closeEvents closes the events channel, the events already in the buffer are still forwarded.
+// Returns the channel closed when they're forwarded, nil if nobody forwards them.
+func (gows *GoWS) closeEvents() chan struct{} {
+	close(gows.stopping)
+	gows.eventsLock.Lock()
+	defer gows.eventsLock.Unlock()
+	// The last status change is still delivered if there's room for it
+	if evt := gows.state.takePending(); evt != nil {
+		select {
+		case gows.events <- evt:
+		default:
+		}
+	}
+	gows.eventsClosed = true
+	close(gows.events)
+	gows.forwardLock.Lock()
+	defer gows.forwardLock.Unlock()
+	return gows.forwarded
+}
+
+// ForwardEvents passes the session events to handle until the session is stopped,
+// Stop waits for it before closing the database.
+// Returns false right away if the events are forwarded already.
+func (gows *GoWS) ForwardEvents(handle func(event interface{})) bool {
+	gows.forwardLock.Lock()
+	if gows.forwarded != nil {
+		gows.forwardLock.Unlock()
+		return false
+	}
+	forwarded := make(chan struct{})
+	gows.forwarded = forwarded
+	gows.forwardLock.Unlock()
+
+	defer close(forwarded)
+	for event := range gows.events {
+		handle(event)
+	}
+	return true
+}
+
 func (gows *GoWS) GetOwnId() types.JID {
 	if gows == nil {
 		return types.EmptyJID
@@ -121,13 +262,39 @@ func (gows *GoWS) GetOwnId() types.JID {
 	return *id
 }
 
+// DefaultEventBuffer - session events buffered until the server takes them
+const DefaultEventBuffer = 10
+
 func BuildSession(
 	ctx context.Context,
 	log waLog.Logger,
 	dialect string,
 	address string,
 	ignoreJids *IgnoreJidsConfig,
+	device DeviceConfig,
+	webhooks []WebhookConfig,
+	sendRate SendRateConfig,
+	eventBuffer int,
 ) (*GoWS, error) {
+	if eventBuffer <= 0 {
+		eventBuffer = DefaultEventBuffer
+	}
+	device = device.withDefaults()
+	err := device.Validate()
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range webhooks {
+		err = webhook.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = sendRate.Validate()
+	if err != nil {
+		return nil, err
+	}
+
 	// Prepare the database
 	container, err := sqlstorage.New(dialect, address, log.Sub("Database"))
 	if err != nil {
@@ -144,30 +311,65 @@ func BuildSession(
 	client.AutomaticMessageRerequestFromPhone = true
 	client.EmitAppStateEventsOnFullSync = true
 	client.InitialAutoReconnect = true
+	err = applyDeviceConfig(client, device)
+	if err != nil {
+		_ = container.Close()
+		return nil, err
+	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	gows := &GoWS{
-		client,
-		client.DangerousInternals(),
-		ctx,
-		nil,
-		make(chan interface{}, 10),
-		cancel,
-		container,
-		nil,
+		Client:        client,
+		int:           client.DangerousInternals(),
+		Context:       ctx,
+		events:        make(chan interface{}, eventBuffer),
+		cancelContext: cancel,
+		container:     container,
+		state:         newStateMachine(),
+		device:        device,
+		sendGovernor:  newSendGovernor(sendRate),
+		stopping:      make(chan struct{}),
 	}
 	gows.Storage = BuildStorage(container, gows)
 	gows.storageEventHandler = &StorageEventHandler{
-		gows:       gows,
-		log:        gows.Log.Sub("Storage"),
-		storage:    gows.Storage,
-		ignoreJids: ignoreJids,
+		gows:    gows,
+		log:     gows.Log.Sub("Storage"),
+		storage: gows.Storage,
+	}
+	gows.storageEventHandler.SetIgnoreJids(ignoreJids)
+	if len(webhooks) > 0 {
+		gows.webhooks = newWebhookDispatcher(gows.Log.Sub("Webhooks"), gows.Storage.Webhooks, webhooks)
+		gows.webhooks.start()
 	}
 	gows.GetMessageForRetry = gows.storageEventHandler.GetMessageForRetry
 	gows.BackgroundEventCtx = gows.Context
+	go gows.emitStatusEvents()
 	return gows, nil
 }
 
+// Logout unlinks the device, the supervisor doesn't restart logged out sessions
+func (gows *GoWS) Logout(ctx context.Context) error {
+	if gows.supervisor != nil {
+		gows.supervisor.stop()
+	}
+	err := gows.Client.Logout(ctx)
+	if err != nil {
+		return err
+	}
+	gows.setStatus(StatusLoggedOut, nil)
+	return nil
+}
+
+// PairPhone requests a pairing code and moves the session to PAIRING status
+func (gows *GoWS) PairPhone(ctx context.Context, phone string, showPushNotification bool, clientType whatsmeow.PairClientType, clientDisplayName string) (string, error) {
+	code, err := gows.Client.PairPhone(ctx, phone, showPushNotification, clientType, clientDisplayName)
+	if err != nil {
+		return "", err
+	}
+	gows.setStatus(StatusPairing, nil)
+	return code, nil
+}
+
 func (gows *GoWS) GetEventChannel() <-chan interface{} {
 	return gows.events
 }
@@ -181,15 +383,42 @@ func (gows *GoWS) emitEvent(data interface{}) {
 		}
 	}()
 
+	gows.eventsLock.RLock()
+	defer gows.eventsLock.RUnlock()
+	if gows.eventsClosed {
+		return
+	}
 	select {
 	case <-gows.Context.Done():
 		return
+	case <-gows.stopping:
+		return
 	case gows.events <- data:
 	}
 }
 
+// Name - the session name, empty if the session has been built outside the manager
+func (gows *GoWS) Name() string {
+	name, _ := gows.Context.Value("name").(string)
+	return name
+}
+
 func (gows *GoWS) SendMessage(ctx context.Context, to types.JID, msg *waE2E.Message, extra whatsmeow.SendRequestExtra) (message *events.Message, err error) {
 	var resp whatsmeow.SendResponse
+	ctx, span := tracing.Start(ctx, "gows.SendMessage", attribute.String("chat", to.String()))
+	defer func() {
+		tracing.End(span, err)
+		result := "success"
+		if err != nil {
+			result = "failure"
+		}
+		metrics.MessagesSent.WithLabelValues(gows.Name(), result).Inc()
+	}()
+
+	err = gows.waitSendTurn(ctx, to, msg)
+	if err != nil {
+		return nil, err
+	}
 
 	if to.User == "status" && to.Server == types.BroadcastServer {
 		// Broadcast messages (Status)
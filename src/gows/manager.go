@@ -4,19 +4,55 @@ import (
 	"context"
 	"errors"
 	gowsLog "github.com/devlikeapro/gows/log"
-	"go.mau.fi/whatsmeow/binary/proto"
-	"go.mau.fi/whatsmeow/store"
+	"github.com/devlikeapro/gows/storage/sqlstorage"
 	waLog "go.mau.fi/whatsmeow/util/log"
+	"sort"
 	"sync"
+	"time"
 )
 
 var ErrSessionNotFound = errors.New("session not found")
 
+// ErrStoreLocked - the session is running in another process
+var ErrStoreLocked = sqlstorage.ErrStoreLocked
+
 // SessionManager control sessions in thread-safe way
 type SessionManager struct {
-	sessions     map[string]*GoWS
+	sessions map[string]*GoWS
+	infos    map[string]*SessionInfo
+	// building - sessions being built or stopped, closed when it's finished
+	building     map[string]chan struct{}
 	sessionsLock *sync.RWMutex
 	log          waLog.Logger
+	// registry persists sessions configs, nil if persistence is disabled
+	registry     *SessionRegistry
+	supervisor   SupervisorConfig
+	lockWait     time.Duration
+	eventBuffer  int
+	outboxSender OutboxSender
+}
+
+// ManagerConfig contains configuration for the SessionManager
+type ManagerConfig struct {
+	// Registry persists sessions configs, nil keeps sessions in memory only
+	Registry *SessionRegistry
+	// Supervisor restarts failed sessions, zero MaxAttempts disables it
+	Supervisor SupervisorConfig
+	// LockWait - how long to wait for the session store held by another process (takeover),
+	// 0 fails with ErrStoreLocked right away
+	LockWait time.Duration
+	// EventBuffer - session events buffered for the server, DefaultEventBuffer if 0
+	EventBuffer int
+	// OutboxSender sends messages queued with GoWS.EnqueueMessage, the outbox is disabled if nil
+	OutboxSender OutboxSender
+}
+
+// SessionInfo describes a session known to the manager
+type SessionInfo struct {
+	Name   string
+	Config SessionConfig
+	// Restored indicates the session has been brought back from the registry on boot
+	Restored bool
 }
 
 type StoreConfig struct {
@@ -52,26 +88,73 @@ type SessionConfig struct {
 	Log    LogConfig
 	Proxy  ProxyConfig
 	Ignore *IgnoreJidsConfig
+	Device DeviceConfig
+	// Webhooks receive the session events over HTTP
+	Webhooks []WebhookConfig
+	// SendRate paces outgoing messages
+	SendRate SendRateConfig
+}
+
+// SessionConfigUpdate contains settings to change in a running session, nil fields are left as is.
+// Store and Device can't be changed without restarting the session.
+type SessionConfigUpdate struct {
+	Log    *LogConfig
+	Proxy  *ProxyConfig
+	Ignore *IgnoreJidsConfig
+	// SendRate - applied to the next messages
+	SendRate *SendRateConfig
 }
 
-func init() {
-	// Firefox (Ubuntu)
-	store.DeviceProps.PlatformType = proto.DeviceProps_FIREFOX.Enum()
-	store.SetOSInfo("Ubuntu", [3]uint32{22, 0, 4})
+// SessionConfigUpdateResult describes what has been changed by SessionManager.Update
+type SessionConfigUpdateResult struct {
+	Config SessionConfig
+	// Updated - names of the changed fields (log, proxy, ignore, sendRate)
+	Updated []string
+	// Reconnected - names of the fields that required reconnect to apply
+	Reconnected []string
 }
 
-func NewSessionManager() *SessionManager {
+// NewSessionManager creates a manager, see ManagerConfig for persistence and restarts
+func NewSessionManager(cfg ManagerConfig) *SessionManager {
 	return &SessionManager{
 		sessions:     make(map[string]*GoWS),
+		infos:        make(map[string]*SessionInfo),
+		building:     make(map[string]chan struct{}),
 		sessionsLock: &sync.RWMutex{},
-		log:          gowsLog.Stdout("Manager", "DEBUG", false),
+		log:          gowsLog.Server("Manager"),
+		registry:     cfg.Registry,
+		supervisor:   cfg.Supervisor,
+		lockWait:     cfg.LockWait,
+		eventBuffer:  cfg.EventBuffer,
+		outboxSender: cfg.OutboxSender,
 	}
 }
 
 func (sm *SessionManager) Build(name string, cfg SessionConfig) (*GoWS, error) {
+	return sm.build(name, cfg, false)
+}
+
+// Restore builds the session from the config recorded in the registry
+func (sm *SessionManager) Restore(name string, cfg SessionConfig) (*GoWS, error) {
+	return sm.build(name, cfg, true)
+}
+
+func (sm *SessionManager) build(name string, cfg SessionConfig, restored bool) (*GoWS, error) {
+	goWS, done := sm.startBuilding(name)
+	if goWS != nil {
+		return goWS, nil
+	}
+	defer done()
+	// Lock the store before the manager - waiting for takeover must not block other sessions
+	lock, err := sqlstorage.LockStore(context.Background(), cfg.Store.Dialect, cfg.Store.Address, sm.lockWait)
+	if err != nil {
+		sm.log.Errorf("Error locking session '%s' store: %v", name, err)
+		return nil, err
+	}
+
 	sm.sessionsLock.Lock()
 	defer sm.sessionsLock.Unlock()
-	gows, err := sm.unlockedBuild(name, cfg)
+	gows, err := sm.unlockedBuild(name, cfg, restored, lock)
 	if err != nil {
 		sm.log.Errorf("Error building session '%s': %v", name, err)
 		return nil, err
@@ -79,27 +162,88 @@ func (sm *SessionManager) Build(name string, cfg SessionConfig) (*GoWS, error) {
 	return gows, nil
 }
 
-func (sm *SessionManager) unlockedBuild(name string, cfg SessionConfig) (*GoWS, error) {
+// startBuilding returns the session if it's built already, otherwise waits for the build or stop
+// of the same session running in parallel and claims the name - call done when the build is finished
+func (sm *SessionManager) startBuilding(name string) (*GoWS, func()) {
+	sm.sessionsLock.Lock()
+	for {
+		if goWS, ok := sm.sessions[name]; ok {
+			sm.sessionsLock.Unlock()
+			return goWS, nil
+		}
+		building, ok := sm.building[name]
+		if !ok {
+			break
+		}
+		// The other build may fail, check again once it's finished
+		sm.sessionsLock.Unlock()
+		<-building
+		sm.sessionsLock.Lock()
+	}
+	building := make(chan struct{})
+	sm.building[name] = building
+	sm.sessionsLock.Unlock()
+	return nil, func() {
+		sm.finished(name, building)
+	}
+}
+
+// finished wakes up those waiting for the build or stop of the session.
+// The entry is removed only if it's still the caller's one - the built session can be stopping already.
+func (sm *SessionManager) finished(name string, building chan struct{}) {
+	sm.sessionsLock.Lock()
+	if sm.building[name] == building {
+		delete(sm.building, name)
+	}
+	sm.sessionsLock.Unlock()
+	close(building)
+}
+
+// unlockedBuild builds the session holding the store lock, the lock is released when the session stops
+func (sm *SessionManager) unlockedBuild(name string, cfg SessionConfig, restored bool, lock sqlstorage.StoreLock) (*GoWS, error) {
 	if goWS, ok := sm.sessions[name]; ok {
+		// Built in parallel, it has its own lock
+		_ = lock.Unlock()
 		return goWS, nil
 	}
 	sm.log.Debugf("Building session '%s'...", name)
 
 	ctx := context.WithValue(context.Background(), "name", name)
-	log := gowsLog.Stdout("Session", cfg.Log.Level, false)
+	log := gowsLog.With(gowsLog.Stdout("Session", cfg.Log.Level, false).Sub(name), gowsLog.FieldSession, name)
 
 	dialect := cfg.Store.Dialect
 	address := cfg.Store.Address
-	gows, err := BuildSession(ctx, log.Sub(name), dialect, address, cfg.Ignore)
+	gows, err := BuildSession(ctx, log, dialect, address, cfg.Ignore, cfg.Device, cfg.Webhooks, cfg.SendRate, sm.eventBuffer)
 	if err != nil {
+		_ = lock.Unlock()
 		return nil, err
 	}
-	sm.sessions[name] = gows
-
+	gows.storeLock = lock
 	err = gows.SetProxyAddress(cfg.Proxy.Url)
 	if err != nil {
+		// Nothing is registered yet - close the database and release the store lock
+		gows.Stop()
 		return nil, err
 	}
+	if sm.supervisor.MaxAttempts > 0 {
+		gows.supervisor = newSessionSupervisor(sm.supervisor, gows)
+	}
+	if sm.outboxSender != nil {
+		gows.outbox = newOutbox(gows.Log.Sub("Outbox"), gows, sm.outboxSender)
+		gows.outbox.start()
+	}
+	if lost := lock.Lost(); lost != nil {
+		go gows.watchStoreLock(lost)
+	}
+	sm.sessions[name] = gows
+	sm.infos[name] = &SessionInfo{Name: name, Config: cfg, Restored: restored}
+	if sm.registry != nil {
+		err = sm.registry.Save(name, cfg)
+		if err != nil {
+			// The session works, it just won't be restored after restart
+			sm.log.Errorf("Error saving session '%s' to registry: %v", name, err)
+		}
+	}
 	sm.log.Infof("Session has been built '%s'", name)
 	return gows, nil
 }
@@ -140,17 +284,166 @@ func (sm *SessionManager) Get(name string) (*GoWS, error) {
 	}
 }
 
-func (sm *SessionManager) Stop(name string) {
+// List returns all sessions known to the manager, sorted by name
+func (sm *SessionManager) List() []SessionInfo {
+	sm.sessionsLock.RLock()
+	defer sm.sessionsLock.RUnlock()
+
+	infos := make([]SessionInfo, 0, len(sm.infos))
+	for _, info := range sm.infos {
+		infos = append(infos, *info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// Update applies the new settings to the running session without stopping it.
+// Log level, ignore rules and send rate are applied in place, proxy requires reconnect.
+func (sm *SessionManager) Update(name string, update SessionConfigUpdate) (*SessionConfigUpdateResult, error) {
 	sm.sessionsLock.Lock()
-	defer sm.sessionsLock.Unlock()
-	sm.unlockedStop(name)
+	goWS, ok := sm.sessions[name]
+	info := sm.infos[name]
+	if !ok || info == nil {
+		sm.sessionsLock.Unlock()
+		return nil, ErrSessionNotFound
+	}
+	cfg := info.Config
+	result := &SessionConfigUpdateResult{}
+
+	if update.Log != nil && update.Log.Level != cfg.Log.Level {
+		err := goWS.SetLogLevel(update.Log.Level)
+		if err != nil {
+			sm.sessionsLock.Unlock()
+			return nil, err
+		}
+		cfg.Log = *update.Log
+		result.Updated = append(result.Updated, "log")
+	}
+	reconnect := false
+	if update.Proxy != nil && update.Proxy.Url != cfg.Proxy.Url {
+		err := goWS.SetProxyAddress(update.Proxy.Url)
+		if err != nil {
+			sm.sessionsLock.Unlock()
+			return nil, err
+		}
+		cfg.Proxy = *update.Proxy
+		result.Updated = append(result.Updated, "proxy")
+		reconnect = true
+	}
+	current := IgnoreJidsConfig{}
+	if cfg.Ignore != nil {
+		current = *cfg.Ignore
+	}
+	if update.Ignore != nil && *update.Ignore != current {
+		ignore := *update.Ignore
+		goWS.SetIgnoreJids(&ignore)
+		cfg.Ignore = &ignore
+		result.Updated = append(result.Updated, "ignore")
+	}
+	if update.SendRate != nil && *update.SendRate != cfg.SendRate {
+		err := update.SendRate.Validate()
+		if err != nil {
+			sm.sessionsLock.Unlock()
+			return nil, err
+		}
+		goWS.SetSendRate(*update.SendRate)
+		cfg.SendRate = *update.SendRate
+		result.Updated = append(result.Updated, "sendRate")
+	}
+
+	info.Config = cfg
+	result.Config = cfg
+	if len(result.Updated) > 0 && sm.registry != nil {
+		err := sm.registry.Save(name, cfg)
+		if err != nil {
+			sm.log.Errorf("Error saving session '%s' to registry: %v", name, err)
+		}
+	}
+	// Do not block other sessions while reconnecting
+	sm.sessionsLock.Unlock()
+	sm.log.Infof("Session '%s' config updated: %v", name, result.Updated)
+
+	if reconnect {
+		reconnected, err := goWS.Reconnect()
+		if reconnected {
+			result.Reconnected = append(result.Reconnected, "proxy")
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
 }
 
-func (sm *SessionManager) unlockedStop(name string) {
+// Registered returns sessions recorded in the registry - the ones to restore on boot
+func (sm *SessionManager) Registered() (map[string]SessionConfig, error) {
+	if sm.registry == nil {
+		return map[string]SessionConfig{}, nil
+	}
+	return sm.registry.Load()
+}
+
+// StopAll stops all sessions, but keeps them in the registry,
+// so they're restored on the next start. Used on server shutdown.
+func (sm *SessionManager) StopAll() {
+	// Stopping flushes storage - don't block the manager meanwhile
+	sm.sessionsLock.Lock()
+	sessions := sm.sessions
+	sm.sessions = make(map[string]*GoWS)
+	sm.infos = make(map[string]*SessionInfo)
+	sm.sessionsLock.Unlock()
+
+	sm.log.Infof("Stopping %d session(s)...", len(sessions))
+	wg := sync.WaitGroup{}
+	for name, goWS := range sessions {
+		wg.Add(1)
+		go func(name string, goWS *GoWS) {
+			defer wg.Done()
+			goWS.Stop()
+			sm.log.Infof("Session stopped '%s'", name)
+		}(name, goWS)
+	}
+	wg.Wait()
+	sm.log.Infof("All sessions stopped")
+}
+
+// Stop stops the session and removes it from the registry,
+// so it won't be restored after restart
+func (sm *SessionManager) Stop(name string) {
 	sm.log.Infof("Stopping session '%s'...", name)
-	if goWS, ok := sm.sessions[name]; ok {
+	goWS, stopped := sm.remove(name)
+	if goWS != nil {
+		// Outside the manager lock - stopping flushes storage and may take a while
 		goWS.Stop()
-		delete(sm.sessions, name)
+		stopped()
 	}
 	sm.log.Infof("Session stopped '%s'", name)
 }
+
+// remove unregisters the session, builds of the same session wait until stopped is called -
+// the stopping session still holds the store
+func (sm *SessionManager) remove(name string) (*GoWS, func()) {
+	sm.sessionsLock.Lock()
+	defer sm.sessionsLock.Unlock()
+	goWS, ok := sm.sessions[name]
+	if ok {
+		delete(sm.sessions, name)
+		delete(sm.infos, name)
+	}
+	if sm.registry != nil {
+		err := sm.registry.Remove(name)
+		if err != nil {
+			sm.log.Errorf("Error removing session '%s' from registry: %v", name, err)
+		}
+	}
+	if !ok {
+		return nil, nil
+	}
+	stopping := make(chan struct{})
+	sm.building[name] = stopping
+	return goWS, func() {
+		sm.finished(name, stopping)
+	}
+}
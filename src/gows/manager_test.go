@@ -0,0 +1,152 @@
+package gows
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManagerBuildInvalidProxy(t *testing.T) {
+	sm := NewSessionManager(ManagerConfig{})
+	cfg := SessionConfig{
+		Store: StoreConfig{Dialect: "sqlite3", Address: "file:" + filepath.Join(t.TempDir(), "store.db") + "?_foreign_keys=on"},
+		Log:   LogConfig{Level: "ERROR"},
+		Proxy: ProxyConfig{Url: "://invalid"},
+	}
+
+	_, err := sm.Build("default", cfg)
+	assert.Error(t, err)
+	assert.Empty(t, sm.List())
+	_, err = sm.Update("default", SessionConfigUpdate{})
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+
+	// The store lock has been released - the session can be built again
+	cfg.Proxy.Url = ""
+	goWS, err := sm.Build("default", cfg)
+	require.NoError(t, err)
+	assert.Len(t, sm.List(), 1)
+	sm.Stop(goWS.Name())
+}
+
+func TestManagerBuildConcurrent(t *testing.T) {
+	sm := NewSessionManager(ManagerConfig{})
+	cfg := SessionConfig{
+		Store: StoreConfig{Dialect: "sqlite3", Address: "file:" + filepath.Join(t.TempDir(), "store.db") + "?_foreign_keys=on"},
+		Log:   LogConfig{Level: "ERROR"},
+	}
+
+	// The same session started twice at once - both get it, nobody hits the store lock
+	results := make(chan *GoWS, 2)
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			goWS, err := sm.Build("default", cfg)
+			results <- goWS
+			errs <- err
+		}()
+	}
+	first, second := <-results, <-results
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+	assert.Same(t, first, second)
+	assert.Len(t, sm.List(), 1)
+	sm.Stop("default")
+}
+
+func TestManagerRebuildWhileStopping(t *testing.T) {
+	sm := NewSessionManager(ManagerConfig{})
+	cfg := SessionConfig{
+		Store: StoreConfig{Dialect: "sqlite3", Address: "file:" + filepath.Join(t.TempDir(), "store.db") + "?_foreign_keys=on"},
+		Log:   LogConfig{Level: "ERROR"},
+	}
+	first, err := sm.Build("default", cfg)
+	require.NoError(t, err)
+
+	// The build waits for the stopping session to release the store
+	stopping, stopped := sm.remove("default")
+	require.Same(t, first, stopping)
+	built := make(chan *GoWS, 1)
+	go func() {
+		goWS, err := sm.Build("default", cfg)
+		assert.NoError(t, err)
+		built <- goWS
+	}()
+	select {
+	case <-built:
+		t.Fatal("built while the previous session is stopping")
+	case <-time.After(100 * time.Millisecond):
+	}
+	stopping.Stop()
+	stopped()
+	second := <-built
+	require.NotNil(t, second)
+	assert.NotSame(t, first, second)
+	assert.Len(t, sm.List(), 1)
+	sm.StopAll()
+	assert.Empty(t, sm.List())
+}
+
+func TestManagerBuildFinishedWhileStopping(t *testing.T) {
+	sm := NewSessionManager(ManagerConfig{})
+	_, done := sm.startBuilding("default")
+	require.NotNil(t, done)
+	// The session is built and stopped before the build is finished
+	sm.sessionsLock.Lock()
+	sm.sessions["default"] = &GoWS{}
+	sm.infos["default"] = &SessionInfo{Name: "default"}
+	sm.sessionsLock.Unlock()
+	_, stopped := sm.remove("default")
+	done()
+
+	// Builds still wait for the stop
+	sm.sessionsLock.Lock()
+	stopping, ok := sm.building["default"]
+	sm.sessionsLock.Unlock()
+	require.True(t, ok)
+	stopped()
+	<-stopping
+	assert.Empty(t, sm.building)
+}
+
+func TestManagerStopDrainsEvents(t *testing.T) {
+	sm := NewSessionManager(ManagerConfig{})
+	cfg := SessionConfig{
+		Store: StoreConfig{Dialect: "sqlite3", Address: "file:" + filepath.Join(t.TempDir(), "store.db") + "?_foreign_keys=on"},
+		Log:   LogConfig{Level: "ERROR"},
+	}
+	goWS, err := sm.Build("default", cfg)
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	handled := 0
+	var errs []error
+	done := make(chan bool)
+	go func() {
+		done <- goWS.ForwardEvents(func(event interface{}) {
+			if handled == 0 {
+				close(started)
+			}
+			time.Sleep(10 * time.Millisecond)
+			// The database is still open
+			_, _, err := goWS.Storage.Events.Bounds()
+			if err != nil {
+				errs = append(errs, err)
+			}
+			handled++
+		})
+	}()
+	for i := 1; i <= 5; i++ {
+		goWS.emitEvent(&SessionRetryEvent{Attempt: i})
+	}
+	<-started
+
+	sm.Stop("default")
+	assert.True(t, <-done)
+	assert.Equal(t, 5, handled)
+	assert.Empty(t, errs)
+	// Events are not emitted after stop
+	goWS.emitEvent(&SessionRetryEvent{})
+	assert.False(t, goWS.ForwardEvents(func(event interface{}) {}))
+}
@@ -4,41 +4,67 @@ import (
 	"context"
 	"fmt"
 	"github.com/devlikeapro/gows/media"
+	"github.com/devlikeapro/gows/tracing"
 	"github.com/gogo/protobuf/proto"
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/types"
+	"go.opentelemetry.io/otel/attribute"
+	"io"
 	"time"
 )
 
-func (gows *GoWS) DownloadAnyMedia(ctx context.Context, msg *waE2E.Message) (data []byte, err error) {
+// downloadable returns the media of the message
+func downloadable(msg *waE2E.Message) (whatsmeow.DownloadableMessage, error) {
 	if msg == nil {
 		return nil, whatsmeow.ErrNothingDownloadableFound
 	}
 	switch {
 	case msg.ImageMessage != nil:
-		return gows.Download(ctx, msg.ImageMessage)
+		return msg.ImageMessage, nil
 	case msg.VideoMessage != nil:
-		return gows.Download(ctx, msg.VideoMessage)
+		return msg.VideoMessage, nil
 	case msg.AudioMessage != nil:
-		return gows.Download(ctx, msg.AudioMessage)
+		return msg.AudioMessage, nil
 	case msg.DocumentMessage != nil:
-		return gows.Download(ctx, msg.DocumentMessage)
+		return msg.DocumentMessage, nil
 	case msg.DocumentWithCaptionMessage != nil:
-		return gows.Download(ctx, msg.DocumentWithCaptionMessage.Message.DocumentMessage)
+		return msg.DocumentWithCaptionMessage.Message.DocumentMessage, nil
 	case msg.StickerMessage != nil:
-		return gows.Download(ctx, msg.StickerMessage)
+		return msg.StickerMessage, nil
 	default:
 		return nil, whatsmeow.ErrNothingDownloadableFound
 	}
 }
 
+func (gows *GoWS) DownloadAnyMedia(ctx context.Context, msg *waE2E.Message) (data []byte, err error) {
+	content, err := downloadable(msg)
+	if err != nil {
+		return nil, err
+	}
+	return gows.Download(ctx, content)
+}
+
+// DownloadAnyMediaToFile downloads the media of the message into the file, without holding it in memory
+func (gows *GoWS) DownloadAnyMediaToFile(ctx context.Context, msg *waE2E.Message, file whatsmeow.File) error {
+	content, err := downloadable(msg)
+	if err != nil {
+		return err
+	}
+	return gows.DownloadToFile(ctx, content, file)
+}
+
 func (gows *GoWS) UploadMedia(
 	ctx context.Context,
 	jid types.JID,
 	content []byte,
 	mediaType whatsmeow.MediaType,
 ) (resp whatsmeow.UploadResponse, err error) {
+	ctx, span := tracing.Start(ctx, "gows.UploadMedia",
+		attribute.String("media.type", string(mediaType)),
+		attribute.Int("media.size", len(content)),
+	)
+	defer func() { tracing.End(span, err) }()
 	if IsNewsletter(jid) {
 		resp, err = gows.UploadNewsletter(ctx, content, mediaType)
 	} else {
@@ -47,12 +73,37 @@ func (gows *GoWS) UploadMedia(
 	return resp, err
 }
 
+// UploadMediaReader uploads the media from the reader, without holding it in memory
+func (gows *GoWS) UploadMediaReader(
+	ctx context.Context,
+	jid types.JID,
+	content io.ReadSeeker,
+	size int64,
+	mediaType whatsmeow.MediaType,
+) (resp whatsmeow.UploadResponse, err error) {
+	ctx, span := tracing.Start(ctx, "gows.UploadMedia",
+		attribute.String("media.type", string(mediaType)),
+		attribute.Int64("media.size", size),
+	)
+	defer func() { tracing.End(span, err) }()
+	if IsNewsletter(jid) {
+		resp, err = gows.UploadNewsletterReader(ctx, content, mediaType)
+	} else {
+		// The encrypted copy goes to a temporary file
+		resp, err = gows.UploadReader(ctx, content, nil, mediaType)
+	}
+	return resp, err
+}
+
 // AddLinkPreviewSafe adds a link preview to the message if a link is found in the text.
 // logs an error if the preview cannot be fetched.
-func (gows *GoWS) AddLinkPreviewSafe(jid types.JID, message *waE2E.ExtendedTextMessage, highQuality bool, preview *media.LinkPreview) {
-	linkPreviewCtx, cancel := context.WithTimeout(gows.Context, FetchPreviewTimeout)
+func (gows *GoWS) AddLinkPreviewSafe(ctx context.Context, jid types.JID, message *waE2E.ExtendedTextMessage, highQuality bool, preview *media.LinkPreview) {
+	ctx, span := tracing.Start(ctx, "gows.AddLinkPreview", attribute.Bool("preview.high_quality", highQuality))
+	// The preview is bound to the session, not the request, but stays in the request trace
+	linkPreviewCtx, cancel := context.WithTimeout(tracing.WithSpanOf(gows.Context, ctx), FetchPreviewTimeout)
 	defer cancel()
 	err := gows.AddLinkPreviewWithContext(linkPreviewCtx, jid, message, highQuality, preview)
+	tracing.End(span, err)
 	if err != nil {
 		gows.Log.Warnf("Failed to add link preview: %v", err)
 	}
@@ -128,7 +179,7 @@ func (gows *GoWS) AddLinkPreviewWithContext(
 		if err != nil {
 			return fmt.Errorf("failed to generate thumbnail: %w", err)
 		}
-		resp, err := gows.UploadMedia(gows.Context, jid, image, whatsmeow.MediaLinkThumbnail)
+		resp, err := gows.UploadMedia(tracing.WithSpanOf(gows.Context, ctx), jid, image, whatsmeow.MediaLinkThumbnail)
 		if err != nil {
 			return fmt.Errorf("failed to upload image (%s): %w", preview.ImageUrl, err)
 		}
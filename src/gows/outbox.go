@@ -0,0 +1,292 @@
+package gows
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/devlikeapro/gows/storage"
+	"github.com/google/uuid"
+	"go.mau.fi/whatsmeow/types"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+const (
+	DefaultOutboxRetries    = 10
+	DefaultOutboxRetryDelay = 5 * time.Second
+	// outboxMaxRetryDelay - the retry delay never grows above it
+	outboxMaxRetryDelay = 10 * time.Minute
+	// outboxPollInterval - how often the outbox is checked for due messages
+	outboxPollInterval = time.Second
+	outboxPollBatch    = 100
+)
+
+// OutboxStopTimeout - how long stop waits for the message being sent before interrupting it.
+// An interrupted message may have been sent already, it's sent again after restart.
+var OutboxStopTimeout = 10 * time.Second
+
+var (
+	// ErrOutboxDisabled - the session has been built without OutboxSender
+	ErrOutboxDisabled = errors.New("outbox is not available for the session")
+	// ErrQueuedMessageSending - the message can't be canceled, it's being sent right now
+	ErrQueuedMessageSending = errors.New("queued message is being sent")
+	// ErrPermanentSend marks send errors that fail the same way on retry (invalid request, etc.),
+	// the message is dropped from the outbox right away
+	ErrPermanentSend = errors.New("permanent send error")
+)
+
+// OutboxSender sends the queued request, returns the ID of the sent message.
+// Errors wrapping ErrPermanentSend are not retried.
+type OutboxSender func(ctx context.Context, gows *GoWS, msg *storage.QueuedMessage) (string, error)
+
+type OutboxStatus string
+
+const (
+	OutboxQueued   OutboxStatus = "QUEUED"
+	OutboxSent     OutboxStatus = "SENT"
+	OutboxRetry    OutboxStatus = "RETRY"
+	OutboxFailed   OutboxStatus = "FAILED"
+	OutboxCanceled OutboxStatus = "CANCELED"
+)
+
+// OutboxEvent is emitted every time a queued message changes its state
+type OutboxEvent struct {
+	ID     string
+	Jid    types.JID
+	Status OutboxStatus
+	// SendAt - when the message is going to be sent (QUEUED, RETRY)
+	SendAt   time.Time
+	Attempts int
+	// Error - the failure of the last attempt (RETRY, FAILED)
+	Error string
+	// MessageID - the ID of the sent message (SENT)
+	MessageID string
+}
+
+func (e *OutboxEvent) EventName() string {
+	return "outbox.message"
+}
+
+func outboxRetryDelay(attempt int) time.Duration {
+	delay := DefaultOutboxRetryDelay
+	for i := 1; i < attempt && delay < outboxMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, outboxMaxRetryDelay)
+}
+
+// outbox sends queued messages of the session when they're due and the session is connected.
+// Messages are kept in the session database, so they survive restarts, and sent one by one in SendAt order.
+type outbox struct {
+	log   waLog.Logger
+	gows  *GoWS
+	store storage.Outbox
+	send  OutboxSender
+	// wake checks the outbox right away, e.g. after a message is queued
+	wake chan struct{}
+
+	// ctx is cancelled when the outbox is stopping, no more messages are sent
+	ctx    context.Context
+	cancel context.CancelFunc
+	// sendCtx is cancelled when the message being sent doesn't finish in OutboxStopTimeout
+	sendCtx    context.Context
+	sendCancel context.CancelFunc
+	workers    sync.WaitGroup
+
+	lock sync.Mutex
+	// sending - the message being sent, it can't be canceled
+	sending string
+}
+
+func newOutbox(log waLog.Logger, gows *GoWS, send OutboxSender) *outbox {
+	ctx, cancel := context.WithCancel(context.Background())
+	sendCtx, sendCancel := context.WithCancel(context.Background())
+	return &outbox{
+		log:        log,
+		gows:       gows,
+		store:      gows.Storage.Outbox,
+		send:       send,
+		wake:       make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+		sendCtx:    sendCtx,
+		sendCancel: sendCancel,
+	}
+}
+
+func (o *outbox) start() {
+	o.workers.Add(1)
+	go o.run()
+}
+
+// stop stops sending messages and waits for the worker.
+// The message being sent is let finish, so it's not sent again after restart -
+// it's interrupted only if it takes longer than OutboxStopTimeout.
+func (o *outbox) stop() {
+	o.cancel()
+	defer o.sendCancel()
+	stopped := make(chan struct{})
+	go func() {
+		o.workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(OutboxStopTimeout):
+		o.log.Warnf("Queued message is still being sent after %v, interrupting it", OutboxStopTimeout)
+		o.sendCancel()
+		<-stopped
+	}
+}
+
+func (o *outbox) run() {
+	defer o.workers.Done()
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-o.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+		o.sendDue()
+	}
+}
+
+func (o *outbox) connected() bool {
+	return o.ctx.Err() == nil && o.gows.GetState().Status == StatusWorking
+}
+
+func (o *outbox) sendDue() {
+	if !o.connected() {
+		return
+	}
+	messages, err := o.store.Due(time.Now(), outboxPollBatch)
+	if err != nil {
+		o.log.Errorf("Failed to read outbox: %v", err)
+		return
+	}
+	for _, msg := range messages {
+		if !o.connected() {
+			return
+		}
+		o.setSending(msg.ID)
+		// It could have been canceled after Due
+		_, err = o.store.Get(msg.ID)
+		if err == nil {
+			o.deliver(msg)
+		} else if !errors.Is(err, storage.ErrNotFound) {
+			o.log.Errorf("Failed to read outbox: %v", err)
+		}
+		o.setSending("")
+	}
+}
+
+func (o *outbox) setSending(id string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.sending = id
+}
+
+func (o *outbox) deliver(msg *storage.QueuedMessage) {
+	jid, _ := types.ParseJID(msg.Jid)
+	id, err := o.send(o.sendCtx, o.gows, msg)
+	if err == nil {
+		err = o.store.Delete(msg.ID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			o.log.Errorf("Failed to remove sent message %s from outbox: %v", msg.ID, err)
+		}
+		o.gows.emitEvent(&OutboxEvent{ID: msg.ID, Jid: jid, Status: OutboxSent, Attempts: msg.Attempts + 1, MessageID: id})
+		return
+	}
+	if o.sendCtx.Err() != nil {
+		// Interrupted by stop, not the send failure
+		return
+	}
+
+	msg.Attempts++
+	msg.LastError = err.Error()
+	if errors.Is(err, ErrPermanentSend) || msg.Attempts > DefaultOutboxRetries {
+		o.log.Errorf("Queued message %s to %s failed after %d attempt(s), giving up: %s", msg.ID, msg.Jid, msg.Attempts, msg.LastError)
+		err = o.store.Delete(msg.ID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			o.log.Errorf("Failed to remove message %s from outbox: %v", msg.ID, err)
+		}
+		o.gows.emitEvent(&OutboxEvent{ID: msg.ID, Jid: jid, Status: OutboxFailed, Attempts: msg.Attempts, Error: msg.LastError})
+		return
+	}
+	o.log.Warnf("Queued message %s to %s failed, attempt %d: %s", msg.ID, msg.Jid, msg.Attempts, msg.LastError)
+	next := time.Now().UTC().Add(outboxRetryDelay(msg.Attempts))
+	err = o.store.Reschedule(msg.ID, msg.Attempts, next, msg.LastError)
+	if err != nil {
+		o.log.Errorf("Failed to reschedule message %s in outbox: %v", msg.ID, err)
+	}
+	o.gows.emitEvent(&OutboxEvent{ID: msg.ID, Jid: jid, Status: OutboxRetry, SendAt: next, Attempts: msg.Attempts, Error: msg.LastError})
+}
+
+func (o *outbox) enqueue(jid types.JID, request string, sendAt time.Time) (*storage.QueuedMessage, error) {
+	now := time.Now().UTC()
+	if sendAt.IsZero() || sendAt.Before(now) {
+		sendAt = now
+	}
+	msg := &storage.QueuedMessage{
+		ID:        uuid.New().String(),
+		Jid:       jid.String(),
+		Request:   request,
+		SendAt:    sendAt.UTC(),
+		CreatedAt: now,
+	}
+	err := o.store.Enqueue(msg)
+	if err != nil {
+		return nil, err
+	}
+	o.gows.emitEvent(&OutboxEvent{ID: msg.ID, Jid: jid, Status: OutboxQueued, SendAt: msg.SendAt})
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return msg, nil
+}
+
+func (o *outbox) cancelMessage(id string) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.sending == id {
+		return ErrQueuedMessageSending
+	}
+	msg, err := o.store.Get(id)
+	if err != nil {
+		return err
+	}
+	err = o.store.Delete(id)
+	if err != nil {
+		return err
+	}
+	jid, _ := types.ParseJID(msg.Jid)
+	o.gows.emitEvent(&OutboxEvent{ID: msg.ID, Jid: jid, Status: OutboxCanceled, Attempts: msg.Attempts})
+	return nil
+}
+
+// EnqueueMessage puts the send request into the outbox, it's sent at sendAt (right away if empty)
+// once the session is connected
+func (gows *GoWS) EnqueueMessage(jid types.JID, request string, sendAt time.Time) (*storage.QueuedMessage, error) {
+	if gows.outbox == nil {
+		return nil, ErrOutboxDisabled
+	}
+	return gows.outbox.enqueue(jid, request, sendAt)
+}
+
+// QueuedMessages returns messages waiting in the outbox, the earliest first
+func (gows *GoWS) QueuedMessages(pagination storage.Pagination) ([]*storage.QueuedMessage, error) {
+	return gows.Storage.Outbox.List(pagination)
+}
+
+// CancelQueuedMessage removes the message from the outbox, storage.ErrNotFound if it's not there
+func (gows *GoWS) CancelQueuedMessage(id string) error {
+	if gows.outbox == nil {
+		return ErrOutboxDisabled
+	}
+	return gows.outbox.cancelMessage(id)
+}
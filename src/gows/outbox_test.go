@@ -0,0 +1,125 @@
+package gows
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/devlikeapro/gows/storage"
+	"github.com/devlikeapro/gows/storage/sqlstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mau.fi/whatsmeow/types"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+func TestOutbox(t *testing.T) {
+	address := "file:" + filepath.Join(t.TempDir(), "outbox.db") + "?_foreign_keys=on"
+	container, err := sqlstorage.New("sqlite3", address, waLog.Noop)
+	require.NoError(t, err)
+	defer func() { _ = container.Close() }()
+	gows := &GoWS{
+		Context: context.Background(),
+		Storage: &storage.Storage{Outbox: container.NewOutbox()},
+		events:  make(chan interface{}, 10),
+		state:   newStateMachine(),
+	}
+	var sendErr error
+	o := newOutbox(waLog.Noop, gows, func(ctx context.Context, gows *GoWS, msg *storage.QueuedMessage) (string, error) {
+		return "sent-" + msg.Request, sendErr
+	})
+	event := func() *OutboxEvent {
+		select {
+		case evt := <-gows.events:
+			return evt.(*OutboxEvent)
+		default:
+			return nil
+		}
+	}
+	jid := types.NewJID("123", types.DefaultUserServer)
+
+	now, err := o.enqueue(jid, "now", time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, OutboxQueued, event().Status)
+	later, err := o.enqueue(jid, "later", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, OutboxQueued, event().Status)
+
+	// Not connected - nothing is sent
+	o.sendDue()
+	assert.Nil(t, event())
+
+	// Only due messages are sent
+	gows.state.set(StatusWorking, nil)
+	o.sendDue()
+	sent := event()
+	assert.Equal(t, &OutboxEvent{ID: now.ID, Jid: jid, Status: OutboxSent, Attempts: 1, MessageID: "sent-now"}, sent)
+	queued, err := gows.QueuedMessages(storage.Pagination{})
+	require.NoError(t, err)
+	require.Len(t, queued, 1)
+	assert.Equal(t, later.ID, queued[0].ID)
+
+	// Transient errors are retried later, permanent ones are not
+	retry, err := o.enqueue(jid, "retry", time.Time{})
+	require.NoError(t, err)
+	event()
+	sendErr = errors.New("timeout")
+	o.sendDue()
+	failed := event()
+	assert.Equal(t, OutboxRetry, failed.Status)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.True(t, failed.SendAt.After(time.Now()))
+	stored, err := o.store.Get(retry.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "timeout", stored.LastError)
+
+	require.NoError(t, o.store.Reschedule(retry.ID, 1, time.Now(), "timeout"))
+	sendErr = fmt.Errorf("%w: invalid jid", ErrPermanentSend)
+	o.sendDue()
+	failed = event()
+	assert.Equal(t, OutboxFailed, failed.Status)
+	assert.Equal(t, 2, failed.Attempts)
+	_, err = o.store.Get(retry.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// Canceled messages are removed
+	require.NoError(t, o.cancelMessage(later.ID))
+	assert.Equal(t, OutboxCanceled, event().Status)
+	assert.ErrorIs(t, o.cancelMessage(later.ID), storage.ErrNotFound)
+}
+
+func TestOutboxStopLetsSendFinish(t *testing.T) {
+	address := "file:" + filepath.Join(t.TempDir(), "outbox.db") + "?_foreign_keys=on"
+	container, err := sqlstorage.New("sqlite3", address, waLog.Noop)
+	require.NoError(t, err)
+	defer func() { _ = container.Close() }()
+	gows := &GoWS{
+		Context: context.Background(),
+		Storage: &storage.Storage{Outbox: container.NewOutbox()},
+		events:  make(chan interface{}, 10),
+		state:   newStateMachine(),
+	}
+	gows.state.set(StatusWorking, nil)
+	sending := make(chan struct{})
+	o := newOutbox(waLog.Noop, gows, func(ctx context.Context, gows *GoWS, msg *storage.QueuedMessage) (string, error) {
+		close(sending)
+		select {
+		case <-time.After(50 * time.Millisecond):
+			return "sent", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	})
+	msg, err := o.enqueue(types.NewJID("123", types.DefaultUserServer), "request", time.Time{})
+	require.NoError(t, err)
+	o.start()
+	<-sending
+
+	// The message on the wire is recorded as sent, it's not sent again after restart
+	o.stop()
+	_, err = o.store.Get(msg.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
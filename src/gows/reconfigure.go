@@ -0,0 +1,32 @@
+package gows
+
+import (
+	gowsLog "github.com/devlikeapro/gows/log"
+)
+
+// SetLogLevel changes the session log level (including whatsmeow client logs) without restarting it
+func (gows *GoWS) SetLogLevel(level string) error {
+	return gowsLog.SetLevel(gows.Log, level)
+}
+
+// SetIgnoreJids replaces the ignore rules for the storage, applied to the next events
+func (gows *GoWS) SetIgnoreJids(ignoreJids *IgnoreJidsConfig) {
+	gows.storageEventHandler.SetIgnoreJids(ignoreJids)
+}
+
+// Reconnect drops the websocket and connects again, so connection settings (like proxy) are applied.
+// Does nothing if the session is not connected - settings are applied on the next connect anyway.
+// Returns true if the session has been reconnected.
+func (gows *GoWS) Reconnect() (bool, error) {
+	if !gows.IsConnected() {
+		return false, nil
+	}
+	gows.Log.Infof("Reconnecting to apply the new settings...")
+	gows.Disconnect()
+	err := gows.Connect()
+	if err != nil {
+		gows.fail(err)
+		return true, err
+	}
+	return true, nil
+}
@@ -0,0 +1,105 @@
+package gows
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// SessionRegistry durably records the config of every started session in a JSON file,
+// so the sessions can be brought back after the server restarts.
+type SessionRegistry struct {
+	path string
+	lock sync.Mutex
+}
+
+func NewSessionRegistry(path string) *SessionRegistry {
+	return &SessionRegistry{path: path}
+}
+
+// Load returns all sessions recorded in the registry.
+// A missing registry file is not an error - it means there's nothing to restore.
+func (r *SessionRegistry) Load() (map[string]SessionConfig, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.unlockedLoad()
+}
+
+// Save records (or replaces) the config for the session
+func (r *SessionRegistry) Save(name string, cfg SessionConfig) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	sessions, err := r.unlockedLoad()
+	if err != nil {
+		return err
+	}
+	sessions[name] = cfg
+	return r.unlockedWrite(sessions)
+}
+
+// Remove forgets the session, it won't be restored anymore
+func (r *SessionRegistry) Remove(name string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	sessions, err := r.unlockedLoad()
+	if err != nil {
+		return err
+	}
+	if _, ok := sessions[name]; !ok {
+		return nil
+	}
+	delete(sessions, name)
+	return r.unlockedWrite(sessions)
+}
+
+func (r *SessionRegistry) unlockedLoad() (map[string]SessionConfig, error) {
+	sessions := make(map[string]SessionConfig)
+	data, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return sessions, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sessions registry: %w", err)
+	}
+	if len(data) == 0 {
+		return sessions, nil
+	}
+	err = json.Unmarshal(data, &sessions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sessions registry: %w", err)
+	}
+	return sessions, nil
+}
+
+func (r *SessionRegistry) unlockedWrite(sessions map[string]SessionConfig) error {
+	data, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temp file and rename it, so a crash never leaves a half-written registry
+	// The file keeps database addresses and proxy credentials - only the owner can read it
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write sessions registry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write sessions registry: %w", err)
+	}
+	err = os.Rename(tmp.Name(), r.path)
+	if err != nil {
+		return fmt.Errorf("failed to write sessions registry: %w", err)
+	}
+	return nil
+}
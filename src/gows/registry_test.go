@@ -0,0 +1,37 @@
+package gows
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionRegistry(t *testing.T) {
+	registry := NewSessionRegistry(filepath.Join(t.TempDir(), "sessions.json"))
+
+	// Missing file - nothing to restore
+	sessions, err := registry.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	cfg := SessionConfig{
+		Store:  StoreConfig{Dialect: "sqlite3", Address: "file:default.db"},
+		Log:    LogConfig{Level: "INFO"},
+		Proxy:  ProxyConfig{Url: "socks5://localhost:1080"},
+		Ignore: &IgnoreJidsConfig{Status: true, Groups: true},
+	}
+	assert.NoError(t, registry.Save("default", cfg))
+	assert.NoError(t, registry.Save("second", SessionConfig{Store: StoreConfig{Dialect: "postgres"}}))
+
+	sessions, err = registry.Load()
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+	assert.Equal(t, cfg, sessions["default"])
+
+	assert.NoError(t, registry.Remove("second"))
+	assert.NoError(t, registry.Remove("not-exists"))
+	sessions, err = registry.Load()
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+	assert.Contains(t, sessions, "default")
+}
@@ -0,0 +1,277 @@
+package gows
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+const (
+	DefaultTypingPerChar = 50 * time.Millisecond
+	DefaultTypingMax     = 10 * time.Second
+	// sendChatsPruneSize - forget chats not limited by ChatInterval anymore when there are more of them
+	sendChatsPruneSize = 1000
+)
+
+// SendRateConfig paces messages sent by the session, so bulk sending doesn't look like a bot.
+// Zero values disable the limits - messages are sent right away.
+type SendRateConfig struct {
+	// PerMinute - messages per minute for the whole session, 0 - unlimited
+	PerMinute int
+	// Burst - messages sent without waiting after an idle period, 1 if 0
+	Burst int
+	// ChatInterval - the minimum time between messages to the same chat
+	ChatInterval time.Duration
+	// Jitter - a random delay up to it is added before every message
+	Jitter time.Duration
+	// Typing - send "composing" chat presence before text messages, for TypingPerChar per character
+	Typing bool
+	// TypingPerChar - DefaultTypingPerChar if 0
+	TypingPerChar time.Duration
+	// TypingMax - the longest typing, DefaultTypingMax if 0
+	TypingMax time.Duration
+}
+
+func (c SendRateConfig) Validate() error {
+	if c.PerMinute < 0 || c.Burst < 0 || c.ChatInterval < 0 || c.Jitter < 0 || c.TypingPerChar < 0 || c.TypingMax < 0 {
+		return errors.New("send rate limits can't be negative")
+	}
+	return nil
+}
+
+func (c SendRateConfig) withDefaults() SendRateConfig {
+	if c.Burst <= 0 {
+		c.Burst = 1
+	}
+	if c.TypingPerChar <= 0 {
+		c.TypingPerChar = DefaultTypingPerChar
+	}
+	if c.TypingMax <= 0 {
+		c.TypingMax = DefaultTypingMax
+	}
+	return c
+}
+
+// typingDuration - how long to show "composing" before sending the text
+func (c SendRateConfig) typingDuration(text string) time.Duration {
+	if !c.Typing || text == "" {
+		return 0
+	}
+	typing := time.Duration(utf8.RuneCountInString(text)) * c.TypingPerChar
+	return min(typing, c.TypingMax)
+}
+
+// SendQueue - messages waiting for their turn to be sent
+type SendQueue struct {
+	Pending int
+	// Chats - pending messages per chat
+	Chats map[types.JID]int
+}
+
+// sendGovernor schedules messages of the session according to SendRateConfig.
+// Every message reserves its send time right away, so messages go out in the order they came,
+// a canceled message still counts against the limits.
+type sendGovernor struct {
+	lock   sync.Mutex
+	config SendRateConfig
+	// tokens - messages that can be sent at updated without waiting (token bucket, refilled by PerMinute)
+	tokens  float64
+	updated time.Time
+	// chats - the send time of the last message per chat
+	chats   map[types.JID]time.Time
+	pending map[types.JID]int
+	now     func() time.Time
+}
+
+func newSendGovernor(config SendRateConfig) *sendGovernor {
+	config = config.withDefaults()
+	return &sendGovernor{
+		config:  config,
+		tokens:  float64(config.Burst),
+		chats:   make(map[types.JID]time.Time),
+		pending: make(map[types.JID]int),
+		now:     time.Now,
+	}
+}
+
+func (g *sendGovernor) setConfig(config SendRateConfig) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.config = config.withDefaults()
+	g.tokens = math.Min(g.tokens, float64(g.config.Burst))
+}
+
+// reserve returns the time the message to the chat can be sent at,
+// typing moves it so there's time to show "composing" before it
+func (g *sendGovernor) reserve(chat types.JID, typing time.Duration) time.Time {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	cfg := g.config
+	now := g.now()
+	at := now.Add(typing)
+
+	if cfg.PerMinute > 0 {
+		perSecond := float64(cfg.PerMinute) / 60
+		if !g.updated.IsZero() {
+			g.tokens += now.Sub(g.updated).Seconds() * perSecond
+		}
+		g.tokens = math.Min(g.tokens, float64(cfg.Burst))
+		g.updated = now
+		g.tokens--
+		if g.tokens < 0 {
+			wait := time.Duration(-g.tokens / perSecond * float64(time.Second))
+			at = maxTime(at, now.Add(wait))
+		}
+	}
+	if cfg.ChatInterval > 0 {
+		if last, ok := g.chats[chat]; ok {
+			at = maxTime(at, last.Add(cfg.ChatInterval))
+		}
+	}
+	if cfg.Jitter > 0 {
+		at = at.Add(time.Duration(rand.Int63n(int64(cfg.Jitter))))
+	}
+
+	if cfg.ChatInterval > 0 {
+		if len(g.chats) > sendChatsPruneSize {
+			g.prune(now)
+		}
+		g.chats[chat] = at
+	}
+	g.pending[chat]++
+	return at
+}
+
+// prune forgets chats which can receive a message right away, must be called with the lock held
+func (g *sendGovernor) prune(now time.Time) {
+	for chat, last := range g.chats {
+		if g.pending[chat] == 0 && last.Add(g.config.ChatInterval).Before(now) {
+			delete(g.chats, chat)
+		}
+	}
+}
+
+func (g *sendGovernor) done(chat types.JID) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.pending[chat]--
+	if g.pending[chat] <= 0 {
+		delete(g.pending, chat)
+	}
+}
+
+// wait blocks until the message to the chat can be sent,
+// calls startTyping the typing duration before that
+func (g *sendGovernor) wait(ctx context.Context, chat types.JID, typing time.Duration, startTyping func()) error {
+	at := g.reserve(chat, typing)
+	defer g.done(chat)
+	if typing > 0 {
+		err := sleepUntil(ctx, at.Add(-typing))
+		if err != nil {
+			return err
+		}
+		startTyping()
+	}
+	return sleepUntil(ctx, at)
+}
+
+func (g *sendGovernor) queue() SendQueue {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	queue := SendQueue{Chats: make(map[types.JID]int, len(g.pending))}
+	for chat, pending := range g.pending {
+		queue.Pending += pending
+		queue.Chats[chat] = pending
+	}
+	return queue
+}
+
+// SortedChats - chats of the queue, the most pending first
+func (q SendQueue) SortedChats() []types.JID {
+	chats := make([]types.JID, 0, len(q.Chats))
+	for chat := range q.Chats {
+		chats = append(chats, chat)
+	}
+	sort.Slice(chats, func(i, j int) bool {
+		if q.Chats[chats[i]] != q.Chats[chats[j]] {
+			return q.Chats[chats[i]] > q.Chats[chats[j]]
+		}
+		return chats[i].String() < chats[j].String()
+	})
+	return chats
+}
+
+func sleepUntil(ctx context.Context, at time.Time) error {
+	delay := time.Until(at)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// messageText - the text of the message shown while "typing", empty for media without caption and others
+func messageText(msg *waE2E.Message) string {
+	switch {
+	case msg.GetConversation() != "":
+		return msg.GetConversation()
+	case msg.GetExtendedTextMessage() != nil:
+		return msg.GetExtendedTextMessage().GetText()
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage().GetCaption()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage().GetCaption()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage().GetCaption()
+	}
+	return ""
+}
+
+// SendQueue returns messages waiting for the send rate limits
+func (gows *GoWS) SendQueue() SendQueue {
+	return gows.sendGovernor.queue()
+}
+
+// SetSendRate applies the new limits to the next messages
+func (gows *GoWS) SetSendRate(config SendRateConfig) {
+	gows.sendGovernor.setConfig(config)
+}
+
+// waitSendTurn holds the message according to the send rate limits, shows "composing" in the chat if configured
+func (gows *GoWS) waitSendTurn(ctx context.Context, to types.JID, msg *waE2E.Message) error {
+	g := gows.sendGovernor
+	g.lock.Lock()
+	cfg := g.config
+	g.lock.Unlock()
+	var typing time.Duration
+	if to.Server == types.DefaultUserServer || to.Server == types.HiddenUserServer || to.Server == types.GroupServer {
+		typing = cfg.typingDuration(messageText(msg))
+	}
+	return g.wait(ctx, to, typing, func() {
+		err := gows.SendChatPresence(ctx, to, types.ChatPresenceComposing, types.ChatPresenceMediaText)
+		if err != nil {
+			gows.Log.Warnf("Failed to send typing to %s: %v", to, err)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package gows
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.mau.fi/whatsmeow/types"
+	"testing"
+	"time"
+)
+
+func TestSendGovernorReserve(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	g := newSendGovernor(SendRateConfig{PerMinute: 60, Burst: 2, ChatInterval: 5 * time.Second})
+	g.now = func() time.Time { return now }
+	a := types.NewJID("1", types.DefaultUserServer)
+	b := types.NewJID("2", types.DefaultUserServer)
+
+	// Burst goes right away, then one per second
+	assert.Equal(t, start, g.reserve(a, 0))
+	assert.Equal(t, start, g.reserve(b, 0))
+	assert.Equal(t, start.Add(time.Second), g.reserve(types.NewJID("3", types.DefaultUserServer), 0))
+	// The same chat waits for the interval
+	assert.Equal(t, start.Add(5*time.Second), g.reserve(a, 0))
+	assert.Equal(t, 4, g.queue().Pending)
+	assert.Equal(t, 2, g.queue().Chats[a])
+
+	// The bucket is refilled over time, typing delays the message
+	now = start.Add(time.Minute)
+	assert.Equal(t, now.Add(3*time.Second), g.reserve(b, 3*time.Second))
+
+	g.done(a)
+	g.done(a)
+	assert.NotContains(t, g.queue().Chats, a)
+}
+
+func TestSendRateConfigTypingDuration(t *testing.T) {
+	cfg := SendRateConfig{Typing: true}.withDefaults()
+	assert.Equal(t, 250*time.Millisecond, cfg.typingDuration("hello"))
+	assert.Equal(t, DefaultTypingMax, cfg.typingDuration(string(make([]byte, 1000))))
+	assert.Equal(t, time.Duration(0), cfg.typingDuration(""))
+	assert.Equal(t, time.Duration(0), SendRateConfig{}.withDefaults().typingDuration("hello"))
+}
@@ -0,0 +1,235 @@
+package gows
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// SessionStatus is a step in the session lifecycle
+type SessionStatus string
+
+const (
+	// StatusStarting - the session has been built and is starting
+	StatusStarting SessionStatus = "STARTING"
+	// StatusScanQRCode - not logged in, waiting for the QR code to be scanned
+	StatusScanQRCode SessionStatus = "SCAN_QR_CODE"
+	// StatusPairing - pairing code has been requested, waiting for it to be entered on the phone
+	StatusPairing SessionStatus = "PAIRING"
+	// StatusConnecting - logged in, (re)connecting to WhatsApp
+	StatusConnecting SessionStatus = "CONNECTING"
+	// StatusWorking - connected and ready
+	StatusWorking SessionStatus = "WORKING"
+	// StatusLoggedOut - the device has been unlinked, the session must be paired again
+	StatusLoggedOut SessionStatus = "LOGGED_OUT"
+	// StatusFailed - the session can't continue without intervention, see LastError
+	StatusFailed SessionStatus = "FAILED"
+)
+
+// SessionState is a snapshot of the session lifecycle
+type SessionState struct {
+	Status SessionStatus
+	// LastError - the reason of the last failure, kept until the session gets back to WORKING
+	LastError string
+	// StartedAt - when the session has been started
+	StartedAt time.Time
+	// ChangedAt - when the session moved to the current status
+	ChangedAt time.Time
+}
+
+// NamedEvent lets an event choose the name it's streamed with instead of its Go type name
+type NamedEvent interface {
+	EventName() string
+}
+
+// SessionStatusEvent is emitted every time the session status changes
+type SessionStatusEvent struct {
+	SessionState
+	Previous SessionStatus
+}
+
+func (e *SessionStatusEvent) EventName() string {
+	return "session.status"
+}
+
+// stateMachine keeps the session state in thread-safe way
+type stateMachine struct {
+	state SessionState
+	// pending - the status event not emitted yet, a newer one replaces it
+	pending *SessionStatusEvent
+	// changed - signaled when there's a pending event
+	changed chan struct{}
+	lock    sync.RWMutex
+}
+
+func newStateMachine() *stateMachine {
+	now := time.Now()
+	return &stateMachine{
+		state: SessionState{
+			Status:    StatusStarting,
+			StartedAt: now,
+			ChangedAt: now,
+		},
+		changed: make(chan struct{}, 1),
+	}
+}
+
+func (sm *stateMachine) get() SessionState {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+	return sm.state
+}
+
+// set moves to the status unless the current one is in keep, returns the status event or nil if nothing has changed.
+// The event is kept as pending until it's taken to be emitted.
+func (sm *stateMachine) set(status SessionStatus, err error, keep ...SessionStatus) *SessionStatusEvent {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	if slices.Contains(keep, sm.state.Status) {
+		return nil
+	}
+	lastError := sm.state.LastError
+	switch {
+	case err != nil:
+		lastError = err.Error()
+	case status == StatusWorking:
+		lastError = ""
+	}
+	if sm.state.Status == status && sm.state.LastError == lastError {
+		return nil
+	}
+	previous := sm.state.Status
+	sm.state.Status = status
+	sm.state.LastError = lastError
+	sm.state.ChangedAt = time.Now()
+	sm.pending = &SessionStatusEvent{SessionState: sm.state, Previous: previous}
+	select {
+	case sm.changed <- struct{}{}:
+	default:
+	}
+	return sm.pending
+}
+
+// takePending returns the status event to emit and forgets it, nil if there's none
+func (sm *stateMachine) takePending() *SessionStatusEvent {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	evt := sm.pending
+	sm.pending = nil
+	return evt
+}
+
+// statusFromEvent maps whatsmeow events to the session status and the failure reason.
+// Returns an empty status if the event doesn't affect the session status
+func statusFromEvent(event interface{}) (status SessionStatus, reason error) {
+	switch evt := event.(type) {
+	case *events.Connected:
+		return StatusWorking, nil
+	case *events.PairSuccess:
+		return StatusConnecting, nil
+	case *events.Disconnected:
+		return StatusConnecting, nil
+	case *events.PairError:
+		return StatusFailed, fmt.Errorf("pairing failed: %w", evt.Error)
+	case *events.LoggedOut:
+		return StatusLoggedOut, fmt.Errorf("logged out: %v", evt.Reason)
+	case *events.StreamReplaced:
+		return StatusFailed, errors.New("stream replaced: another client connected with the same session")
+	case *events.TemporaryBan:
+		return StatusFailed, errors.New(evt.String())
+	case *events.ConnectFailure:
+		return StatusFailed, fmt.Errorf("connect failure: %v %s", evt.Reason, evt.Message)
+	case *events.ClientOutdated:
+		return StatusFailed, errors.New("client outdated")
+	case whatsmeow.QRChannelItem:
+		switch evt.Event {
+		case whatsmeow.QRChannelEventCode:
+			return StatusScanQRCode, nil
+		case whatsmeow.QRChannelSuccess.Event:
+			return StatusConnecting, nil
+		case whatsmeow.QRChannelTimeout.Event:
+			return StatusFailed, errors.New("QR code has not been scanned in time")
+		case whatsmeow.QRChannelEventError:
+			return StatusFailed, fmt.Errorf("QR code pairing failed: %w", evt.Error)
+		default:
+			return StatusFailed, fmt.Errorf("QR code pairing failed: %s", evt.Event)
+		}
+	}
+	return "", nil
+}
+
+// GetState returns the current lifecycle state of the session
+func (gows *GoWS) GetState() SessionState {
+	return gows.state.get()
+}
+
+// setStatus moves the session to the status unless it's in one of keep.
+// Never blocks - the status event is emitted by emitStatusEvents.
+func (gows *GoWS) setStatus(status SessionStatus, err error, keep ...SessionStatus) {
+	evt := gows.state.set(status, err, keep...)
+	if evt == nil {
+		return
+	}
+	if err != nil {
+		gows.Log.Warnf("Session status %s -> %s: %v", evt.Previous, status, err)
+	} else {
+		gows.Log.Infof("Session status %s -> %s", evt.Previous, status)
+	}
+}
+
+// emitStatusEvents emits status events until the session is stopped.
+// While the events buffer is full, a newer status replaces the one waiting for room.
+func (gows *GoWS) emitStatusEvents() {
+	var evt *SessionStatusEvent
+	for {
+		gows.eventsLock.RLock()
+		if gows.eventsClosed {
+			gows.eventsLock.RUnlock()
+			return
+		}
+		// nil - nothing to send
+		var events chan interface{}
+		if evt != nil {
+			events = gows.events
+		}
+		select {
+		case <-gows.stopping:
+			gows.eventsLock.RUnlock()
+			return
+		case <-gows.state.changed:
+			if pending := gows.state.takePending(); pending != nil {
+				evt = pending
+			}
+		case events <- evt:
+			evt = nil
+		}
+		gows.eventsLock.RUnlock()
+	}
+}
+
+// updateStatusFromEvent applies the event to the session status,
+// it's called from the event handler in the order whatsmeow emits events
+func (gows *GoWS) updateStatusFromEvent(event interface{}) {
+	status, reason := statusFromEvent(event)
+	if status == "" {
+		return
+	}
+	if _, ok := event.(*events.Disconnected); ok {
+		// Disconnect follows logout and failures too - keep the reason visible
+		gows.setStatus(status, reason, StatusLoggedOut, StatusFailed)
+		return
+	}
+	if status == StatusFailed && isRetriableFailure(event) {
+		gows.fail(reason)
+		return
+	}
+	if status == StatusWorking && gows.supervisor != nil {
+		gows.supervisor.connected()
+	}
+	gows.setStatus(status, reason)
+}
@@ -0,0 +1,141 @@
+package gows
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+func TestStatusFromEvent(t *testing.T) {
+	cases := []struct {
+		name   string
+		event  interface{}
+		status SessionStatus
+		reason bool
+	}{
+		{"connected", &events.Connected{}, StatusWorking, false},
+		{"pair success", &events.PairSuccess{}, StatusConnecting, false},
+		{"disconnected", &events.Disconnected{}, StatusConnecting, false},
+		{"pair error", &events.PairError{Error: errors.New("bad")}, StatusFailed, true},
+		{"logged out", &events.LoggedOut{}, StatusLoggedOut, true},
+		{"stream replaced", &events.StreamReplaced{}, StatusFailed, true},
+		{"temporary ban", &events.TemporaryBan{}, StatusFailed, true},
+		{"connect failure", &events.ConnectFailure{}, StatusFailed, true},
+		{"client outdated", &events.ClientOutdated{}, StatusFailed, true},
+		{"qr code", whatsmeow.QRChannelItem{Event: whatsmeow.QRChannelEventCode}, StatusScanQRCode, false},
+		{"qr success", whatsmeow.QRChannelSuccess, StatusConnecting, false},
+		{"qr timeout", whatsmeow.QRChannelTimeout, StatusFailed, true},
+		{"qr error", whatsmeow.QRChannelItem{Event: whatsmeow.QRChannelEventError, Error: errors.New("bad")}, StatusFailed, true},
+		{"message", &events.Message{}, "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status, reason := statusFromEvent(c.event)
+			assert.Equal(t, c.status, status)
+			assert.Equal(t, c.reason, reason != nil, "reason: %v", reason)
+		})
+	}
+}
+
+func TestStateMachineSet(t *testing.T) {
+	sm := newStateMachine()
+	assert.Equal(t, StatusStarting, sm.get().Status)
+
+	evt := sm.set(StatusConnecting, nil)
+	require.NotNil(t, evt)
+	assert.Equal(t, StatusStarting, evt.Previous)
+	assert.Equal(t, StatusConnecting, evt.Status)
+	// Nothing has changed
+	assert.Nil(t, sm.set(StatusConnecting, nil))
+
+	// The error changes the state even with the same status
+	evt = sm.set(StatusConnecting, errors.New("connect failure"))
+	require.NotNil(t, evt)
+	assert.Equal(t, "connect failure", evt.LastError)
+	// The last error stays visible until the session works
+	evt = sm.set(StatusScanQRCode, nil)
+	require.NotNil(t, evt)
+	assert.Equal(t, "connect failure", evt.LastError)
+	evt = sm.set(StatusWorking, nil)
+	require.NotNil(t, evt)
+	assert.Empty(t, evt.LastError)
+
+	// Kept statuses are not left
+	sm.set(StatusLoggedOut, errors.New("logged out"))
+	assert.Nil(t, sm.set(StatusConnecting, nil, StatusLoggedOut, StatusFailed))
+	assert.Equal(t, StatusLoggedOut, sm.get().Status)
+}
+
+func TestUpdateStatusFromEvent(t *testing.T) {
+	gows := &GoWS{
+		Client:  &whatsmeow.Client{Log: waLog.Noop},
+		Context: context.Background(),
+		events:  make(chan interface{}, 10),
+		state:   newStateMachine(),
+	}
+	status := func() SessionStatus {
+		evt := gows.state.takePending()
+		if evt == nil {
+			return ""
+		}
+		return evt.Status
+	}
+
+	gows.updateStatusFromEvent(&events.Connected{})
+	assert.Equal(t, StatusWorking, status())
+	gows.updateStatusFromEvent(&events.Message{})
+	assert.Empty(t, status())
+	gows.updateStatusFromEvent(&events.Disconnected{})
+	assert.Equal(t, StatusConnecting, status())
+
+	// Disconnect after logout keeps the reason visible
+	gows.updateStatusFromEvent(&events.LoggedOut{})
+	gows.updateStatusFromEvent(&events.Disconnected{})
+	assert.Equal(t, StatusLoggedOut, status())
+	assert.Equal(t, StatusLoggedOut, gows.GetState().Status)
+
+	// Not supervised - retriable failures fail the session too
+	gows.updateStatusFromEvent(&events.ConnectFailure{})
+	assert.Equal(t, StatusFailed, status())
+}
+
+func TestStatusEventsDontBlock(t *testing.T) {
+	gows := &GoWS{
+		Client:   &whatsmeow.Client{Log: waLog.Noop},
+		Context:  context.Background(),
+		events:   make(chan interface{}, 1),
+		state:    newStateMachine(),
+		stopping: make(chan struct{}),
+	}
+	defer close(gows.stopping)
+	go gows.emitStatusEvents()
+	// The buffer is full - status changes don't wait for it
+	gows.events <- "full"
+	gows.updateStatusFromEvent(&events.Connected{})
+	gows.updateStatusFromEvent(&events.Disconnected{})
+	gows.updateStatusFromEvent(&events.Connected{})
+	assert.Equal(t, StatusWorking, gows.GetState().Status)
+	assert.Eventually(t, func() bool {
+		gows.state.lock.RLock()
+		defer gows.state.lock.RUnlock()
+		return gows.state.pending == nil
+	}, time.Second, time.Millisecond)
+
+	// Only the latest status is emitted once there's room
+	assert.Equal(t, "full", <-gows.events)
+	evt := (<-gows.events).(*SessionStatusEvent)
+	assert.Equal(t, StatusWorking, evt.Status)
+	assert.Equal(t, StatusConnecting, evt.Previous)
+	select {
+	case evt := <-gows.events:
+		t.Fatalf("unexpected event %v", evt)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
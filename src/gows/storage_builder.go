@@ -18,5 +18,9 @@ func BuildStorage(container *sqlstorage.GContainer, gows *GoWS) *storage.Storage
 	st.Labels = container.NewLabelStorage()
 	st.LabelAssociations = container.NewLabelAssociationStorage()
 	st.Lidmap = container.NewLidmapStorage()
+	st.Events = container.NewEventJournal(gows.Log)
+	st.Webhooks = container.NewWebhookQueue()
+	st.IdempotencyKeys = container.NewIdempotencyKeyStorage()
+	st.Outbox = container.NewOutbox()
 	return st
 }
@@ -3,9 +3,13 @@ package gows
 import (
 	"errors"
 	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/avast/retry-go"
+	gowsLog "github.com/devlikeapro/gows/log"
+	"github.com/devlikeapro/gows/metrics"
 	"github.com/devlikeapro/gows/storage"
 	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/proto/waHistorySync"
@@ -21,7 +25,60 @@ type StorageEventHandler struct {
 	log     waLog.Logger
 	storage *storage.Storage
 	// ignoreJids specifies which types of JIDs should be ignored when processing events.
-	ignoreJids *IgnoreJidsConfig
+	// Can be replaced while the session is running, see SetIgnoreJids
+	ignoreJids atomic.Pointer[IgnoreJidsConfig]
+
+	// inflight tracks writes running in background, so we can flush them before closing the database
+	inflight     sync.WaitGroup
+	inflightLock sync.RWMutex
+	stopped      bool
+}
+
+// goTracked runs fn in background as an in-flight write.
+// Nothing runs after the handler has been flushed - the database is about to be closed.
+func (st *StorageEventHandler) goTracked(fn func()) {
+	st.inflightLock.RLock()
+	defer st.inflightLock.RUnlock()
+	if st.stopped {
+		st.log.Debugf("Storage is stopped, skipping write")
+		return
+	}
+	st.inflight.Add(1)
+	go func() {
+		defer st.inflight.Done()
+		fn()
+	}()
+}
+
+func (st *StorageEventHandler) handleEventAsync(event interface{}) {
+	st.goTracked(func() {
+		st.handleEvent(event)
+	})
+}
+
+// flush stops accepting new writes and waits for in-flight ones to finish.
+// Returns false if writes are still running after the timeout.
+func (st *StorageEventHandler) flush(timeout time.Duration) bool {
+	st.inflightLock.Lock()
+	st.stopped = true
+	st.inflightLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		st.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// SetIgnoreJids replaces the ignore rules, nil disables them
+func (st *StorageEventHandler) SetIgnoreJids(ignoreJids *IgnoreJidsConfig) {
+	st.ignoreJids.Store(ignoreJids)
 }
 
 func (st *StorageEventHandler) shouldIgnoreJID(jid types.JID) bool {
@@ -29,7 +86,8 @@ func (st *StorageEventHandler) shouldIgnoreJID(jid types.JID) bool {
 		return false
 	}
 
-	if st.ignoreJids == nil {
+	ignoreJids := st.ignoreJids.Load()
+	if ignoreJids == nil {
 		return false
 	}
 
@@ -39,13 +97,13 @@ func (st *StorageEventHandler) shouldIgnoreJID(jid types.JID) bool {
 		// Do not filter status@broadcast when broadcast-ignore is enabled:
 		// it is controlled by the dedicated Status flag.
 		if jid.User == "status" {
-			return st.ignoreJids.Status
+			return ignoreJids.Status
 		}
-		return st.ignoreJids.Broadcast
+		return ignoreJids.Broadcast
 	case types.GroupServer:
-		return st.ignoreJids.Groups
+		return ignoreJids.Groups
 	case types.NewsletterServer:
-		return st.ignoreJids.Newsletters
+		return ignoreJids.Newsletters
 	default:
 		return false
 	}
@@ -188,7 +246,8 @@ func (st *StorageEventHandler) handleSaveMessage(event *events.Message, status *
 
 	err := st.storage.Messages.UpsertOneMessage(messageToStore)
 	if err != nil {
-		st.log.Errorf("Error storing message %v(%v): %v", event.Info.Chat, event.Info.ID, err)
+		log := gowsLog.WithMessage(st.log, event.Info.Chat.String(), event.Info.ID)
+		log.Errorf("Error storing message %v(%v): %v", event.Info.Chat, event.Info.ID, err)
 	}
 }
 
@@ -248,14 +307,15 @@ func (st *StorageEventHandler) handleReceipt(event *events.Receipt) {
 		st.log.Debugf("Ignoring receipt for '%v(%v)'", event.Chat, event.MessageIDs)
 	}
 	for _, id := range event.MessageIDs {
-		st.log.Debugf("Updating status for message %v(%v) to %v (receipt type: '%v')", event.Chat, id, status, event.Type.GoString())
+		log := gowsLog.WithMessage(st.log, event.Chat.String(), id)
+		log.Debugf("Updating status for message %v(%v) to %v (receipt type: '%v')", event.Chat, id, status, event.Type.GoString())
 		msg, err := st.storage.Messages.GetMessage(id)
 		if errors.Is(err, storage.ErrNotFound) {
-			st.log.Debugf("Message %v(%v) not found", event.Chat, id)
+			log.Debugf("Message %v(%v) not found", event.Chat, id)
 			continue
 		}
 		if err != nil {
-			st.log.Debugf("Error getting message - storage handle receipt %v(%v): %v", event.Chat, id, err)
+			log.Debugf("Error getting message - storage handle receipt %v(%v): %v", event.Chat, id, err)
 			continue
 		}
 		if msg.Status != nil && *msg.Status >= status {
@@ -264,15 +324,19 @@ func (st *StorageEventHandler) handleReceipt(event *events.Receipt) {
 		msg.Status = &status
 		err = st.storage.Messages.UpsertOneMessage(msg)
 		if err != nil {
-			st.log.Errorf("Error updating status for message %v(%v): %v", event.Chat, id, err)
+			log.Errorf("Error updating status for message %v(%v): %v", event.Chat, id, err)
 			continue
 		}
-		st.log.Debugf("Updated status for message %v(%v) to %v", event.Chat, id, status)
+		log.Debugf("Updated status for message %v(%v) to %v", event.Chat, id, status)
 	}
 }
 
 func (st *StorageEventHandler) handleHistorySync(event *events.HistorySync) {
+	session := st.gows.Name()
+	metrics.HistorySyncProgress.WithLabelValues(session, event.Data.GetSyncType().String()).Set(float64(event.Data.GetProgress()))
+	metrics.HistorySyncConversations.WithLabelValues(session).Add(float64(len(event.Data.Conversations)))
 	for _, conv := range event.Data.Conversations {
+		metrics.HistorySyncMessages.WithLabelValues(session).Add(float64(len(conv.GetMessages())))
 		jid, err := types.ParseJID(conv.GetID())
 		if err != nil {
 			st.log.Errorf("Error parsing JID: %v", err)
@@ -284,7 +348,9 @@ func (st *StorageEventHandler) handleHistorySync(event *events.HistorySync) {
 			continue
 		}
 
-		go st.saveHistoryForOneChat(conv, jid)
+		st.goTracked(func() {
+			st.saveHistoryForOneChat(conv, jid)
+		})
 	}
 	st.log.Debugf("Saved history for %v chats", len(event.Data.Conversations))
 }
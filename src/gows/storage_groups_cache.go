@@ -1,8 +1,10 @@
 package gows
 
 import (
+	"context"
 	"github.com/devlikeapro/gows/storage"
 	"github.com/devlikeapro/gows/storage/helpers"
+	"github.com/devlikeapro/gows/tracing"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 	waLog "go.mau.fi/whatsmeow/util/log"
@@ -38,20 +40,20 @@ func (g *GroupCacheStorage) shouldRefresh() bool {
 	return time.Since(g.lastTimeRefreshed) > refreshInterval
 }
 
-func (g *GroupCacheStorage) FetchGroups(force bool) error {
+func (g *GroupCacheStorage) FetchGroups(ctx context.Context, force bool) error {
 	if force {
 		g.lock.Lock()
 		defer g.lock.Unlock()
-		return g.fetchGroupsUnlocked()
+		return g.fetchGroupsUnlocked(ctx)
 	}
-	_, err := g.fetchGroupsIfNeeded(true)
+	_, err := g.fetchGroupsIfNeeded(ctx, true)
 	return err
 }
 
 func (g *GroupCacheStorage) UpdateGroup(update *events.GroupInfo) (err error) {
 	g.lock.Lock()
 	defer g.lock.Unlock()
-	refreshed, err := g.fetchGroupsIfNeeded(false)
+	refreshed, err := g.fetchGroupsIfNeeded(context.Background(), false)
 	if err != nil {
 		return err
 	}
@@ -59,7 +61,7 @@ func (g *GroupCacheStorage) UpdateGroup(update *events.GroupInfo) (err error) {
 		g.log.Debugf("Groups refreshed, skipping update of %s", update.JID)
 		return nil
 	}
-	group, err := g.groups.GetGroup(update.JID)
+	group, err := g.groups.GetGroup(context.Background(), update.JID)
 	if err != nil {
 		return err
 	}
@@ -77,9 +79,10 @@ func (g *GroupCacheStorage) UpdateGroup(update *events.GroupInfo) (err error) {
 	return g.groups.UpsertOneGroup(group)
 }
 
-func (g *GroupCacheStorage) fetchGroupsUnlocked() error {
+func (g *GroupCacheStorage) fetchGroupsUnlocked(ctx context.Context) error {
 	g.log.Debugf("Refreshing groups")
-	groups, err := g.gows.GetJoinedGroups(g.gows.Context)
+	// Bound to the session, not the request - the refresh is shared by everyone waiting for it
+	groups, err := g.gows.GetJoinedGroups(tracing.WithSpanOf(g.gows.Context, ctx))
 	if err != nil {
 		return err
 	}
@@ -99,14 +102,14 @@ func (g *GroupCacheStorage) fetchGroupsUnlocked() error {
 
 }
 
-func (g *GroupCacheStorage) fetchGroupsIfNeeded(lock bool) (bool, error) {
+func (g *GroupCacheStorage) fetchGroupsIfNeeded(ctx context.Context, lock bool) (bool, error) {
 	if lock {
 		g.lock.Lock()
 		defer g.lock.Unlock()
 	}
 	if g.shouldRefresh() {
 		g.log.Debugf("Last time refreshed groups %s ago", time.Since(g.lastTimeRefreshed))
-		return true, g.fetchGroupsUnlocked()
+		return true, g.fetchGroupsUnlocked(ctx)
 	}
 	return false, nil
 }
@@ -121,19 +124,19 @@ func (g *GroupCacheStorage) UpsertOneGroup(group *types.GroupInfo) error {
 }
 
 func (g *GroupCacheStorage) GetAllGroups(sort storage.Sort, pagination storage.Pagination) ([]*types.GroupInfo, error) {
-	_, err := g.fetchGroupsIfNeeded(true)
+	_, err := g.fetchGroupsIfNeeded(context.Background(), true)
 	if err != nil {
 		return nil, err
 	}
 	return g.groups.GetAllGroups(sort, pagination)
 }
 
-func (g *GroupCacheStorage) GetGroup(jid types.JID) (*types.GroupInfo, error) {
-	_, err := g.fetchGroupsIfNeeded(true)
+func (g *GroupCacheStorage) GetGroup(ctx context.Context, jid types.JID) (*types.GroupInfo, error) {
+	_, err := g.fetchGroupsIfNeeded(ctx, true)
 	if err != nil {
 		return nil, err
 	}
-	return g.groups.GetGroup(jid)
+	return g.groups.GetGroup(ctx, jid)
 }
 
 func (g *GroupCacheStorage) DeleteGroup(jid types.JID) error {
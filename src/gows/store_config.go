@@ -0,0 +1,32 @@
+package gows
+
+import (
+	"errors"
+	"net/url"
+)
+
+func addApplicationName(address string, name string) string {
+	parsedURL, err := url.Parse(address)
+	if err != nil {
+		return address
+	}
+	queryParams := parsedURL.Query()
+	queryParams.Set("application_name", name)
+	parsedURL.RawQuery = queryParams.Encode()
+	return parsedURL.String()
+}
+
+// BuildStoreConfig adds the connection parameters GOWS needs to the address
+func BuildStoreConfig(dialect string, address string) (StoreConfig, error) {
+	switch {
+	case dialect == "sqlite3" || dialect == "sqlite":
+		// busy_timeout to prevent "database is locked" errors
+		// DO NOT add cache=shared, it's not safe
+		address = address + "?_foreign_keys=on&_busy_timeout=30000"
+	case dialect == "postgres":
+		address = addApplicationName(address, "GOWS")
+	default:
+		return StoreConfig{}, errors.New("unsupported sql dialect: " + dialect)
+	}
+	return StoreConfig{Dialect: dialect, Address: address}, nil
+}
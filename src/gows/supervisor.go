@@ -0,0 +1,160 @@
+package gows
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// SupervisorConfig controls how failed sessions are restarted
+type SupervisorConfig struct {
+	// MaxAttempts - give up (FAILED status) after that many failed attempts in a row.
+	// 0 disables the supervisor.
+	MaxAttempts int
+	// InitialBackoff - delay before the first attempt
+	InitialBackoff time.Duration
+	// MaxBackoff - the delay never grows above it
+	MaxBackoff time.Duration
+	// Multiplier - the delay grows that many times after every attempt
+	Multiplier float64
+	// Jitter - random part of the delay, 0.2 means ±20%
+	Jitter float64
+}
+
+// Backoff returns the delay before the attempt (starting from 1)
+func (c SupervisorConfig) Backoff(attempt int) time.Duration {
+	multiplier := c.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(c.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if c.MaxBackoff > 0 && delay > float64(c.MaxBackoff) {
+		delay = float64(c.MaxBackoff)
+	}
+	if c.Jitter > 0 {
+		delay += delay * c.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// SessionRetryEvent is emitted for every restart attempt of a failed session
+type SessionRetryEvent struct {
+	Attempt     int
+	MaxAttempts int
+	// RetryAt - when the attempt is going to happen, empty if GaveUp
+	RetryAt time.Time
+	// Error - the failure that caused the attempt
+	Error string
+	// GaveUp - no more attempts, the session is FAILED now
+	GaveUp bool
+}
+
+func (e *SessionRetryEvent) EventName() string {
+	return "session.retry"
+}
+
+// isRetriableFailure tells if the failure event is transient and the session is worth restarting.
+// Logout, ban, replaced stream, outdated client - require intervention, so they're not retried.
+func isRetriableFailure(event interface{}) bool {
+	_, ok := event.(*events.ConnectFailure)
+	return ok
+}
+
+// sessionSupervisor restarts one session after failures with exponential backoff
+type sessionSupervisor struct {
+	cfg  SupervisorConfig
+	gows *GoWS
+
+	lock     sync.Mutex
+	attempts int
+	timer    *time.Timer
+	stopped  bool
+}
+
+func newSessionSupervisor(cfg SupervisorConfig, gows *GoWS) *sessionSupervisor {
+	return &sessionSupervisor{cfg: cfg, gows: gows}
+}
+
+// failed schedules the next attempt or gives up
+func (s *sessionSupervisor) failed(reason error) {
+	evt, status, err := s.schedule(reason)
+	if evt == nil {
+		return
+	}
+	// Not under the lock - emitting waits for room in the events buffer, stop must not wait for it
+	s.gows.emitEvent(evt)
+	s.gows.setStatus(status, err)
+}
+
+// schedule decides on the failure, returns the event and the status to report, nil event - nothing to report
+func (s *sessionSupervisor) schedule(reason error) (*SessionRetryEvent, SessionStatus, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopped {
+		return nil, "", nil
+	}
+	if s.timer != nil {
+		// Already scheduled
+		return nil, "", nil
+	}
+
+	s.attempts++
+	if s.attempts > s.cfg.MaxAttempts {
+		err := fmt.Errorf("gave up after %d attempt(s): %w", s.cfg.MaxAttempts, reason)
+		s.gows.Log.Errorf("Session failed: %v", err)
+		evt := &SessionRetryEvent{
+			Attempt:     s.attempts - 1,
+			MaxAttempts: s.cfg.MaxAttempts,
+			Error:       reason.Error(),
+			GaveUp:      true,
+		}
+		return evt, StatusFailed, err
+	}
+
+	delay := s.cfg.Backoff(s.attempts)
+	s.gows.Log.Warnf("Session failed, restarting in %v (attempt %d/%d): %v", delay, s.attempts, s.cfg.MaxAttempts, reason)
+	s.timer = time.AfterFunc(delay, s.retry)
+	evt := &SessionRetryEvent{
+		Attempt:     s.attempts,
+		MaxAttempts: s.cfg.MaxAttempts,
+		RetryAt:     time.Now().Add(delay),
+		Error:       reason.Error(),
+	}
+	return evt, StatusConnecting, reason
+}
+
+func (s *sessionSupervisor) retry() {
+	s.lock.Lock()
+	s.timer = nil
+	stopped := s.stopped
+	s.lock.Unlock()
+	if stopped {
+		return
+	}
+
+	s.gows.Disconnect()
+	// Start reports the failure back to the supervisor, it schedules the next attempt
+	_ = s.gows.Start()
+}
+
+// connected resets attempts - the next failure starts from the initial backoff
+func (s *sessionSupervisor) connected() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.attempts = 0
+}
+
+// stop cancels scheduled attempts, the session is stopped or logged out on purpose
+func (s *sessionSupervisor) stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stopped = true
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
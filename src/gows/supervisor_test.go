@@ -0,0 +1,71 @@
+package gows
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"testing"
+	"time"
+)
+
+func TestSupervisorConfigBackoff(t *testing.T) {
+	cfg := SupervisorConfig{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+	}
+	assert.Equal(t, time.Second, cfg.Backoff(1))
+	assert.Equal(t, 2*time.Second, cfg.Backoff(2))
+	assert.Equal(t, 8*time.Second, cfg.Backoff(4))
+	assert.Equal(t, 10*time.Second, cfg.Backoff(5))
+
+	cfg.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		delay := cfg.Backoff(2)
+		assert.GreaterOrEqual(t, delay, 1600*time.Millisecond)
+		assert.LessOrEqual(t, delay, 2400*time.Millisecond)
+	}
+}
+
+func TestIsRetriableFailure(t *testing.T) {
+	assert.True(t, isRetriableFailure(&events.ConnectFailure{}))
+	assert.False(t, isRetriableFailure(&events.LoggedOut{}))
+	assert.False(t, isRetriableFailure(&events.StreamReplaced{}))
+	assert.False(t, isRetriableFailure(&events.TemporaryBan{}))
+	assert.False(t, isRetriableFailure(&events.ClientOutdated{}))
+}
+
+func TestSupervisorStopWhileEmitting(t *testing.T) {
+	gows := &GoWS{
+		Client:   &whatsmeow.Client{Log: waLog.Noop},
+		Context:  context.Background(),
+		events:   make(chan interface{}),
+		state:    newStateMachine(),
+		stopping: make(chan struct{}),
+	}
+	s := newSessionSupervisor(SupervisorConfig{MaxAttempts: 1, InitialBackoff: time.Hour, Multiplier: 2}, gows)
+	// Nobody reads events - the retry event waits for room
+	failed := make(chan struct{})
+	go func() {
+		s.failed(errors.New("connect failure"))
+		close(failed)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		s.stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stop waits for the events buffer")
+	}
+	close(gows.stopping)
+	<-failed
+}
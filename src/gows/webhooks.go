@@ -0,0 +1,390 @@
+package gows
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/devlikeapro/gows/storage"
+	"github.com/google/uuid"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// Webhook request headers
+const (
+	WebhookHeaderRequestId     = "X-Webhook-Request-Id"
+	WebhookHeaderEvent         = "X-Webhook-Event"
+	WebhookHeaderTimestamp     = "X-Webhook-Timestamp"
+	WebhookHeaderHmac          = "X-Webhook-Hmac"
+	WebhookHeaderHmacAlgorithm = "X-Webhook-Hmac-Algorithm"
+)
+
+const (
+	DefaultWebhookRetries    = 15
+	DefaultWebhookRetryDelay = 2 * time.Second
+	DefaultWebhookTimeout    = 10 * time.Second
+	// webhookMaxRetryDelay - the retry delay never grows above it
+	webhookMaxRetryDelay = 10 * time.Minute
+	// webhookBuffer - deliveries waiting for the first attempt per webhook, then they go to the retry queue
+	webhookBuffer = 1000
+	// webhookPollInterval - how often the retry queue is checked for due deliveries
+	webhookPollInterval = time.Second
+	webhookPollBatch    = 100
+)
+
+// WebhookConfig is an HTTP endpoint receiving the session events
+type WebhookConfig struct {
+	Url string
+	// Events - event types to deliver, e.g. events.Message, session.status. All if empty.
+	Events []string
+	// HmacKey - if set, the body is signed with HMAC-SHA512, the hex signature is in X-Webhook-Hmac
+	HmacKey string
+	// Retries - how many times a failed delivery is retried, DefaultWebhookRetries if 0, negative disables retries
+	Retries int
+	// RetryDelay - the delay before the first retry, doubles after every attempt. DefaultWebhookRetryDelay if 0
+	RetryDelay time.Duration
+	// Timeout - for one request, DefaultWebhookTimeout if 0
+	Timeout time.Duration
+}
+
+func (c WebhookConfig) Validate() error {
+	parsed, err := url.Parse(c.Url)
+	if err != nil {
+		return fmt.Errorf("invalid webhook url '%s': %w", c.Url, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid webhook url '%s': http(s) url expected", c.Url)
+	}
+	return nil
+}
+
+func (c WebhookConfig) withDefaults() WebhookConfig {
+	if c.Retries == 0 {
+		c.Retries = DefaultWebhookRetries
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = DefaultWebhookRetryDelay
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultWebhookTimeout
+	}
+	return c
+}
+
+// retryDelay returns the delay before the retry after the failed attempt (starting from 1)
+func (c WebhookConfig) retryDelay(attempt int) time.Duration {
+	delay := c.RetryDelay
+	for i := 1; i < attempt && delay < webhookMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > webhookMaxRetryDelay {
+		delay = webhookMaxRetryDelay
+	}
+	return delay
+}
+
+// WebhookEvent is the body sent to webhooks - the same event the stream gets
+type WebhookEvent struct {
+	Session  string          `json:"session"`
+	Event    string          `json:"event"`
+	Sequence uint64          `json:"sequence,omitempty"`
+	Data     json.RawMessage `json:"data"`
+}
+
+type webhookTarget struct {
+	cfg    WebhookConfig
+	events map[string]bool
+	// deliveries waiting for the first attempt
+	ch chan *storage.WebhookDelivery
+}
+
+// webhookDispatcher delivers session events to webhooks.
+// The first attempt is made right away (in order per webhook),
+// failed deliveries go to the retry queue in the session database, so they survive restarts.
+type webhookDispatcher struct {
+	log     waLog.Logger
+	queue   storage.WebhookQueue
+	client  *http.Client
+	targets []*webhookTarget
+
+	// ctx is cancelled when the dispatcher is stopping, running requests are interrupted
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+
+	lock    sync.RWMutex
+	stopped bool
+}
+
+func newWebhookDispatcher(log waLog.Logger, queue storage.WebhookQueue, webhooks []WebhookConfig) *webhookDispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &webhookDispatcher{
+		log:    log,
+		queue:  queue,
+		client: &http.Client{},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for _, cfg := range webhooks {
+		target := &webhookTarget{
+			cfg: cfg.withDefaults(),
+			ch:  make(chan *storage.WebhookDelivery, webhookBuffer),
+		}
+		if len(cfg.Events) > 0 {
+			target.events = make(map[string]bool, len(cfg.Events))
+			for _, event := range cfg.Events {
+				target.events[event] = true
+			}
+		}
+		d.targets = append(d.targets, target)
+	}
+	return d
+}
+
+func (d *webhookDispatcher) start() {
+	for _, target := range d.targets {
+		d.workers.Add(1)
+		go d.worker(target)
+	}
+	d.workers.Add(1)
+	go d.retryLoop()
+}
+
+// stop interrupts running requests and waits for workers,
+// deliveries not sent yet are moved to the retry queue
+func (d *webhookDispatcher) stop() {
+	d.lock.Lock()
+	if d.stopped {
+		d.lock.Unlock()
+		return
+	}
+	d.stopped = true
+	for _, target := range d.targets {
+		close(target.ch)
+	}
+	d.lock.Unlock()
+	d.cancel()
+	d.workers.Wait()
+}
+
+// Dispatch queues the event for all webhooks subscribed to it,
+// after stop the deliveries go straight to the retry queue for the next start
+func (d *webhookDispatcher) Dispatch(event *WebhookEvent) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	var body string
+	for _, target := range d.targets {
+		if target.events != nil && !target.events[event.Event] {
+			continue
+		}
+		if body == "" {
+			data, err := json.Marshal(event)
+			if err != nil {
+				d.log.Errorf("Failed to marshal webhook event %s: %v", event.Event, err)
+				return
+			}
+			body = string(data)
+		}
+		delivery := &storage.WebhookDelivery{
+			ID:        uuid.New().String(),
+			Url:       target.cfg.Url,
+			Event:     event.Event,
+			Body:      body,
+			CreatedAt: time.Now().UTC(),
+		}
+		if d.stopped {
+			delivery.NextAttemptAt = delivery.CreatedAt
+			d.enqueue(delivery)
+			continue
+		}
+		select {
+		case target.ch <- delivery:
+		default:
+			// The webhook is too slow - do not hold the session, the retry queue picks it up
+			delivery.NextAttemptAt = delivery.CreatedAt
+			d.enqueue(delivery)
+		}
+	}
+}
+
+// wants tells if any webhook is subscribed to the event type
+func (d *webhookDispatcher) wants(eventType string) bool {
+	for _, target := range d.targets {
+		if target.events == nil || target.events[eventType] {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *webhookDispatcher) worker(target *webhookTarget) {
+	defer d.workers.Done()
+	for delivery := range target.ch {
+		if d.ctx.Err() != nil {
+			// Stopping - keep it for the next start
+			delivery.NextAttemptAt = time.Now().UTC()
+			d.enqueue(delivery)
+			continue
+		}
+		err := d.send(target.cfg, delivery)
+		if err == nil {
+			continue
+		}
+		if d.ctx.Err() != nil {
+			// Interrupted by stop, not the webhook failure
+			delivery.NextAttemptAt = time.Now().UTC()
+			d.enqueue(delivery)
+			continue
+		}
+		delivery.Attempts = 1
+		delivery.LastError = err.Error()
+		if !d.canRetry(target.cfg, delivery) {
+			continue
+		}
+		delivery.NextAttemptAt = time.Now().UTC().Add(target.cfg.retryDelay(delivery.Attempts))
+		d.enqueue(delivery)
+	}
+}
+
+func (d *webhookDispatcher) enqueue(delivery *storage.WebhookDelivery) {
+	err := d.queue.Enqueue(delivery)
+	if err != nil {
+		d.log.Errorf("Failed to queue webhook %s delivery %s (%s), it's lost: %v", delivery.Url, delivery.ID, delivery.Event, err)
+	}
+}
+
+// canRetry tells if the failed delivery has retries left, logs if not
+func (d *webhookDispatcher) canRetry(cfg WebhookConfig, delivery *storage.WebhookDelivery) bool {
+	if delivery.Attempts <= cfg.Retries {
+		d.log.Warnf("Webhook %s delivery %s (%s) failed, attempt %d: %s", delivery.Url, delivery.ID, delivery.Event, delivery.Attempts, delivery.LastError)
+		return true
+	}
+	d.log.Errorf("Webhook %s delivery %s (%s) failed after %d attempt(s), giving up: %s", delivery.Url, delivery.ID, delivery.Event, delivery.Attempts, delivery.LastError)
+	return false
+}
+
+// retryLoop retries due deliveries from the queue until the dispatcher is stopped.
+// Retries are not ordered with new events.
+func (d *webhookDispatcher) retryLoop() {
+	defer d.workers.Done()
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			d.retryDue()
+		}
+	}
+}
+
+func (d *webhookDispatcher) retryDue() {
+	deliveries, err := d.queue.Due(time.Now(), webhookPollBatch)
+	if err != nil {
+		d.log.Errorf("Failed to read webhook retry queue: %v", err)
+		return
+	}
+	for _, delivery := range deliveries {
+		if d.ctx.Err() != nil {
+			return
+		}
+		target := d.target(delivery.Url)
+		if target == nil {
+			// The webhook has been removed from the config
+			d.log.Warnf("Dropping webhook delivery %s (%s) for %s - the webhook is not configured anymore", delivery.ID, delivery.Event, delivery.Url)
+			err = d.queue.Delete(delivery.ID)
+		} else {
+			err = d.retry(target.cfg, delivery)
+		}
+		if err != nil {
+			d.log.Errorf("Failed to update webhook retry queue: %v", err)
+		}
+	}
+}
+
+func (d *webhookDispatcher) retry(cfg WebhookConfig, delivery *storage.WebhookDelivery) error {
+	err := d.send(cfg, delivery)
+	if err == nil {
+		return d.queue.Delete(delivery.ID)
+	}
+	if d.ctx.Err() != nil {
+		// Interrupted by stop, not the webhook failure
+		return nil
+	}
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	if !d.canRetry(cfg, delivery) {
+		return d.queue.Delete(delivery.ID)
+	}
+	next := time.Now().UTC().Add(cfg.retryDelay(delivery.Attempts))
+	return d.queue.Reschedule(delivery.ID, delivery.Attempts, next, delivery.LastError)
+}
+
+func (d *webhookDispatcher) target(url string) *webhookTarget {
+	for _, target := range d.targets {
+		if target.cfg.Url == url {
+			return target
+		}
+	}
+	return nil
+}
+
+// send makes one attempt, any non-2xx response is a failure
+func (d *webhookDispatcher) send(cfg WebhookConfig, delivery *storage.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(d.ctx, cfg.Timeout)
+	defer cancel()
+	body := []byte(delivery.Body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookHeaderRequestId, delivery.ID)
+	req.Header.Set(WebhookHeaderEvent, delivery.Event)
+	req.Header.Set(WebhookHeaderTimestamp, fmt.Sprint(time.Now().UnixMilli()))
+	if cfg.HmacKey != "" {
+		req.Header.Set(WebhookHeaderHmac, SignWebhook(cfg.HmacKey, body))
+		req.Header.Set(WebhookHeaderHmacAlgorithm, "sha512")
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return nil
+}
+
+// SignWebhook returns the hex HMAC-SHA512 of the body, as sent in X-Webhook-Hmac
+func SignWebhook(key string, body []byte) string {
+	mac := hmac.New(sha512.New, []byte(key))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HasWebhook tells if any session webhook is subscribed to the event type
+func (gows *GoWS) HasWebhook(eventType string) bool {
+	return gows.webhooks != nil && gows.webhooks.wants(eventType)
+}
+
+// DispatchWebhook sends the event to the session webhooks, if any
+func (gows *GoWS) DispatchWebhook(event *WebhookEvent) {
+	if gows.webhooks == nil {
+		return
+	}
+	gows.webhooks.Dispatch(event)
+}
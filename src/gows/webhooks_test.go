@@ -0,0 +1,139 @@
+package gows
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devlikeapro/gows/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+type memoryWebhookQueue struct {
+	lock       sync.Mutex
+	deliveries map[string]*storage.WebhookDelivery
+}
+
+func (q *memoryWebhookQueue) Enqueue(delivery *storage.WebhookDelivery) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	copied := *delivery
+	q.deliveries[delivery.ID] = &copied
+	return nil
+}
+
+func (q *memoryWebhookQueue) Due(now time.Time, limit uint64) ([]*storage.WebhookDelivery, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	var due []*storage.WebhookDelivery
+	for _, delivery := range q.deliveries {
+		if !delivery.NextAttemptAt.After(now) {
+			copied := *delivery
+			due = append(due, &copied)
+		}
+	}
+	return due, nil
+}
+
+func (q *memoryWebhookQueue) Reschedule(id string, attempts int, next time.Time, lastError string) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	delivery := q.deliveries[id]
+	delivery.Attempts, delivery.NextAttemptAt, delivery.LastError = attempts, next, lastError
+	return nil
+}
+
+func (q *memoryWebhookQueue) Delete(id string) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	delete(q.deliveries, id)
+	return nil
+}
+
+func (q *memoryWebhookQueue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.deliveries)
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	var lock sync.Mutex
+	var calls int
+	received := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		calls++
+		call := calls
+		lock.Unlock()
+		// The first attempt fails, the retry succeeds
+		if call == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	queue := &memoryWebhookQueue{deliveries: map[string]*storage.WebhookDelivery{}}
+	dispatcher := newWebhookDispatcher(waLog.Noop, queue, []WebhookConfig{{
+		Url:        server.URL,
+		Events:     []string{"events.Message"},
+		HmacKey:    "secret",
+		RetryDelay: time.Millisecond,
+	}})
+	dispatcher.start()
+	defer dispatcher.stop()
+
+	dispatcher.Dispatch(&WebhookEvent{Session: "default", Event: "events.Receipt", Data: json.RawMessage(`{}`)})
+	dispatcher.Dispatch(&WebhookEvent{Session: "default", Event: "events.Message", Sequence: 7, Data: json.RawMessage(`{"text":"hi"}`)})
+	assert.True(t, dispatcher.wants("events.Message"))
+	assert.False(t, dispatcher.wants("events.Receipt"))
+
+	select {
+	case req := <-received:
+		body := <-bodies
+		assert.JSONEq(t, `{"session":"default","event":"events.Message","sequence":7,"data":{"text":"hi"}}`, string(body))
+		assert.Equal(t, "events.Message", req.Header.Get(WebhookHeaderEvent))
+		assert.Equal(t, SignWebhook("secret", body), req.Header.Get(WebhookHeaderHmac))
+		assert.Equal(t, "sha512", req.Header.Get(WebhookHeaderHmacAlgorithm))
+	case <-time.After(5 * time.Second):
+		t.Fatal("the delivery has not been retried")
+	}
+	require.Eventually(t, func() bool { return queue.len() == 0 }, time.Second, 10*time.Millisecond)
+
+	// Filtered out events are not delivered
+	lock.Lock()
+	assert.Equal(t, 2, calls)
+	lock.Unlock()
+}
+
+func TestWebhookDispatcherStopped(t *testing.T) {
+	queue := &memoryWebhookQueue{deliveries: map[string]*storage.WebhookDelivery{}}
+	dispatcher := newWebhookDispatcher(waLog.Noop, queue, []WebhookConfig{
+		{Url: "http://localhost:1/messages", Events: []string{"events.Message"}},
+		{Url: "http://localhost:1/all"},
+	})
+	dispatcher.start()
+	dispatcher.stop()
+
+	// Events after stop are kept for the next start
+	dispatcher.Dispatch(&WebhookEvent{Session: "default", Event: "events.Message", Data: json.RawMessage(`{}`)})
+	dispatcher.Dispatch(&WebhookEvent{Session: "default", Event: "events.Receipt", Data: json.RawMessage(`{}`)})
+	assert.Equal(t, 3, queue.len())
+}
+
+func TestWebhookConfigRetryDelay(t *testing.T) {
+	cfg := WebhookConfig{RetryDelay: time.Second}
+	assert.Equal(t, time.Second, cfg.retryDelay(1))
+	assert.Equal(t, 4*time.Second, cfg.retryDelay(3))
+	assert.Equal(t, webhookMaxRetryDelay, cfg.retryDelay(100))
+}
@@ -4,12 +4,28 @@ import (
 	"fmt"
 	waLog "go.mau.fi/whatsmeow/util/log"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// Fields added to log records with With, they're separate keys in the JSON format
+const (
+	FieldSession = "session"
+	FieldChat    = "chat"
+	FieldMessage = "message_id"
+)
+
+type field struct {
+	key   string
+	value string
+}
+
 type stdoutLogger struct {
 	mod   string
 	color bool
-	min   int
+	// min is shared with sub loggers, so the level can be changed for the whole tree at once
+	min    *atomic.Int32
+	fields []field
 }
 
 var colors = map[string]string{
@@ -28,15 +44,16 @@ var levelToInt = map[string]int{
 }
 
 func (s *stdoutLogger) outputf(level, msg string, args ...interface{}) {
-	if levelToInt[level] < s.min {
+	if levelToInt[level] < int(s.min.Load()) {
 		return
 	}
-	var colorStart, colorReset string
-	if s.color {
-		colorStart = colors[level]
-		colorReset = "\033[0m"
+	out := output.Load()
+	rec := record{time: time.Now(), level: level, mod: s.mod, msg: fmt.Sprintf(msg, args...), fields: s.fields}
+	if out.json {
+		out.write(rec.json())
+		return
 	}
-	fmt.Printf("%s%s | [%s] %s%s\n", colorStart, level, s.mod, fmt.Sprintf(msg, args...), colorReset)
+	out.write(rec.text(s.color && out.color))
 }
 
 func (s *stdoutLogger) Errorf(msg string, args ...interface{}) { s.outputf("ERROR", msg, args...) }
@@ -53,14 +70,77 @@ func (s *stdoutLogger) Debugf(msg string, args ...interface{}) {
 }
 func (s *stdoutLogger) Tracef(msg string, args ...interface{}) { s.outputf("TRACE", msg, args...) }
 func (s *stdoutLogger) Sub(mod string) waLog.Logger {
-	return &stdoutLogger{mod: fmt.Sprintf("%s/%s", s.mod, mod), color: s.color, min: s.min}
+	return &stdoutLogger{mod: fmt.Sprintf("%s/%s", s.mod, mod), color: s.color, min: s.min, fields: s.fields}
 }
 
-// Stdout is a simple Logger implementation that outputs to stdout. The module name given is included in log lines.
+// Stdout is a simple Logger implementation that outputs to stdout (or the file set by Configure).
+// The module name given is included in log lines.
 //
 // minLevel specifies the minimum log level to output. An empty string will output all logs.
 //
 // If color is true, then info, warn and error logs will be colored cyan, yellow and red respectively using ANSI color escape codes.
 func Stdout(module string, minLevel string, color bool) waLog.Logger {
-	return &stdoutLogger{mod: module, color: color, min: levelToInt[strings.ToUpper(minLevel)]}
+	min := &atomic.Int32{}
+	min.Store(int32(levelToInt[strings.ToUpper(minLevel)]))
+	return &stdoutLogger{mod: module, color: color, min: min}
+}
+
+// serverLevel is shared by all Server loggers
+var serverLevel = func() *atomic.Int32 {
+	min := &atomic.Int32{}
+	min.Store(int32(levelToInt["DEBUG"]))
+	return min
+}()
+
+// Server returns a logger for server-wide modules (not sessions),
+// they share the level set by SetServerLevel.
+func Server(module string) waLog.Logger {
+	return &stdoutLogger{mod: module, min: serverLevel}
+}
+
+// SetServerLevel changes the minimum log level of all Server loggers
+func SetServerLevel(minLevel string) error {
+	level, ok := levelToInt[strings.ToUpper(minLevel)]
+	if !ok {
+		return fmt.Errorf("unknown log level: %s", minLevel)
+	}
+	serverLevel.Store(int32(level))
+	return nil
+}
+
+// SetLevel changes the minimum log level of the logger and all loggers created from it via Sub
+// (and the ones it has been created from).
+func SetLevel(log waLog.Logger, minLevel string) error {
+	logger, ok := log.(*stdoutLogger)
+	if !ok {
+		return fmt.Errorf("logger %T doesn't support changing level", log)
+	}
+	level, ok := levelToInt[strings.ToUpper(minLevel)]
+	if !ok {
+		return fmt.Errorf("unknown log level: %s", minLevel)
+	}
+	logger.min.Store(int32(level))
+	return nil
+}
+
+// With returns a logger adding the field to every record, loggers created from it via Sub keep it.
+// Loggers of other implementations are returned as is.
+func With(log waLog.Logger, key string, value string) waLog.Logger {
+	logger, ok := log.(*stdoutLogger)
+	if !ok || value == "" {
+		return log
+	}
+	fields := make([]field, 0, len(logger.fields)+1)
+	for _, f := range logger.fields {
+		if f.key != key {
+			fields = append(fields, f)
+		}
+	}
+	fields = append(fields, field{key: key, value: value})
+	return &stdoutLogger{mod: logger.mod, color: logger.color, min: logger.min, fields: fields}
+}
+
+// WithMessage adds the chat JID and the message ID to every record
+func WithMessage(log waLog.Logger, chat string, id string) waLog.Logger {
+	return With(With(log, FieldChat, chat), FieldMessage, id)
 }
@@ -0,0 +1,49 @@
+package gowsLog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gows.log")
+	require.NoError(t, Configure(Config{Format: FormatJSON, File: path}))
+	defer func() { _ = Close() }()
+
+	log := With(Stdout("Session", "INFO", false).Sub("default"), FieldSession, "default")
+	WithMessage(log, "123@s.whatsapp.net", "ABC").Infof("Message %d", 1)
+	log.Debugf("Skipped")
+	require.NoError(t, SetLevel(log, "DEBUG"))
+	log.Sub("Client").Debugf("Written")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	var record map[string]string
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.NotEmpty(t, record["time"])
+	delete(record, "time")
+	assert.Equal(t, map[string]string{
+		"level":      "INFO",
+		"module":     "Session/default",
+		"session":    "default",
+		"chat":       "123@s.whatsapp.net",
+		"message_id": "ABC",
+		"msg":        "Message 1",
+	}, record)
+	assert.Contains(t, lines[1], `"module":"Session/default/Client","session":"default","msg":"Written"`)
+}
+
+func TestText(t *testing.T) {
+	rec := record{level: "WARN", mod: "Session/default", msg: "Failed", fields: []field{{FieldSession, "default"}, {FieldChat, "123@g.us"}}}
+	assert.Equal(t, "WARN | [Session/default] Failed chat=123@g.us\n", string(rec.text(false)))
+	assert.Error(t, Configure(Config{Format: "xml"}))
+	assert.Error(t, SetServerLevel("VERBOSE"))
+}
@@ -0,0 +1,146 @@
+package gowsLog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Config - where and how all loggers write, see Configure
+type Config struct {
+	// Format - FormatText (default) or FormatJSON, one object per line
+	Format string
+	// File - write to the file instead of stdout, it's rotated when it grows over MaxSize
+	File string
+	// MaxSize - megabytes, 100 if 0
+	MaxSize int
+	// MaxBackups - rotated files to keep, all if 0
+	MaxBackups int
+	// MaxAge - days to keep rotated files, forever if 0
+	MaxAge int
+	// Compress - gzip rotated files
+	Compress bool
+}
+
+// sink is the output shared by all loggers
+type sink struct {
+	lock   sync.Mutex
+	w      io.Writer
+	json   bool
+	color  bool
+	closer io.Closer
+}
+
+func (s *sink) write(line []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, _ = s.w.Write(line)
+}
+
+var output atomic.Pointer[sink]
+
+func init() {
+	output.Store(&sink{w: os.Stdout, color: true})
+}
+
+// Configure changes the output of all loggers, including the ones created before.
+// The previous log file (if any) is closed.
+func Configure(cfg Config) error {
+	out := &sink{w: os.Stdout, color: true}
+	switch cfg.Format {
+	case "", FormatText:
+	case FormatJSON:
+		out.json = true
+	default:
+		return fmt.Errorf("unknown log format: %s", cfg.Format)
+	}
+	if cfg.File != "" {
+		file := &lumberjack.Logger{
+			Filename:   cfg.File,
+			MaxSize:    cfg.MaxSize,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAge,
+			Compress:   cfg.Compress,
+		}
+		out.w = file
+		out.closer = file
+		out.color = false
+	}
+	previous := output.Swap(out)
+	if previous.closer != nil {
+		return previous.closer.Close()
+	}
+	return nil
+}
+
+// Close closes the log file, logs go to stdout after it
+func Close() error {
+	return Configure(Config{})
+}
+
+type record struct {
+	time   time.Time
+	level  string
+	mod    string
+	msg    string
+	fields []field
+}
+
+// text - "LEVEL | [module] message key=value", the session is a part of the module already
+func (r record) text(color bool) []byte {
+	var colorStart, colorReset string
+	if color {
+		colorStart = colors[r.level]
+		colorReset = "\033[0m"
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s%s | [%s] %s", colorStart, r.level, r.mod, r.msg)
+	for _, f := range r.fields {
+		if f.key == FieldSession {
+			continue
+		}
+		fmt.Fprintf(&buf, " %s=%s", f.key, f.value)
+	}
+	buf.WriteString(colorReset)
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// json - {"time":...,"level":...,"module":...,<fields>,"msg":...}, keys keep the order
+func (r record) json() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	writeJSONField(&buf, "time", r.time.UTC().Format(time.RFC3339Nano))
+	buf.WriteByte(',')
+	writeJSONField(&buf, "level", r.level)
+	buf.WriteByte(',')
+	writeJSONField(&buf, "module", r.mod)
+	for _, f := range r.fields {
+		buf.WriteByte(',')
+		writeJSONField(&buf, f.key, f.value)
+	}
+	buf.WriteByte(',')
+	writeJSONField(&buf, "msg", r.msg)
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+func writeJSONField(buf *bytes.Buffer, key string, value string) {
+	k, _ := json.Marshal(key)
+	v, _ := json.Marshal(value)
+	buf.Write(k)
+	buf.WriteByte(':')
+	buf.Write(v)
+}
@@ -1,26 +1,56 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"github.com/devlikeapro/gows/gateway"
+	"github.com/devlikeapro/gows/gows"
 	gowsLog "github.com/devlikeapro/gows/log"
+	"github.com/devlikeapro/gows/metrics"
 	pb "github.com/devlikeapro/gows/proto"
 	"github.com/devlikeapro/gows/server"
+	"github.com/devlikeapro/gows/tracing"
 	"github.com/devlikeapro/gows/wrpc"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/recovery"
 	waLog "go.mau.fi/whatsmeow/util/log"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/experimental"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
 	"runtime/debug"
+	"strings"
+	"syscall"
 	"time"
 )
 
+// listenTCP opens the TCP listener, connections use TLS if it's configured (see wrpc.NewListenerCredentials)
+func listenTCP(log waLog.Logger, address string, secure bool) (net.Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !secure:
+		log.Warnf("Server is listening on %s without TLS, use it in a trusted network only", listener.Addr())
+	case tlsClientCA != "":
+		log.Infof("Server is listening on %s (mTLS)", listener.Addr())
+	default:
+		log.Infof("Server is listening on %s (TLS)", listener.Addr())
+	}
+	return listener, nil
+}
+
 func listenSocket(log waLog.Logger, path string) *net.Listener {
 	log.Infof("Server is listening on %s", path)
 	// Force remove the socket file
@@ -33,14 +63,10 @@ func listenSocket(log waLog.Logger, path string) *net.Listener {
 	return &listener
 }
 
-func buildGrpcServer(log waLog.Logger) *grpc.Server {
+// buildInterceptors returns the interceptors of RPCs, shared by the gRPC server and the HTTP gateway
+func buildInterceptors(log waLog.Logger, authorizer *wrpc.Authorizer) ([]grpc.UnaryServerInterceptor, []grpc.StreamServerInterceptor) {
 	// defines the maximum duration a unary RPC is allowed to run.
 	unaryCallTimeout := 30 * time.Minute
-	// limit for large media transfers
-	maxMessageSize := 128 * 1024 * 1024
-
-	// Avoid retaining huge pooled buffers: only reuse up to 1 MiB.
-	bufferPool := wrpc.NewCappedBufferPool(1 << 20)
 
 	// Define a custom recovery function to handle panics
 	recoveryOpts := []recovery.Option{
@@ -51,81 +77,465 @@ func buildGrpcServer(log waLog.Logger) *grpc.Server {
 		}),
 	}
 
-	grpcServer := grpc.NewServer(
-		grpc.ChainUnaryInterceptor(
-			recovery.UnaryServerInterceptor(recoveryOpts...),
-			wrpc.UnaryTimeoutInterceptor(unaryCallTimeout),
-		),
-		grpc.ChainStreamInterceptor(
-			recovery.StreamServerInterceptor(recoveryOpts...),
-		),
+	// Metrics go first to see the status of panicked RPCs too
+	unaryInterceptors := []grpc.UnaryServerInterceptor{
+		wrpc.UnaryMetricsInterceptor(),
+		recovery.UnaryServerInterceptor(recoveryOpts...),
+	}
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		wrpc.StreamMetricsInterceptor(),
+		recovery.StreamServerInterceptor(recoveryOpts...),
+	}
+	if authorizer != nil {
+		unaryInterceptors = append(unaryInterceptors, authorizer.UnaryInterceptor())
+		streamInterceptors = append(streamInterceptors, authorizer.StreamInterceptor())
+	}
+	unaryInterceptors = append(unaryInterceptors, wrpc.UnaryTimeoutInterceptor(unaryCallTimeout))
+	return unaryInterceptors, streamInterceptors
+}
+
+func buildGrpcServer(srv *server.Server, tlsConfig *tls.Config, unaryInterceptors []grpc.UnaryServerInterceptor, streamInterceptors []grpc.StreamServerInterceptor) *grpc.Server {
+	// limit for large media transfers
+	maxMessageSize := 128 * 1024 * 1024
+
+	// Avoid retaining huge pooled buffers: only reuse up to 1 MiB.
+	bufferPool := wrpc.NewCappedBufferPool(1 << 20)
+
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+		grpc.Creds(wrpc.NewListenerCredentials(tlsConfig)),
 		grpc.MaxRecvMsgSize(maxMessageSize),
 		grpc.MaxSendMsgSize(maxMessageSize),
 		experimental.BufferPool(bufferPool),
 		grpc.ForceServerCodecV2(wrpc.NewProtoCodec(bufferPool)),
 		// Allow more streams and increase window sizes for better performance
 		grpc.MaxConcurrentStreams(5000),
-		grpc.InitialWindowSize(16*1024*1024),
-		grpc.InitialConnWindowSize(32*1024*1024),
-	)
-	srv := server.NewServer()
+		grpc.InitialWindowSize(16 * 1024 * 1024),
+		grpc.InitialConnWindowSize(32 * 1024 * 1024),
+	}
+	if otlpEndpoint != "" {
+		// Spans for RPCs, continuing the trace from the incoming metadata (traceparent)
+		options = append(options, grpc.StatsHandler(otelgrpc.NewServerHandler(
+			otelgrpc.WithFilter(filters.Not(filters.HealthCheck())),
+		)))
+	}
+	grpcServer := grpc.NewServer(options...)
 	// Add an event handler to the client
 	pb.RegisterMessageServiceServer(grpcServer, srv)
 	pb.RegisterEventStreamServer(grpcServer, srv)
+	healthpb.RegisterHealthServer(grpcServer, srv.Health)
+	if reflectionFlag {
+		reflection.Register(grpcServer)
+	}
 	return grpcServer
 }
 
 var (
-	socket    string
-	pprofFlag bool
-	pprofPort int
-	pprofHost string
+	socket          string
+	pprofFlag       bool
+	pprofPort       int
+	pprofHost       string
+	metricsFlag     bool
+	metricsListen   string
+	registryPath    string
+	restoreFlag     bool
+	shutdownTimeout time.Duration
+	restartAttempts int
+	restartBackoff  time.Duration
+	restartMax      time.Duration
+	restartJitter   float64
+	lockWait        time.Duration
+	listenAddress   string
+	tlsCert         string
+	tlsKey          string
+	tlsClientCA     string
+	authConfig      string
+	reflectionFlag  bool
+	eventBuffer     int
+	otlpEndpoint    string
+	otlpInsecure    bool
+	traceSample     float64
+	traceSQL        bool
+	streamBuffer    int
+	streamBlock     time.Duration
+	httpListen      string
+	httpCORSOrigins string
+	uploadDir       string
+	uploadTTL       time.Duration
+	uploadMaxSize   int64
+	logLevel        string
+	logFormat       string
+	logFile         string
+	logMaxSize      int
+	logMaxBackups   int
+	logMaxAge       int
+	logCompress     bool
 )
 
 func init() {
-	flag.StringVar(&socket, "socket", "/tmp/gows.sock", "Socket path")
+	flag.StringVar(&socket, "socket", "/tmp/gows.sock", "Socket path, empty disables the unix socket")
+	flag.StringVar(&listenAddress, "listen", "", "TCP address to listen on (e.g. 0.0.0.0:50051), disabled if empty")
+	flag.StringVar(&tlsCert, "tls-cert", "", "TLS certificate (PEM) for the TCP listener, reloaded when changed")
+	flag.StringVar(&tlsKey, "tls-key", "", "TLS private key (PEM) for the TCP listener")
+	flag.StringVar(&tlsClientCA, "tls-client-ca", "", "CA bundle (PEM) to verify client certificates (mTLS), clients without a valid certificate are rejected")
+	flag.StringVar(&httpListen, "http-listen", "", "TCP address for the REST/JSON gateway (e.g. 0.0.0.0:8080), uses the TLS settings of -listen, disabled if empty")
+	flag.StringVar(&httpCORSOrigins, "http-cors-origins", "", "Comma-separated origins allowed to call the REST/JSON gateway from browsers, \"*\" allows any")
+	flag.BoolVar(&reflectionFlag, "reflection", false, "Enable gRPC server reflection (e.g. for grpcurl)")
+	flag.StringVar(&authConfig, "auth-config", "", "Tokens file (JSON) to authorize RPCs, reloaded on change and SIGHUP. Anyone who can connect is allowed if empty")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "OTLP gRPC collector address (e.g. localhost:4317) to export traces to, tracing is disabled if empty")
+	flag.BoolVar(&otlpInsecure, "otlp-insecure", false, "Export traces without TLS, e.g. to a local collector")
+	flag.Float64Var(&traceSample, "trace-sample-ratio", 1, "Share of new traces to record (0-1), traces started by clients follow their decision")
+	flag.BoolVar(&traceSQL, "trace-sql", false, "Record spans for storage queries made in RPC traces")
 	flag.BoolVar(&pprofFlag, "pprof", false, "Enable pprof HTTP server")
 	flag.IntVar(&pprofPort, "pprof-port", 6060, "Port for pprof HTTP server")
 	flag.StringVar(&pprofHost, "pprof-host", "localhost", "Host for pprof HTTP server")
+	flag.BoolVar(&metricsFlag, "metrics", false, "Expose Prometheus metrics on /metrics")
+	flag.StringVar(&metricsListen, "metrics-listen", "", "Address for the /metrics HTTP server, the pprof host and port are used if empty")
+	flag.StringVar(&registryPath, "registry", "", "Path to the sessions registry file, sessions are kept in memory only if empty")
+	flag.BoolVar(&restoreFlag, "restore", false, "Restore sessions from the registry on start")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "Time to wait for in-flight RPCs on shutdown before closing them, and then for sessions to stop")
+	flag.IntVar(&restartAttempts, "restart-attempts", 5, "Restart failed sessions up to N times in a row, 0 disables restarts")
+	flag.DurationVar(&restartBackoff, "restart-backoff", 5*time.Second, "Delay before the first restart, doubles after every attempt")
+	flag.DurationVar(&restartMax, "restart-backoff-max", 5*time.Minute, "Maximum delay between restarts")
+	flag.Float64Var(&restartJitter, "restart-jitter", 0.2, "Random part of the restart delay, 0.2 means ±20%")
+	flag.DurationVar(&lockWait, "lock-wait", 0, "Wait for sessions running in another process to be released (blue/green takeover), fail right away if 0")
+	flag.IntVar(&eventBuffer, "session-event-buffer", gows.DefaultEventBuffer, "Events buffered per session before the session is held")
+	flag.IntVar(&streamBuffer, "stream-buffer", 100, "Events buffered per stream, streams may ask for another size")
+	flag.StringVar(&uploadDir, "upload-dir", "", "Directory for media uploaded with UploadMedia and streamed downloads, a temporary directory if empty")
+	flag.DurationVar(&uploadTTL, "upload-ttl", server.DefaultUploadTTL, "How long uploaded media can be sent")
+	flag.Int64Var(&uploadMaxSize, "upload-max-size", server.DefaultUploadMaxSize, "The largest media accepted by UploadMedia, bytes")
+	flag.StringVar(&logLevel, "log-level", "DEBUG", "Log level of the server (sessions have their own), can be changed with SetLogLevel")
+	flag.StringVar(&logFormat, "log-format", gowsLog.FormatText, "Log format - text or json (one object per line)")
+	flag.StringVar(&logFile, "log-file", "", "Write logs to the file instead of stdout, rotated by size")
+	flag.IntVar(&logMaxSize, "log-max-size", 100, "Rotate the log file when it grows over N megabytes")
+	flag.IntVar(&logMaxBackups, "log-max-backups", 5, "Rotated log files to keep, 0 keeps all")
+	flag.IntVar(&logMaxAge, "log-max-age", 0, "Days to keep rotated log files, 0 keeps them forever")
+	flag.BoolVar(&logCompress, "log-compress", false, "Gzip rotated log files")
+	flag.DurationVar(&streamBlock, "stream-block-timeout", 5*time.Second, "How long streams with BLOCK backpressure hold the session before events are dropped")
 }
 
-func startPprofServer(log waLog.Logger) {
-	if !pprofFlag {
-		return
+func buildServer(log waLog.Logger) *server.Server {
+	var registry *gows.SessionRegistry
+	if registryPath != "" {
+		log.Infof("Using sessions registry %s", registryPath)
+		registry = gows.NewSessionRegistry(registryPath)
+	} else if restoreFlag {
+		log.Warnf("-restore is set, but -registry is empty - nothing to restore")
+	}
+	return server.NewServer(server.Config{
+		Manager: gows.ManagerConfig{
+			Registry: registry,
+			Supervisor: gows.SupervisorConfig{
+				MaxAttempts:    restartAttempts,
+				InitialBackoff: restartBackoff,
+				MaxBackoff:     restartMax,
+				Multiplier:     2,
+				Jitter:         restartJitter,
+			},
+			LockWait:    lockWait,
+			EventBuffer: eventBuffer,
+		},
+		StreamBuffer:       streamBuffer,
+		StreamBlockTimeout: streamBlock,
+		UploadDir:          uploadDir,
+		UploadTTL:          uploadTTL,
+		UploadMaxSize:      uploadMaxSize,
+	})
+}
+
+// startHttpServers starts the pprof and /metrics HTTP servers.
+// Metrics are served on the pprof host and port unless -metrics-listen is set,
+// pprof handlers are there only if -pprof is enabled.
+func startHttpServers(log waLog.Logger) {
+	pprofAddr := fmt.Sprintf("%s:%d", pprofHost, pprofPort)
+	var pprofMux *http.ServeMux
+	if pprofFlag {
+		// net/http/pprof registers its handlers on the default mux
+		pprofMux = http.DefaultServeMux
+	}
+	if metricsFlag {
+		metricsMux := pprofMux
+		if metricsListen != "" || metricsMux == nil {
+			metricsMux = http.NewServeMux()
+		}
+		metricsMux.Handle("/metrics", metrics.Handler())
+		if metricsListen != "" {
+			startHttpServer(log, "metrics", metricsListen, metricsMux)
+		} else if pprofMux == nil {
+			startHttpServer(log, "metrics", pprofAddr, metricsMux)
+		} else {
+			log.Infof("Serving metrics on http://%s/metrics", pprofAddr)
+		}
+	}
+	if pprofMux != nil {
+		startHttpServer(log, "pprof", pprofAddr, pprofMux)
 	}
+}
 
-	addr := fmt.Sprintf("%s:%d", pprofHost, pprofPort)
-	log.Infof("Starting pprof HTTP server on %s", addr)
+func startHttpServer(log waLog.Logger, name string, addr string, handler http.Handler) {
+	log.Infof("Starting %s HTTP server on %s", name, addr)
+	go func() {
+		if err := http.ListenAndServe(addr, handler); err != nil {
+			log.Errorf("Failed to start %s HTTP server: %v", name, err)
+		}
+	}()
+}
 
+// startGateway serves the REST/JSON gateway on -http-listen, with TLS if it's configured.
+// Returns nil if the gateway is disabled.
+func startGateway(log waLog.Logger, srv *server.Server, tlsConfig *tls.Config, unaryInterceptors []grpc.UnaryServerInterceptor, streamInterceptors []grpc.StreamServerInterceptor) *http.Server {
+	if httpListen == "" {
+		return nil
+	}
+	var origins []string
+	for _, origin := range strings.Split(httpCORSOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	handler, err := gateway.New(log.Sub("Gateway"), srv, gateway.Config{
+		Unary:         unaryInterceptors,
+		Stream:        streamInterceptors,
+		CORSOrigins:   origins,
+		Version:       server.Version,
+		UploadMaxSize: srv.UploadMaxSize(),
+	})
+	if err != nil {
+		log.Errorf("Failed to configure HTTP gateway: %v", err)
+		os.Exit(1)
+	}
+	httpServer := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	if tlsConfig != nil {
+		httpServer.TLSConfig = tlsConfig.Clone()
+		httpServer.TLSConfig.NextProtos = []string{"h2", "http/1.1"}
+	}
+	listener, err := listenTCP(log, httpListen, tlsConfig != nil)
+	if err != nil {
+		log.Errorf("Failed to listen on %s: %v", httpListen, err)
+		os.Exit(1)
+	}
+	log.Infof("HTTP gateway started, OpenAPI document is on /openapi.json")
 	go func() {
-		if err := http.ListenAndServe(addr, nil); err != nil {
-			log.Errorf("Failed to start pprof HTTP server: %v", err)
+		var err error
+		if tlsConfig != nil {
+			// The certificate comes from TLSConfig.GetCertificate
+			err = httpServer.ServeTLS(listener, "", "")
+		} else {
+			err = httpServer.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorf("Failed to serve HTTP gateway: %v", err)
 		}
 	}()
+	return httpServer
+}
+
+// setupTracing starts exporting traces if -otlp-endpoint is set, returns the function flushing them on shutdown
+func setupTracing(log waLog.Logger) func(context.Context) error {
+	if otlpEndpoint == "" {
+		return nil
+	}
+	flush, err := tracing.Setup(context.Background(), tracing.Config{
+		Endpoint:       otlpEndpoint,
+		Insecure:       otlpInsecure,
+		SampleRatio:    traceSample,
+		SQL:            traceSQL,
+		ServiceName:    "gows",
+		ServiceVersion: server.Version,
+	})
+	if err != nil {
+		log.Errorf("Failed to configure tracing: %v", err)
+		os.Exit(1)
+	}
+	log.Infof("Exporting traces to %s", otlpEndpoint)
+	return flush
+}
+
+// shutdown stops accepting RPCs, closes event streams and waits for in-flight RPCs up to shutdownTimeout,
+// then stops sessions - they flush storage on stop, with the same timeout
+func shutdown(log waLog.Logger, grpcServer *grpc.Server, httpServer *http.Server, srv *server.Server) {
+	srv.CloseStreams()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	if httpServer != nil {
+		if err := httpServer.Shutdown(ctx); err != nil {
+			log.Warnf("HTTP requests are still running after %v, closing them", shutdownTimeout)
+			_ = httpServer.Close()
+		}
+	}
+	select {
+	case <-stopped:
+		log.Infof("gRPC server stopped")
+	case <-ctx.Done():
+		log.Warnf("RPCs are still running after %v, closing them", shutdownTimeout)
+		grpcServer.Stop()
+	}
+
+	// Nothing uses the sessions anymore
+	sessionsStopped := make(chan struct{})
+	go func() {
+		srv.Shutdown()
+		close(sessionsStopped)
+	}()
+	select {
+	case <-sessionsStopped:
+	case <-time.After(shutdownTimeout):
+		log.Warnf("Sessions are still stopping after %v, exiting anyway", shutdownTimeout)
+	}
+}
+
+// authReloadInterval - how often the auth config is checked for changes
+const authReloadInterval = 10 * time.Second
+
+// reload applies config files changed on disk (SIGHUP)
+func reload(log waLog.Logger, authorizer *wrpc.Authorizer) {
+	if authorizer == nil {
+		return
+	}
+	err := authorizer.Reload()
+	if err != nil {
+		log.Errorf("Failed to reload auth config, keeping the previous tokens: %v", err)
+	}
 }
 
 func remove(path string) {
 	_ = os.Remove(path)
 }
 
+func configureLogs() {
+	err := gowsLog.Configure(gowsLog.Config{
+		Format:     logFormat,
+		File:       logFile,
+		MaxSize:    logMaxSize,
+		MaxBackups: logMaxBackups,
+		MaxAge:     logMaxAge,
+		Compress:   logCompress,
+	})
+	if err == nil {
+		err = gowsLog.SetServerLevel(logLevel)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to configure logs: %v\n", err)
+		os.Exit(1)
+	}
+}
+
 func main() {
+	if runCommand(os.Args[1:]) {
+		return
+	}
 	flag.Parse()
-	log := gowsLog.Stdout("Server", "DEBUG", false)
+	configureLogs()
+	defer func() { _ = gowsLog.Close() }()
+	log := gowsLog.Server("Server")
 	log.Infof("Maximum gRPC message size set to 512 MiB")
 
-	// Start pprof HTTP server if enabled
-	startPprofServer(log)
+	// Start pprof and metrics HTTP servers if enabled
+	startHttpServers(log)
+
+	if socket == "" && listenAddress == "" {
+		log.Errorf("Nothing to listen on, set -socket or -listen")
+		os.Exit(1)
+	}
+	tlsFlags := wrpc.TLSConfig{CertFile: tlsCert, KeyFile: tlsKey, ClientCAFile: tlsClientCA}
+	var tlsConfig *tls.Config
+	if tlsFlags.Enabled() {
+		var err error
+		tlsConfig, err = tlsFlags.Build()
+		if err != nil {
+			log.Errorf("Failed to configure TLS: %v", err)
+			os.Exit(1)
+		}
+	} else if tlsClientCA != "" {
+		log.Errorf("-tls-client-ca requires -tls-cert and -tls-key")
+		os.Exit(1)
+	}
+
+	var authorizer *wrpc.Authorizer
+	if authConfig != "" {
+		var err error
+		authorizer, err = wrpc.NewAuthorizer(log.Sub("Auth"), authConfig, server.MethodGroups, server.SessionOf)
+		if err != nil {
+			log.Errorf("Failed to configure auth: %v", err)
+			os.Exit(1)
+		}
+		go authorizer.Watch(context.Background(), authReloadInterval)
+	} else if listenAddress != "" {
+		log.Warnf("-auth-config is not set, anyone who can connect to %s controls all sessions", listenAddress)
+	} else if httpListen != "" {
+		log.Warnf("-auth-config is not set, anyone who can connect to %s controls all sessions", httpListen)
+	}
+
+	flushTraces := setupTracing(log)
 
 	// Build the server
-	grpcServer := buildGrpcServer(log)
+	srv := buildServer(log)
+	unaryInterceptors, streamInterceptors := buildInterceptors(log, authorizer)
+	grpcServer := buildGrpcServer(srv, tlsConfig, unaryInterceptors, streamInterceptors)
+	if restoreFlag {
+		if err := srv.RestoreSessions(); err != nil {
+			log.Errorf("Failed to restore sessions: %v", err)
+		}
+	}
+	var listeners []net.Listener
 	// Open unix socket
-	log.Infof("Opening socket %s", socket)
-	listener := listenSocket(log, socket)
-	defer remove(socket)
+	if socket != "" {
+		log.Infof("Opening socket %s", socket)
+		listener := listenSocket(log, socket)
+		defer remove(socket)
+		listeners = append(listeners, *listener)
+	}
+	// Open TCP listener
+	if listenAddress != "" {
+		listener, err := listenTCP(log, listenAddress, tlsConfig != nil)
+		if err != nil {
+			log.Errorf("Failed to listen on %s: %v", listenAddress, err)
+			os.Exit(1)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	httpServer := startGateway(log, srv, tlsConfig, unaryInterceptors, streamInterceptors)
 
 	// Start the server
 	log.Infof("gRPC server started!")
-	if err := grpcServer.Serve(*listener); err != nil {
-		log.Errorf("Failed to serve: %v", err)
+	served := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			served <- grpcServer.Serve(listener)
+		}(listener)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				reload(log, authorizer)
+				continue
+			}
+			log.Infof("Received %v signal, shutting down...", sig)
+		case err := <-served:
+			if err != nil {
+				log.Errorf("Failed to serve: %v", err)
+			}
+		}
+		// Sessions are stopped and flushed either way
+		shutdown(log, grpcServer, httpServer, srv)
+		if flushTraces != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := flushTraces(ctx); err != nil {
+				log.Warnf("Failed to flush traces: %v", err)
+			}
+			cancel()
+		}
+		return
 	}
 }
@@ -10,6 +10,11 @@ import (
 
 // VideoThumbnail generates a thumbnail image from a video at a specific frame.
 func VideoThumbnail(content []byte, frameNum int, size struct{ Width int }) ([]byte, error) {
+	return VideoThumbnailReader(bytes.NewReader(content), frameNum, size)
+}
+
+// VideoThumbnailReader generates a thumbnail the same way as VideoThumbnail, the video is streamed to ffmpeg
+func VideoThumbnailReader(content io.Reader, frameNum int, size struct{ Width int }) ([]byte, error) {
 	// Create pipes for input and output
 	inputReader, inputWriter := io.Pipe()
 	outputReader, outputWriter := io.Pipe()
@@ -17,7 +22,7 @@ func VideoThumbnail(content []byte, frameNum int, size struct{ Width int }) ([]b
 	// Write the input video data to the input pipe
 	go func() {
 		defer inputWriter.Close()
-		_, err := inputWriter.Write(content)
+		_, err := io.Copy(inputWriter, content)
 		if err != nil {
 			inputWriter.CloseWithError(err)
 		}
@@ -40,6 +45,9 @@ func VideoThumbnail(content []byte, frameNum int, size struct{ Width int }) ([]b
 		}
 	}()
 
+	// ffmpeg stops reading after the frame, release the writer
+	defer inputReader.Close()
+
 	// Read the output into a buffer
 	var buf bytes.Buffer
 	_, err := buf.ReadFrom(outputReader)
@@ -0,0 +1,124 @@
+// Package metrics - Prometheus metrics of the server, exposed on /metrics
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gows"
+
+var (
+	// RPCDuration - how long RPCs take, streams - for the whole stream
+	RPCDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "duration_seconds",
+		Help:      "Duration of RPCs, streaming RPCs are measured until the stream is closed",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"method"})
+	// RPCHandled - finished RPCs by the status code, everything but OK is an error
+	RPCHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "handled_total",
+		Help:      "RPCs completed on the server, by the gRPC status code",
+	}, []string{"method", "code"})
+
+	// SessionState - 1 for the current status of the session
+	SessionState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "session",
+		Name:      "state",
+		Help:      "Current status of the session (1 for the current status)",
+	}, []string{"session", "state"})
+
+	// EventsEmitted - events emitted by sessions
+	EventsEmitted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "emitted_total",
+		Help:      "Events emitted by sessions",
+	}, []string{"session", "type"})
+	// EventsDropped - events dropped for slow stream listeners
+	EventsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "dropped_total",
+		Help:      "Events dropped because the stream listener buffer was full",
+	}, []string{"session", "type"})
+
+	// MessagesSent - messages sent by sessions, result is "success" or "failure"
+	MessagesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "messages",
+		Name:      "sent_total",
+		Help:      "Messages sent by sessions, by the result (success, failure)",
+	}, []string{"session", "result"})
+
+	// StorageQueryDuration - how long queries to the session storage take
+	StorageQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "query_duration_seconds",
+		Help:      "Duration of session storage queries, by the table and the operation",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"table", "operation"})
+
+	// HistorySyncProgress - the last progress (0-100) reported by history sync
+	HistorySyncProgress = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "history_sync",
+		Name:      "progress",
+		Help:      "Last history sync progress reported by WhatsApp, 0-100",
+	}, []string{"session", "type"})
+	// HistorySyncConversations - conversations received in history sync
+	HistorySyncConversations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "history_sync",
+		Name:      "conversations_total",
+		Help:      "Conversations received in history sync",
+	}, []string{"session"})
+	// HistorySyncMessages - messages received in history sync
+	HistorySyncMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "history_sync",
+		Name:      "messages_total",
+		Help:      "Messages received in history sync",
+	}, []string{"session"})
+)
+
+// sessionVecs - metrics labeled by session, removed when the session is stopped
+var sessionVecs = []interface {
+	DeletePartialMatch(labels prometheus.Labels) int
+}{
+	SessionState,
+	EventsEmitted,
+	EventsDropped,
+	MessagesSent,
+	HistorySyncProgress,
+	HistorySyncConversations,
+	HistorySyncMessages,
+}
+
+// SetSessionState marks the status as the current one for the session
+func SetSessionState(session string, state string) {
+	SessionState.DeletePartialMatch(prometheus.Labels{"session": session})
+	SessionState.WithLabelValues(session, state).Set(1)
+}
+
+// RemoveSession removes the metrics of the stopped session
+func RemoveSession(session string) {
+	labels := prometheus.Labels{"session": session}
+	for _, vec := range sessionVecs {
+		vec.DeletePartialMatch(labels)
+	}
+}
+
+// Handler serves the metrics in the Prometheus format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
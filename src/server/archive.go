@@ -0,0 +1,112 @@
+package server
+
+import (
+	"errors"
+	"io"
+
+	"github.com/devlikeapro/gows/gows"
+	"github.com/devlikeapro/gows/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// archiveChunkSize - size of data in every SessionArchiveChunk
+const archiveChunkSize = 1024 * 1024
+
+// checkStoreNotInUse makes sure no running session uses the store
+func (s *Server) checkStoreNotInUse(store gows.StoreConfig) error {
+	for _, info := range s.Sm.List() {
+		if info.Config.Store == store {
+			return status.Errorf(codes.FailedPrecondition, "store is used by session '%s', stop it first", info.Name)
+		}
+	}
+	return nil
+}
+
+func (s *Server) ExportSession(req *__.ExportSessionRequest, stream __.MessageService_ExportSessionServer) error {
+	store, err := gows.BuildStoreConfig(req.GetStore().GetDialect(), req.GetStore().GetAddress())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	err = s.checkStoreNotInUse(store)
+	if err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		err := gows.ExportSession(stream.Context(), store, writer, s.log.Sub("Export"))
+		_ = writer.CloseWithError(err)
+	}()
+	defer reader.Close()
+
+	buf := make([]byte, archiveChunkSize)
+	for {
+		n, err := io.ReadFull(reader, buf)
+		if n > 0 {
+			sendErr := stream.Send(&__.SessionArchiveChunk{Data: buf[:n]})
+			if sendErr != nil {
+				return sendErr
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to export session: %v", err)
+		}
+	}
+}
+
+func (s *Server) ImportSession(stream __.MessageService_ImportSessionServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	store, err := gows.BuildStoreConfig(req.GetStore().GetDialect(), req.GetStore().GetAddress())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	err = s.checkStoreNotInUse(store)
+	if err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	imported := make(chan error, 1)
+	go func() {
+		err := gows.ImportSession(stream.Context(), store, reader, s.log.Sub("Import"))
+		// Unblock the receiving loop if the import stopped early
+		_ = reader.CloseWithError(err)
+		imported <- err
+	}()
+
+	for {
+		if len(req.GetData()) > 0 {
+			_, err = writer.Write(req.GetData())
+			if err != nil {
+				// The import has finished or failed, the result is below
+				break
+			}
+		}
+		req, err = stream.Recv()
+		if errors.Is(err, io.EOF) {
+			_ = writer.Close()
+			break
+		}
+		if err != nil {
+			_ = writer.CloseWithError(err)
+			<-imported
+			return err
+		}
+	}
+
+	err = <-imported
+	if errors.Is(err, gows.ErrStoreNotEmpty) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to import session: %v", err)
+	}
+	return stream.SendAndClose(&__.Empty{})
+}
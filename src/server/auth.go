@@ -0,0 +1,136 @@
+package server
+
+import (
+	"github.com/devlikeapro/gows/proto"
+	"github.com/devlikeapro/gows/wrpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+)
+
+// MethodGroups - what tokens need to call the RPCs, see wrpc.Authorizer.
+// RPCs not listed here require wrpc.GroupAdmin.
+var MethodGroups = map[string]wrpc.Group{
+	// Events
+	__.EventStream_StreamEvents_FullMethodName:         wrpc.GroupRead,
+	__.EventStream_StreamTypedEvents_FullMethodName:    wrpc.GroupRead,
+	__.EventStream_StreamSessionsEvents_FullMethodName: wrpc.GroupRead,
+
+	// Server, only the health check is public - Watch, List and session health checks (see SessionOf)
+	// expose session names
+	healthpb.Health_Check_FullMethodName:                              wrpc.GroupPublic,
+	healthpb.Health_Watch_FullMethodName:                              wrpc.GroupRead,
+	healthpb.Health_List_FullMethodName:                               wrpc.GroupRead,
+	reflectionpb.ServerReflection_ServerReflectionInfo_FullMethodName: wrpc.GroupRead,
+	__.MessageService_GetServerInfo_FullMethodName:                    wrpc.GroupRead,
+
+	// Session management
+	__.MessageService_StartSession_FullMethodName:        wrpc.GroupAdmin,
+	__.MessageService_StopSession_FullMethodName:         wrpc.GroupAdmin,
+	__.MessageService_GetSessionState_FullMethodName:     wrpc.GroupRead,
+	__.MessageService_RequestCode_FullMethodName:         wrpc.GroupAdmin,
+	__.MessageService_Logout_FullMethodName:              wrpc.GroupAdmin,
+	__.MessageService_ListSessions_FullMethodName:        wrpc.GroupRead,
+	__.MessageService_UpdateSessionConfig_FullMethodName: wrpc.GroupAdmin,
+	__.MessageService_GetSendQueue_FullMethodName:        wrpc.GroupRead,
+	__.MessageService_SetLogLevel_FullMethodName:         wrpc.GroupAdmin,
+	__.MessageService_ExportSession_FullMethodName:       wrpc.GroupAdmin,
+	__.MessageService_ImportSession_FullMethodName:       wrpc.GroupAdmin,
+
+	// Profile
+	__.MessageService_SetProfileName_FullMethodName:    wrpc.GroupSend,
+	__.MessageService_SetProfileStatus_FullMethodName:  wrpc.GroupSend,
+	__.MessageService_SetProfilePicture_FullMethodName: wrpc.GroupSend,
+
+	// Lids
+	__.MessageService_GetAllLids_FullMethodName:           wrpc.GroupRead,
+	__.MessageService_GetLidsCount_FullMethodName:         wrpc.GroupRead,
+	__.MessageService_FindPNByLid_FullMethodName:          wrpc.GroupRead,
+	__.MessageService_FindLIDByPhoneNumber_FullMethodName: wrpc.GroupRead,
+
+	// Groups
+	__.MessageService_FetchGroups_FullMethodName:             wrpc.GroupRead,
+	__.MessageService_GetGroups_FullMethodName:               wrpc.GroupRead,
+	__.MessageService_GetGroupInfo_FullMethodName:            wrpc.GroupRead,
+	__.MessageService_CreateGroup_FullMethodName:             wrpc.GroupSend,
+	__.MessageService_LeaveGroup_FullMethodName:              wrpc.GroupSend,
+	__.MessageService_GetGroupInviteLink_FullMethodName:      wrpc.GroupRead,
+	__.MessageService_RevokeGroupInviteLink_FullMethodName:   wrpc.GroupSend,
+	__.MessageService_GetGroupInfoFromLink_FullMethodName:    wrpc.GroupRead,
+	__.MessageService_JoinGroupWithLink_FullMethodName:       wrpc.GroupSend,
+	__.MessageService_SetGroupName_FullMethodName:            wrpc.GroupSend,
+	__.MessageService_SetGroupDescription_FullMethodName:     wrpc.GroupSend,
+	__.MessageService_SetGroupPicture_FullMethodName:         wrpc.GroupSend,
+	__.MessageService_SetGroupLocked_FullMethodName:          wrpc.GroupSend,
+	__.MessageService_SetGroupAnnounce_FullMethodName:        wrpc.GroupSend,
+	__.MessageService_UpdateGroupParticipants_FullMethodName: wrpc.GroupSend,
+
+	// Contacts and presence
+	__.MessageService_GetProfilePicture_FullMethodName: wrpc.GroupRead,
+	__.MessageService_SendPresence_FullMethodName:      wrpc.GroupSend,
+	__.MessageService_SendChatPresence_FullMethodName:  wrpc.GroupSend,
+	__.MessageService_SubscribePresence_FullMethodName: wrpc.GroupRead,
+	__.MessageService_CheckPhones_FullMethodName:       wrpc.GroupRead,
+	__.MessageService_MarkChatUnread_FullMethodName:    wrpc.GroupSend,
+	__.MessageService_UpdateContact_FullMethodName:     wrpc.GroupSend,
+	__.MessageService_GetContacts_FullMethodName:       wrpc.GroupRead,
+	__.MessageService_GetContactById_FullMethodName:    wrpc.GroupRead,
+
+	// Messages
+	__.MessageService_GenerateNewMessageID_FullMethodName: wrpc.GroupSend,
+	__.MessageService_SendMessage_FullMethodName:          wrpc.GroupSend,
+	__.MessageService_SendReaction_FullMethodName:         wrpc.GroupSend,
+	__.MessageService_MarkRead_FullMethodName:             wrpc.GroupSend,
+	__.MessageService_EditMessage_FullMethodName:          wrpc.GroupSend,
+	__.MessageService_RevokeMessage_FullMethodName:        wrpc.GroupSend,
+	__.MessageService_SendButtonReply_FullMethodName:      wrpc.GroupSend,
+	__.MessageService_SendButtons_FullMethodName:          wrpc.GroupSend,
+	__.MessageService_CancelEventMessage_FullMethodName:   wrpc.GroupSend,
+	__.MessageService_DownloadMedia_FullMethodName:        wrpc.GroupRead,
+	__.MessageService_DownloadMediaStream_FullMethodName:  wrpc.GroupRead,
+	__.MessageService_UploadMedia_FullMethodName:          wrpc.GroupSend,
+	__.MessageService_RejectCall_FullMethodName:           wrpc.GroupSend,
+	__.MessageService_GetMessageById_FullMethodName:       wrpc.GroupRead,
+	__.MessageService_GetMessages_FullMethodName:          wrpc.GroupRead,
+	__.MessageService_GetChats_FullMethodName:             wrpc.GroupRead,
+
+	// Outbox
+	__.MessageService_EnqueueMessage_FullMethodName:      wrpc.GroupSend,
+	__.MessageService_ListQueuedMessages_FullMethodName:  wrpc.GroupRead,
+	__.MessageService_CancelQueuedMessage_FullMethodName: wrpc.GroupSend,
+
+	// Newsletters
+	__.MessageService_GetSubscribedNewsletters_FullMethodName:      wrpc.GroupRead,
+	__.MessageService_GetNewsletterInfo_FullMethodName:             wrpc.GroupRead,
+	__.MessageService_GetNewsletterMessagesByInvite_FullMethodName: wrpc.GroupRead,
+	__.MessageService_SearchNewslettersByView_FullMethodName:       wrpc.GroupRead,
+	__.MessageService_SearchNewslettersByText_FullMethodName:       wrpc.GroupRead,
+	__.MessageService_CreateNewsletter_FullMethodName:              wrpc.GroupSend,
+	__.MessageService_NewsletterToggleMute_FullMethodName:          wrpc.GroupSend,
+	__.MessageService_NewsletterToggleFollow_FullMethodName:        wrpc.GroupSend,
+
+	// Labels
+	__.MessageService_GetLabels_FullMethodName:         wrpc.GroupRead,
+	__.MessageService_UpsertLabel_FullMethodName:       wrpc.GroupSend,
+	__.MessageService_DeleteLabel_FullMethodName:       wrpc.GroupSend,
+	__.MessageService_AddChatLabel_FullMethodName:      wrpc.GroupSend,
+	__.MessageService_RemoveChatLabel_FullMethodName:   wrpc.GroupSend,
+	__.MessageService_GetLabelsByJid_FullMethodName:    wrpc.GroupRead,
+	__.MessageService_GetChatsByLabelId_FullMethodName: wrpc.GroupRead,
+}
+
+// SessionOf returns the session the request is about, empty if it's not about a single session
+func SessionOf(req interface{}) string {
+	switch r := req.(type) {
+	case *__.Session:
+		return r.GetId()
+	case *__.StartSessionRequest:
+		return r.GetId()
+	case *__.StreamEventsRequest:
+		return r.GetId()
+	case interface{ GetSession() *__.Session }:
+		return r.GetSession().GetId()
+	case *healthpb.HealthCheckRequest:
+		return sessionOfHealthService(r.GetService())
+	}
+	return ""
+}
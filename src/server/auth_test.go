@@ -0,0 +1,45 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/devlikeapro/gows/proto"
+	"github.com/devlikeapro/gows/wrpc"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Every RPC must be put into a group explicitly, otherwise it silently requires admin
+func TestMethodGroups(t *testing.T) {
+	for _, desc := range []grpc.ServiceDesc{__.MessageService_ServiceDesc, __.EventStream_ServiceDesc} {
+		for _, method := range desc.Methods {
+			name := "/" + desc.ServiceName + "/" + method.MethodName
+			assert.Contains(t, MethodGroups, name)
+		}
+		for _, stream := range desc.Streams {
+			name := "/" + desc.ServiceName + "/" + stream.StreamName
+			assert.Contains(t, MethodGroups, name)
+		}
+	}
+}
+
+// Only the health check is public, the rest exposes session names
+func TestPublicMethods(t *testing.T) {
+	var public []string
+	for method, group := range MethodGroups {
+		if group == wrpc.GroupPublic {
+			public = append(public, method)
+		}
+	}
+	assert.Equal(t, []string{healthpb.Health_Check_FullMethodName}, public)
+}
+
+func TestSessionOf(t *testing.T) {
+	assert.Equal(t, "a", SessionOf(&__.Session{Id: "a"}))
+	assert.Equal(t, "b", SessionOf(&__.StreamEventsRequest{Id: "b"}))
+	assert.Equal(t, "c", SessionOf(&__.MessageRequest{Session: &__.Session{Id: "c"}, Id: "message-id"}))
+	assert.Equal(t, "", SessionOf(&__.Empty{}))
+	assert.Equal(t, "d", SessionOf(&healthpb.HealthCheckRequest{Service: SessionHealthService("d")}))
+	assert.Equal(t, "", SessionOf(&healthpb.HealthCheckRequest{}))
+}
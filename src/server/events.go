@@ -1,10 +1,18 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"github.com/devlikeapro/gows/gows"
+	"github.com/devlikeapro/gows/metrics"
 	"github.com/devlikeapro/gows/proto"
+	"github.com/devlikeapro/gows/storage"
 	"github.com/google/uuid"
+	"go.mau.fi/whatsmeow/types"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"reflect"
 	"strings"
 )
@@ -26,91 +34,349 @@ func (s *Server) safeMarshal(v interface{}) (result string) {
 	return result
 }
 
-func (s *Server) StreamEvents(req *__.Session, stream grpc.ServerStreamingServer[__.EventJson]) error {
+// ServerShutdown is the last event sent to every stream before the server shuts down
+type ServerShutdown struct {
+	Reason string
+}
+
+func eventTypeOf(event interface{}) string {
+	if named, ok := event.(gows.NamedEvent); ok {
+		return named.EventName()
+	}
+	// Remove * at the start if it's *
+	eventType := reflect.TypeOf(event).String()
+	return strings.TrimPrefix(eventType, "*")
+}
+
+func (s *Server) toEventJson(session string, event interface{}) *__.EventJson {
+	eventType := eventTypeOf(event)
+
+	jsonString := s.safeMarshal(event)
+	if jsonString == "" {
+		return nil
+	}
+
+	return &__.EventJson{
+		Session: session,
+		Event:   eventType,
+		Data:    jsonString,
+	}
+}
+
+// journalBatchSize - how many events are read from the journal at once on replay
+const journalBatchSize = 1000
+
+// notJournaledEvents - bulk and noisy events, they would push everything else out of the journal.
+// They are delivered live only - and not even marshaled if no listener or webhook wants them.
+var notJournaledEvents = map[string]bool{
+	"events.HistorySync":          true,
+	"events.Presence":             true,
+	"events.ChatPresence":         true,
+	"events.Receipt":              true,
+	"events.AppState":             true,
+	"events.AppStateSyncComplete": true,
+}
+
+// maxJournaledEventSize - bigger events are delivered live only
+const maxJournaledEventSize = 256 * 1024
+
+// journaled tells if events of the type are recorded in the journal and can be replayed
+func journaled(eventType string) bool {
+	return !notJournaledEvents[eventType]
+}
+
+// forwardEvent records the session event in the journal and sends it to the session listeners and webhooks.
+// The event is marshaled once for the journal and all listeners, filters look at the event itself -
+// it's not marshaled at all if nobody needs it.
+func (s *Server) forwardEvent(session string, cli *gows.GoWS, event interface{}) {
+	if status, ok := event.(*gows.SessionStatusEvent); ok {
+		s.setSessionStatus(session, status.Status)
+	}
+	meta := eventMetaOf(event)
+	metrics.EventsEmitted.WithLabelValues(session, meta.Type).Inc()
+	listeners := s.matchingListeners(session, meta)
+	webhook := cli.HasWebhook(meta.Type)
+	if len(listeners) == 0 && !webhook && !journaled(meta.Type) {
+		return
+	}
+	data := s.toEventJson(session, event)
+	if data == nil {
+		return
+	}
+	if journaled(data.Event) && len(data.Data) <= maxJournaledEventSize {
+		journal := &storage.JournalEvent{Event: data.Event, FromMe: meta.FromMe, Data: data.Data}
+		if !meta.Chat.IsEmpty() {
+			journal.Jid = meta.Chat.String()
+		}
+		sequence, err := cli.Storage.Events.Append(journal)
+		if err != nil {
+			s.log.Warnf("Error recording event %s for session %s, it can't be replayed: %v", data.Event, session, err)
+		}
+		data.Sequence = sequence
+	}
+	streamed := &streamEvent{EventJson: data, raw: event}
+	for _, listener := range listeners {
+		listener.deliver(streamed)
+	}
+	if webhook {
+		cli.DispatchWebhook(&gows.WebhookEvent{
+			Session:  session,
+			Event:    data.Event,
+			Sequence: data.Sequence,
+			Data:     json.RawMessage(data.Data),
+		})
+	}
+}
+
+// journalEventMeta restores what filters look at from the journal
+func journalEventMeta(event *storage.JournalEvent) eventMeta {
+	meta := eventMeta{Type: event.Event, FromMe: event.FromMe}
+	if event.Jid != "" {
+		meta.Chat, _ = types.ParseJID(event.Jid)
+	}
+	return meta
+}
+
+func (s *Server) getJournal(session string) (storage.EventJournal, error) {
+	cli, err := s.Sm.Get(session)
+	if err != nil {
+		return nil, err
+	}
+	return cli.Storage.Events, nil
+}
+
+// eventStream sends events in the format the client has asked for
+type eventStream interface {
+	Context() context.Context
+	Send(event *streamEvent) error
+}
+
+type jsonEventStream struct {
+	stream grpc.ServerStreamingServer[__.EventJson]
+}
+
+func (s jsonEventStream) Context() context.Context {
+	return s.stream.Context()
+}
+
+func (s jsonEventStream) Send(event *streamEvent) error {
+	return s.stream.Send(event.EventJson)
+}
+
+type typedEventStream struct {
+	stream grpc.ServerStreamingServer[__.Event]
+}
+
+func (s typedEventStream) Context() context.Context {
+	return s.stream.Context()
+}
+
+func (s typedEventStream) Send(event *streamEvent) error {
+	return s.stream.Send(event.Typed())
+}
+
+func (s *Server) StreamEvents(req *__.StreamEventsRequest, stream grpc.ServerStreamingServer[__.EventJson]) error {
+	return s.streamEvents(req, jsonEventStream{stream: stream})
+}
+
+// StreamTypedEvents streams the same events as StreamEvents in the typed envelope
+func (s *Server) StreamTypedEvents(req *__.StreamEventsRequest, stream grpc.ServerStreamingServer[__.Event]) error {
+	return s.streamEvents(req, typedEventStream{stream: stream})
+}
+
+func (s *Server) streamEvents(req *__.StreamEventsRequest, stream eventStream) error {
 	sessionName := req.GetId()
+	filter, err := newEventFilter(req.GetFilter())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
 	streamId := uuid.New()
-	listener := s.addListener(sessionName, streamId)
+	// Listen before replaying, so nothing is lost in between - duplicates are skipped by sequence
+	listener := s.newListener(streamId, filter, req)
+	s.addListener(sessionName, listener)
 	defer s.removeListener(sessionName, streamId)
+
+	// last - the sequence of the last sent event
+	var last uint64
+	if req.SinceSequence != nil {
+		last = req.GetSinceSequence()
+		err = s.resume(sessionName, filter, &last, stream)
+		if err != nil {
+			return err
+		}
+	}
+	return s.runStream(sessionName, listener, &last, stream)
+}
+
+// StreamSessionsEvents streams events of all sessions matching the request in one stream,
+// including sessions started later. Events can't be replayed - sequences are per session.
+func (s *Server) StreamSessionsEvents(req *__.StreamSessionsEventsRequest, stream grpc.ServerStreamingServer[__.EventJson]) error {
+	filter, err := newEventFilter(req.GetFilter())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	listener := s.newListener(uuid.New(), filter, req)
+	listener.sessions = newSessionMatcher(req.GetSessions(), req.GetPrefix())
+	s.addSessionsListener(listener)
+	defer s.removeSessionsListener(listener.id)
+
+	var last uint64
+	return s.runStream("", listener, &last, jsonEventStream{stream: stream})
+}
+
+// runStream sends listener events to the stream until it's closed, the server is shutting down
+// or the consumer is too slow (DISCONNECT policy)
+func (s *Server) runStream(sessionName string, listener *listener, last *uint64, stream eventStream) error {
 	for {
 		select {
 		case <-stream.Context().Done():
 			return stream.Context().Err()
-		case event := <-listener:
-			// Remove * at the start if it's *
-			eventType := reflect.TypeOf(event).String()
-			eventType = strings.TrimPrefix(eventType, "*")
-
-			jsonString := s.safeMarshal(event)
-			if jsonString == "" {
-				continue
-			}
-
-			data := __.EventJson{
-				Session: sessionName,
-				Event:   eventType,
-				Data:    jsonString,
-			}
-			err := stream.Send(&data)
+		case <-s.shutdown:
+			return s.closeStream(sessionName, listener, last, stream)
+		case <-listener.slow:
+			return status.Error(codes.ResourceExhausted, "the stream is too slow to keep up with events, disconnected")
+		case event := <-listener.ch:
+			err := s.sendEvent(sessionName, listener, event, last, stream)
 			if err != nil {
 				return err
 			}
+			// Caught up with the buffer - deliver what has been dropped meanwhile
+			if len(listener.ch) == 0 {
+				err = s.catchUp(sessionName, listener, last, stream)
+				if err != nil {
+					return err
+				}
+			}
 		}
 	}
 }
 
-func (s *Server) SendEventToAllListeners(session string, event interface{}) {
-	listeners := s.getListeners(session)
-	for _, listener := range listeners {
-		// Drop the event if the listener buffer is full to avoid blocking and goroutine leaks.
-		select {
-		case listener.ch <- event:
-		default:
-			s.log.Warnf("Dropping event for slow listener %s, session %s", listener.id.String(), session)
-		}
+// resume replays the journal after the last sequence, fails if some events are not in the journal anymore
+func (s *Server) resume(session string, filter *eventFilter, last *uint64, stream eventStream) error {
+	journal, err := s.getJournal(session)
+	if errors.Is(err, gows.ErrSessionNotFound) {
+		return status.Errorf(codes.FailedPrecondition, "session '%s' is not running, events can't be replayed", session)
+	}
+	if err != nil {
+		return err
+	}
+	oldest, lastAssigned, err := journal.Bounds()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to read events journal: %v", err)
+	}
+	since := *last
+	if since > lastAssigned {
+		return status.Errorf(codes.OutOfRange, "sequence %d is ahead of the journal, the last one is %d", since, lastAssigned)
 	}
+	if since < lastAssigned && (oldest == 0 || since+1 < oldest) {
+		return status.Errorf(codes.OutOfRange, "events after %d are not in the journal anymore, the oldest one is %d", since, oldest)
+	}
+	return s.replay(session, journal, filter, 0, last, stream)
 }
 
-func (s *Server) addListener(session string, id uuid.UUID) chan interface{} {
-	s.listenersLock.Lock()
-	defer s.listenersLock.Unlock()
-
-	listener := make(chan interface{}, 100)
-	sessionListeners, ok := s.listeners[session]
-	if !ok {
-		sessionListeners = map[uuid.UUID]chan interface{}{}
-		s.listeners[session] = sessionListeners
+// replay sends journal events matching the filter after the last sent one
+// and before the until sequence (0 - up to the end)
+func (s *Server) replay(session string, journal storage.EventJournal, filter *eventFilter, until uint64, last *uint64, stream eventStream) error {
+	for {
+		events, err := journal.Since(*last, journalBatchSize)
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to read events journal: %v", err)
+		}
+		for _, event := range events {
+			if until != 0 && event.Sequence >= until {
+				return nil
+			}
+			*last = event.Sequence
+			if !filter.match(journalEventMeta(event)) {
+				continue
+			}
+			err = stream.Send(&streamEvent{EventJson: &__.EventJson{
+				Session:  session,
+				Event:    event.Event,
+				Data:     event.Data,
+				Sequence: event.Sequence,
+			}})
+			if err != nil {
+				return err
+			}
+		}
+		if len(events) < journalBatchSize {
+			return nil
+		}
 	}
-	sessionListeners[id] = listener
-	return listener
 }
 
-func (s *Server) removeListener(session string, id uuid.UUID) {
-	s.listenersLock.Lock()
-	defer s.listenersLock.Unlock()
-	listener, ok := s.listeners[session][id]
-	if !ok {
-		return
+// sendEvent sends the event unless it has been sent already (replayed).
+// Events dropped before it are delivered first.
+func (s *Server) sendEvent(session string, listener *listener, event *streamEvent, last *uint64, stream eventStream) error {
+	if listener.sessions != nil {
+		// Sequences of different sessions can't be compared
+		return stream.Send(event)
+	}
+	if event.Sequence != 0 && event.Sequence > *last+1 && listener.hasDropped() {
+		err := s.catchUp(session, listener, last, stream)
+		if err != nil {
+			return err
+		}
 	}
-	delete(s.listeners[session], id)
-	// if it's the last listener, remove the session
-	if len(s.listeners[session]) == 0 {
-		delete(s.listeners, session)
+	if event.Sequence != 0 && *last != 0 && event.Sequence <= *last {
+		return nil
 	}
-	close(listener)
+	err := stream.Send(event)
+	if err != nil {
+		return err
+	}
+	if event.Sequence != 0 {
+		*last = event.Sequence
+	}
+	return nil
 }
 
-type listenerEntry struct {
-	id uuid.UUID
-	ch chan interface{}
+// catchUp replays events dropped for the full listener buffer from the journal.
+// If they can't be replayed (not journaled, trimmed already or a multi-session stream) -
+// sends events.dropped, so the consumer can resync.
+func (s *Server) catchUp(session string, listener *listener, last *uint64, stream eventStream) error {
+	dropped := listener.takeDropped()
+	if dropped == nil {
+		return nil
+	}
+	if dropped.unsequenced == 0 {
+		journal, err := s.getJournal(session)
+		if err == nil {
+			var oldest uint64
+			oldest, _, err = journal.Bounds()
+			if err == nil && oldest != 0 && oldest <= dropped.FromSequence {
+				// Do not replay events before the dropped ones - the stream hasn't asked for them
+				if *last < dropped.FromSequence-1 {
+					*last = dropped.FromSequence - 1
+				}
+				return s.replay(session, journal, listener.filter, 0, last, stream)
+			}
+		}
+		if err != nil {
+			s.log.Warnf("Can't replay dropped events for session %s: %v", session, err)
+		}
+	}
+	s.log.Warnf("Lost %d event(s) for slow listener %s, session %s", dropped.Count, listener.id.String(), session)
+	return stream.Send(&streamEvent{EventJson: s.toEventJson(session, dropped), raw: dropped})
 }
 
-func (s *Server) getListeners(session string) []listenerEntry {
-	s.listenersLock.RLock()
-	defer s.listenersLock.RUnlock()
-	sessionListeners := s.listeners[session]
-	listeners := make([]listenerEntry, 0, len(sessionListeners))
-	for id, listener := range sessionListeners {
-		listeners = append(listeners, listenerEntry{id: id, ch: listener})
+// closeStream sends events left in the listener buffer and the final ServerShutdown event
+func (s *Server) closeStream(session string, listener *listener, last *uint64, stream eventStream) error {
+	for {
+		select {
+		case event := <-listener.ch:
+			err := s.sendEvent(session, listener, event, last, stream)
+			if err != nil {
+				return err
+			}
+		default:
+			err := s.catchUp(session, listener, last, stream)
+			if err != nil {
+				return err
+			}
+			shutdown := &ServerShutdown{Reason: "server shutting down"}
+			return stream.Send(&streamEvent{EventJson: s.toEventJson(session, shutdown), raw: shutdown})
+		}
 	}
-	return listeners
 }
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/devlikeapro/gows/gows"
+	"github.com/devlikeapro/gows/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// eventMeta is what stream filters look at, taken from the event before it's marshaled
+type eventMeta struct {
+	Type string
+	// Chat - empty if the event is not about a chat
+	Chat types.JID
+	// FromMe - nil if the event is not about a message
+	FromMe *bool
+}
+
+func eventMetaOf(event interface{}) eventMeta {
+	meta := eventMeta{Type: eventTypeOf(event)}
+	fromMe := func(value bool) *bool { return &value }
+	switch evt := event.(type) {
+	case *events.Message:
+		meta.Chat, meta.FromMe = evt.Info.Chat, fromMe(evt.Info.IsFromMe)
+	case *gows.OutboxEvent:
+		meta.Chat, meta.FromMe = evt.Jid, fromMe(true)
+	case *gows.PollVoteEvent:
+		meta.Chat, meta.FromMe = evt.Message.Info.Chat, fromMe(evt.Message.Info.IsFromMe)
+	case *gows.EventMessageResponse:
+		meta.Chat, meta.FromMe = evt.Message.Info.Chat, fromMe(evt.Message.Info.IsFromMe)
+	case *events.UndecryptableMessage:
+		meta.Chat, meta.FromMe = evt.Info.Chat, fromMe(evt.Info.IsFromMe)
+	case *events.Receipt:
+		meta.Chat, meta.FromMe = evt.Chat, fromMe(evt.IsFromMe)
+	case *events.ChatPresence:
+		meta.Chat = evt.Chat
+	case *events.Presence:
+		meta.Chat = evt.From
+	case *events.GroupInfo:
+		meta.Chat = evt.JID
+	case *events.JoinedGroup:
+		meta.Chat = evt.JID
+	case *events.Picture:
+		meta.Chat = evt.JID
+	case *events.Archive:
+		meta.Chat = evt.JID
+	case *events.Pin:
+		meta.Chat = evt.JID
+	case *events.Mute:
+		meta.Chat = evt.JID
+	case *events.MarkChatAsRead:
+		meta.Chat = evt.JID
+	case *events.ClearChat:
+		meta.Chat = evt.JID
+	case *events.DeleteChat:
+		meta.Chat = evt.JID
+	case *events.DeleteForMe:
+		meta.Chat = evt.ChatJID
+	case *events.Star:
+		meta.Chat = evt.ChatJID
+	case *events.LabelAssociationChat:
+		meta.Chat = evt.JID
+	case *events.CallOffer:
+		meta.Chat = evt.CallCreator
+	}
+	meta.Chat = meta.Chat.ToNonAD()
+	return meta
+}
+
+// eventFilter decides which events a stream gets
+type eventFilter struct {
+	include map[string]bool
+	exclude map[string]bool
+	jids    map[types.JID]bool
+	groups  *bool
+	fromMe  *bool
+}
+
+// newEventFilter parses the filter from the request, nil if the stream gets all events
+func newEventFilter(filter *__.EventFilter) (*eventFilter, error) {
+	if filter == nil {
+		return nil, nil
+	}
+	f := &eventFilter{
+		include: toSet(filter.Include),
+		exclude: toSet(filter.Exclude),
+		groups:  filter.Groups,
+		fromMe:  filter.FromMe,
+	}
+	if len(filter.Jids) > 0 {
+		f.jids = make(map[types.JID]bool, len(filter.Jids))
+		for _, jid := range filter.Jids {
+			parsed, err := types.ParseJID(jid)
+			if err != nil {
+				return nil, fmt.Errorf("invalid jid in filter '%s': %w", jid, err)
+			}
+			f.jids[parsed.ToNonAD()] = true
+		}
+	}
+	return f, nil
+}
+
+func toSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+// match tells if the event passes the filter.
+// Chat filters apply to events about a chat only, fromMe - to events about a message only,
+// other events pass them (use exclude to drop them).
+func (f *eventFilter) match(meta eventMeta) bool {
+	if f == nil {
+		return true
+	}
+	if f.include != nil && !f.include[meta.Type] {
+		return false
+	}
+	if f.exclude[meta.Type] {
+		return false
+	}
+	if !meta.Chat.IsEmpty() {
+		if f.jids != nil && !f.jids[meta.Chat] {
+			return false
+		}
+		if f.groups != nil && *f.groups != (meta.Chat.Server == types.GroupServer) {
+			return false
+		}
+	}
+	if meta.FromMe != nil && f.fromMe != nil && *f.fromMe != *meta.FromMe {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/devlikeapro/gows/gows"
+	"github.com/devlikeapro/gows/proto"
+	"github.com/devlikeapro/gows/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestNewEventFilter(t *testing.T) {
+	filter, err := newEventFilter(nil)
+	require.NoError(t, err)
+	assert.Nil(t, filter)
+
+	_, err = newEventFilter(&__.EventFilter{Jids: []string{"123:x@s.whatsapp.net"}})
+	assert.Error(t, err)
+
+	// Device part is ignored, events come from all devices of the chat
+	filter, err = newEventFilter(&__.EventFilter{Jids: []string{"123:5@s.whatsapp.net"}})
+	require.NoError(t, err)
+	assert.True(t, filter.jids[types.NewJID("123", types.DefaultUserServer)])
+}
+
+func TestEventFilterMatch(t *testing.T) {
+	yes, no := true, false
+	user := types.NewJID("123", types.DefaultUserServer)
+	other := types.NewJID("456", types.DefaultUserServer)
+	group := types.NewJID("789", types.GroupServer)
+	message := func(chat types.JID, fromMe bool) eventMeta {
+		return eventMeta{Type: "events.Message", Chat: chat, FromMe: &fromMe}
+	}
+	status := eventMeta{Type: "session.status"}
+
+	cases := []struct {
+		name   string
+		filter *__.EventFilter
+		meta   eventMeta
+		match  bool
+	}{
+		{"no filter", nil, message(user, false), true},
+		{"include", &__.EventFilter{Include: []string{"events.Message"}}, message(user, false), true},
+		{"include other", &__.EventFilter{Include: []string{"events.Receipt"}}, message(user, false), false},
+		{"exclude", &__.EventFilter{Exclude: []string{"events.Message"}}, message(user, false), false},
+		{"exclude other", &__.EventFilter{Exclude: []string{"events.Receipt"}}, message(user, false), true},
+		{"exclude wins", &__.EventFilter{Include: []string{"events.Message"}, Exclude: []string{"events.Message"}}, message(user, false), false},
+		{"chat", &__.EventFilter{Jids: []string{user.String()}}, message(user, false), true},
+		{"other chat", &__.EventFilter{Jids: []string{user.String()}}, message(other, false), false},
+		{"chat - not about a chat", &__.EventFilter{Jids: []string{user.String()}}, status, true},
+		{"groups only", &__.EventFilter{Groups: &yes}, message(group, false), true},
+		{"groups only - direct chat", &__.EventFilter{Groups: &yes}, message(user, false), false},
+		{"no groups - group", &__.EventFilter{Groups: &no}, message(group, false), false},
+		{"fromMe", &__.EventFilter{FromMe: &yes}, message(user, true), true},
+		{"fromMe - from others", &__.EventFilter{FromMe: &yes}, message(user, false), false},
+		{"not fromMe", &__.EventFilter{FromMe: &no}, message(user, false), true},
+		{"fromMe - not about a message", &__.EventFilter{FromMe: &yes}, status, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			filter, err := newEventFilter(c.filter)
+			require.NoError(t, err)
+			assert.Equal(t, c.match, filter.match(c.meta))
+		})
+	}
+}
+
+type countingJournal struct {
+	storage.EventJournal
+	appended []string
+}
+
+func (j *countingJournal) Append(event *storage.JournalEvent) (uint64, error) {
+	j.appended = append(j.appended, event.Event)
+	return uint64(len(j.appended)), nil
+}
+
+// marshalCountingEvent counts how many times the event is marshaled
+type marshalCountingEvent struct {
+	name      string
+	marshaled *int
+}
+
+func (e *marshalCountingEvent) EventName() string {
+	return e.name
+}
+
+func (e *marshalCountingEvent) MarshalJSON() ([]byte, error) {
+	*e.marshaled++
+	return []byte("{}"), nil
+}
+
+func TestForwardEventSkipsUnwanted(t *testing.T) {
+	s := &Server{listeners: map[string]map[uuid.UUID]*listener{}, sessionsListeners: map[uuid.UUID]*listener{}}
+	journal := &countingJournal{}
+	cli := &gows.GoWS{Storage: &storage.Storage{Events: journal}}
+
+	// Not journaled, nobody listens - not even marshaled
+	marshaled := 0
+	s.forwardEvent("default", cli, &marshalCountingEvent{name: "events.HistorySync", marshaled: &marshaled})
+	s.forwardEvent("default", cli, &marshalCountingEvent{name: "events.Presence", marshaled: &marshaled})
+	assert.Zero(t, marshaled)
+	assert.Empty(t, journal.appended)
+
+	// Journaled events are recorded for replay
+	s.forwardEvent("default", cli, &events.Message{})
+	assert.Equal(t, []string{"events.Message"}, journal.appended)
+
+	// Listeners get the events their filters pass
+	filter, err := newEventFilter(&__.EventFilter{Include: []string{"events.HistorySync"}})
+	require.NoError(t, err)
+	l := &listener{id: uuid.New(), ch: make(chan *streamEvent, 10), filter: filter}
+	s.addListener("default", l)
+	s.forwardEvent("default", cli, &events.HistorySync{})
+	s.forwardEvent("default", cli, &events.Receipt{})
+	require.Len(t, l.ch, 1)
+	event := <-l.ch
+	assert.Equal(t, "events.HistorySync", event.Event)
+	assert.Zero(t, event.Sequence)
+
+	// Filtered out presence is neither marshaled nor journaled
+	s.forwardEvent("default", cli, &marshalCountingEvent{name: "events.Presence", marshaled: &marshaled})
+	assert.Zero(t, marshaled)
+	assert.Empty(t, l.ch)
+	assert.Equal(t, []string{"events.Message"}, journal.appended)
+}
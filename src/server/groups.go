@@ -28,7 +28,7 @@ func (s *Server) FetchGroups(ctx context.Context, req *__.Session) (*__.Empty, e
 	if err != nil {
 		return nil, err
 	}
-	err = cli.Storage.Groups.FetchGroups(true)
+	err = cli.Storage.Groups.FetchGroups(ctx, true)
 	if err != nil {
 		return nil, err
 	}
@@ -44,7 +44,7 @@ func (s *Server) GetGroupInfo(ctx context.Context, req *__.JidRequest) (*__.Json
 	if err != nil {
 		return nil, err
 	}
-	info, err := cli.Storage.Groups.GetGroup(jid)
+	info, err := cli.Storage.Groups.GetGroup(ctx, jid)
 	if err != nil {
 		return nil, err
 	}
@@ -2,12 +2,14 @@ package server
 
 import (
 	"sync"
+	"time"
 
 	"github.com/devlikeapro/gows/gows"
 	gowsLog "github.com/devlikeapro/gows/log"
 	pb "github.com/devlikeapro/gows/proto"
 	"github.com/google/uuid"
 	waLog "go.mau.fi/whatsmeow/util/log"
+	"google.golang.org/grpc/health"
 )
 
 // assert that Server implements pb.MessageServiceServer
@@ -21,17 +23,93 @@ type Server struct {
 	pb.UnsafeEventStreamServer
 	Sm  *gows.SessionManager
 	log waLog.Logger
+	cfg Config
+	// Health reports the server and sessions health (grpc.health.v1), see SessionHealthService
+	Health    *health.Server
+	startedAt time.Time
 
 	// session id -> id -> event channel
-	listeners     map[string]map[uuid.UUID]chan interface{}
-	listenersLock sync.RWMutex
+	listeners map[string]map[uuid.UUID]*listener
+	// multi-session streams, id -> listener
+	sessionsListeners map[uuid.UUID]*listener
+	listenersLock     sync.RWMutex
+
+	// forwarders - goroutines passing session events to listeners
+	forwarders sync.WaitGroup
+	// shutdown is closed when the server is shutting down, streams must finish
+	shutdown     chan struct{}
+	streamsOnce  sync.Once
+	shutdownOnce sync.Once
+
+	// uploads - media uploaded with UploadMedia
+	uploads *uploadSpool
+	// idempotency - send requests with idempotency keys in progress
+	idempotency idempotency
+}
+
+// Config contains configuration for the Server
+type Config struct {
+	// Manager configures the underlying SessionManager
+	Manager gows.ManagerConfig
+	// StreamBuffer - events buffered for a stream unless it asks for another size
+	StreamBuffer int
+	// StreamBlockTimeout - how long BLOCK streams hold the session events before dropping them
+	StreamBlockTimeout time.Duration
+	// UploadDir - where UploadMedia keeps files until they're sent, a directory in os.TempDir() if empty
+	UploadDir string
+	// UploadTTL - how long uploaded media can be used, DefaultUploadTTL if 0
+	UploadTTL time.Duration
+	// UploadMaxSize - the largest media accepted by UploadMedia, DefaultUploadMaxSize if 0
+	UploadMaxSize int64
 }
 
-func NewServer() *Server {
-	return &Server{
-		Sm:            gows.NewSessionManager(),
-		log:           gowsLog.Stdout("gRPC", "INFO", false),
-		listeners:     map[string]map[uuid.UUID]chan interface{}{},
-		listenersLock: sync.RWMutex{},
+// NewServer creates a server with the config, zero values fall back to defaults
+func NewServer(cfg Config) *Server {
+	if cfg.StreamBuffer <= 0 {
+		cfg.StreamBuffer = 100
+	}
+	if cfg.StreamBlockTimeout <= 0 {
+		cfg.StreamBlockTimeout = 5 * time.Second
+	}
+	s := &Server{
+		log:               gowsLog.Server("gRPC"),
+		cfg:               cfg,
+		Health:            newHealthServer(),
+		startedAt:         time.Now(),
+		listeners:         map[string]map[uuid.UUID]*listener{},
+		sessionsListeners: map[uuid.UUID]*listener{},
+		listenersLock:     sync.RWMutex{},
+		shutdown:          make(chan struct{}),
+		uploads:           newUploadSpool(cfg.UploadDir, cfg.UploadTTL, cfg.UploadMaxSize),
 	}
+	if cfg.Manager.OutboxSender == nil {
+		cfg.Manager.OutboxSender = s.sendQueuedMessage
+	}
+	s.Sm = gows.NewSessionManager(cfg.Manager)
+	go s.uploads.run(s.shutdown)
+	return s
+}
+
+// CloseStreams marks the server as not serving and closes all event streams
+// with the final ServerShutdown event, so the gRPC server can drain before sessions are stopped.
+func (s *Server) CloseStreams() {
+	s.streamsOnce.Do(func() {
+		s.log.Infof("Closing event streams...")
+		// Let load balancers know first
+		s.Health.Shutdown()
+		close(s.shutdown)
+	})
+}
+
+// Shutdown closes all event streams and stops all sessions (keeping them in the registry).
+// Events emitted while sessions stop are journaled - streams resume them after restart.
+func (s *Server) Shutdown() {
+	s.shutdownOnce.Do(func() {
+		s.CloseStreams()
+		s.log.Infof("Stopping sessions...")
+		s.Sm.StopAll()
+		// Stopped sessions close their event channels, wait until the rest is forwarded
+		s.forwarders.Wait()
+		s.uploads.removeAll()
+	})
 }
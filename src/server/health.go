@@ -0,0 +1,46 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/devlikeapro/gows/gows"
+	"github.com/devlikeapro/gows/metrics"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const sessionHealthPrefix = "session/"
+
+// SessionHealthService - the health service of the session, SERVING while the session is WORKING
+func SessionHealthService(session string) string {
+	return sessionHealthPrefix + session
+}
+
+// sessionOfHealthService returns the session of the health service, empty if it's not a session health service
+func sessionOfHealthService(service string) string {
+	session, ok := strings.CutPrefix(service, sessionHealthPrefix)
+	if !ok {
+		return ""
+	}
+	return session
+}
+
+func newHealthServer() *health.Server {
+	server := health.NewServer()
+	server.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	return server
+}
+
+// setSessionStatus updates the session health and the state metric, empty status - the session has been stopped
+func (s *Server) setSessionStatus(session string, status gows.SessionStatus) {
+	if status == "" {
+		metrics.RemoveSession(session)
+	} else {
+		metrics.SetSessionState(session, string(status))
+	}
+	serving := healthpb.HealthCheckResponse_NOT_SERVING
+	if status == gows.StatusWorking {
+		serving = healthpb.HealthCheckResponse_SERVING
+	}
+	s.Health.SetServingStatus(SessionHealthService(session), serving)
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/devlikeapro/gows/gows"
+	"github.com/devlikeapro/gows/proto"
+	"github.com/devlikeapro/gows/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// idempotentCall is a send request with an idempotency key in progress
+type idempotentCall struct {
+	method string
+	hash   string
+	done   chan struct{}
+	// response and err are set before done is closed
+	response *__.MessageResponse
+	err      error
+}
+
+// idempotency - send requests with idempotency keys in progress, "session/key" -> call
+type idempotency struct {
+	lock  sync.Mutex
+	calls map[string]*idempotentCall
+}
+
+// begin returns the call in progress with the key or starts a new one, owner is true for a new one
+func (i *idempotency) begin(key string, method string, hash string) (call *idempotentCall, owner bool) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if call, ok := i.calls[key]; ok {
+		return call, false
+	}
+	if i.calls == nil {
+		i.calls = make(map[string]*idempotentCall)
+	}
+	call = &idempotentCall{method: method, hash: hash, done: make(chan struct{})}
+	i.calls[key] = call
+	return call, true
+}
+
+func (i *idempotency) end(key string, call *idempotentCall, response *__.MessageResponse, err error) {
+	i.lock.Lock()
+	delete(i.calls, key)
+	i.lock.Unlock()
+	call.response = response
+	call.err = err
+	close(call.done)
+}
+
+func errIdempotencyKeyReused(key string) error {
+	return status.Errorf(codes.InvalidArgument, "idempotency key '%s' has been used for another request", key)
+}
+
+func requestHash(req proto.Message) (string, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// idempotent sends the request once per idempotency key of the session:
+// a retry with the key gets the recorded response, a concurrent duplicate waits for the first one.
+// Failed requests are not recorded, they can be retried with the same key.
+func (s *Server) idempotent(ctx context.Context, cli *gows.GoWS, key string, method string, req proto.Message, send func() (*__.MessageResponse, error)) (*__.MessageResponse, error) {
+	if key == "" {
+		return send()
+	}
+	hash, err := requestHash(req)
+	if err != nil {
+		return nil, err
+	}
+	inflight := cli.Name() + "/" + key
+	for {
+		call, owner := s.idempotency.begin(inflight, method, hash)
+		if owner {
+			response, err := s.sendOnce(cli, key, method, hash, send)
+			s.idempotency.end(inflight, call, response, err)
+			return response, err
+		}
+		if call.method != method || call.hash != hash {
+			return nil, errIdempotencyKeyReused(key)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-call.done:
+		}
+		if call.err == nil {
+			return call.response, nil
+		}
+		// The first one failed - send it ourselves
+	}
+}
+
+// sendOnce returns the recorded response for the key or sends the request and records its response
+func (s *Server) sendOnce(cli *gows.GoWS, key string, method string, hash string, send func() (*__.MessageResponse, error)) (*__.MessageResponse, error) {
+	keys := cli.Storage.IdempotencyKeys
+	recorded, err := keys.GetIdempotencyKey(key)
+	switch {
+	case err == nil:
+		if recorded.Method != method || recorded.RequestHash != hash {
+			return nil, errIdempotencyKeyReused(key)
+		}
+		response := &__.MessageResponse{}
+		err = protojson.Unmarshal([]byte(recorded.Response), response)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to read the response for idempotency key '%s': %v", key, err)
+		}
+		return response, nil
+	case !errors.Is(err, storage.ErrNotFound):
+		return nil, status.Errorf(codes.Internal, "failed to check idempotency key '%s': %v", key, err)
+	}
+
+	response, err := send()
+	if err != nil {
+		return nil, err
+	}
+	data, err := protojson.Marshal(response)
+	if err == nil {
+		err = keys.SaveIdempotencyKey(&storage.IdempotencyKey{
+			ID:          key,
+			Method:      method,
+			RequestHash: hash,
+			Response:    string(data),
+			CreatedAt:   time.Now(),
+		})
+	}
+	if err != nil {
+		// The message has been sent anyway, a retry with the key sends it again
+		s.log.Errorf("Failed to record idempotency key '%s' for session '%s': %v", key, cli.Name(), err)
+	}
+	return response, nil
+}
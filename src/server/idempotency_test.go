@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/devlikeapro/gows/gows"
+	"github.com/devlikeapro/gows/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIdempotentConcurrentDuplicate(t *testing.T) {
+	s := &Server{}
+	cli := &gows.GoWS{Context: context.WithValue(context.Background(), "name", "default")}
+	req := &__.MessageRequest{Text: "hello", IdempotencyKey: "key"}
+	hash, err := requestHash(req)
+	require.NoError(t, err)
+	send := func() (*__.MessageResponse, error) {
+		return nil, errors.New("must not be sent again")
+	}
+
+	// The first request is in progress
+	call, owner := s.idempotency.begin("default/key", "SendMessage", hash)
+	require.True(t, owner)
+
+	// Another request with the key is rejected right away
+	_, err = s.idempotent(context.Background(), cli, "key", "SendMessage", &__.MessageRequest{Text: "other", IdempotencyKey: "key"}, send)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// A duplicate waits for the first one
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.idempotent(ctx, cli, "key", "SendMessage", req, send)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	done := make(chan *__.MessageResponse)
+	go func() {
+		response, _ := s.idempotent(context.Background(), cli, "key", "SendMessage", req, send)
+		done <- response
+	}()
+	time.Sleep(50 * time.Millisecond)
+	s.idempotency.end("default/key", call, &__.MessageResponse{Id: "1"}, nil)
+	assert.Equal(t, "1", (<-done).GetId())
+}
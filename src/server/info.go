@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/devlikeapro/gows/gows"
+	"github.com/devlikeapro/gows/proto"
+	"go.mau.fi/whatsmeow/store"
+)
+
+// Version - the gows build version, set with -ldflags "-X github.com/devlikeapro/gows/server.Version=..."
+var Version = "dev"
+
+// whatsmeowModule - the module path whatsmeow version is reported for
+const whatsmeowModule = "go.mau.fi/whatsmeow"
+
+// dependencyVersion returns the version of the module the binary is built with, empty if unknown
+func dependencyVersion(path string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != path {
+			continue
+		}
+		if dep.Replace != nil && dep.Replace.Version != "" {
+			return dep.Replace.Version
+		}
+		return dep.Version
+	}
+	return ""
+}
+
+func (s *Server) GetServerInfo(ctx context.Context, req *__.Empty) (*__.ServerInfo, error) {
+	sessions := s.Sm.List()
+	working := 0
+	for _, info := range sessions {
+		cli, err := s.Sm.Get(info.Name)
+		if err == nil && cli.GetState().Status == gows.StatusWorking {
+			working++
+		}
+	}
+
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+	return &__.ServerInfo{
+		Version:          Version,
+		WhatsmeowVersion: dependencyVersion(whatsmeowModule),
+		WaVersion:        store.GetWAVersion().String(),
+		GoVersion:        runtime.Version(),
+		StartedAt:        s.startedAt.Unix(),
+		UptimeSeconds:    int64(time.Since(s.startedAt).Seconds()),
+		Sessions:         uint32(len(sessions)),
+		WorkingSessions:  uint32(working),
+		Goroutines:       uint32(runtime.NumGoroutine()),
+		Memory: &__.MemoryStats{
+			Alloc:      memory.Alloc,
+			Sys:        memory.Sys,
+			HeapAlloc:  memory.HeapAlloc,
+			HeapInuse:  memory.HeapInuse,
+			StackInuse: memory.StackInuse,
+			NumGC:      memory.NumGC,
+		},
+	}, nil
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devlikeapro/gows/metrics"
+	"github.com/devlikeapro/gows/proto"
+	"github.com/google/uuid"
+)
+
+// maxStreamBuffer - the largest listener buffer a stream can ask for
+const maxStreamBuffer = 10_000
+
+// EventsDropped is sent to the stream when events have been lost for a slow consumer,
+// the consumer should resync (e.g. fetch messages from the storage)
+type EventsDropped struct {
+	// Count - how many events have been lost
+	Count int
+	// Types - lost events count by event type
+	Types map[string]int
+	// FromSequence, ToSequence - sequences of the first and the last lost events (0 - not journaled)
+	FromSequence uint64
+	ToSequence   uint64
+	// Sessions - lost events count by session, multi-session streams only
+	Sessions map[string]int `json:",omitempty"`
+
+	// unsequenced - lost events that are not in the journal
+	unsequenced int
+}
+
+func (e *EventsDropped) EventName() string {
+	return "events.dropped"
+}
+
+// streamEvent is a session event as listeners get it, streams send it in their format
+type streamEvent struct {
+	*__.EventJson
+	// raw - the event as emitted by the session, nil if it's replayed from the journal
+	raw interface{}
+
+	typedOnce sync.Once
+	typed     *__.Event
+}
+
+// Typed returns the typed envelope of the event, built once for all typed streams
+func (e *streamEvent) Typed() *__.Event {
+	e.typedOnce.Do(func() {
+		e.typed = toTypedEvent(e.EventJson, e.raw)
+	})
+	return e.typed
+}
+
+// listener is a stream subscribed to the session events
+type listener struct {
+	id           uuid.UUID
+	ch           chan *streamEvent
+	filter       *eventFilter
+	policy       __.BackpressurePolicy
+	blockTimeout time.Duration
+
+	// dropped - events lost since the last time the stream caught up
+	dropped     *EventsDropped
+	droppedLock sync.Mutex
+
+	// slow is closed when the consumer is disconnected for being slow (DISCONNECT policy)
+	slow     chan struct{}
+	slowOnce sync.Once
+
+	// sessions - the sessions a multi-session stream is subscribed to, nil for a single session stream
+	sessions *sessionMatcher
+}
+
+// streamOptions - buffer and backpressure settings of a stream request
+type streamOptions interface {
+	GetBufferSize() uint32
+	GetBlockTimeoutMs() uint32
+	GetBackpressure() __.BackpressurePolicy
+}
+
+// sessionMatcher selects sessions by name or prefix, matches all sessions if both are empty
+type sessionMatcher struct {
+	names  map[string]bool
+	prefix string
+}
+
+func newSessionMatcher(names []string, prefix string) *sessionMatcher {
+	return &sessionMatcher{names: toSet(names), prefix: prefix}
+}
+
+func (m *sessionMatcher) match(session string) bool {
+	if m.names == nil && m.prefix == "" {
+		return true
+	}
+	return m.names[session] || (m.prefix != "" && strings.HasPrefix(session, m.prefix))
+}
+
+// newListener builds the listener buffer and backpressure from the stream request, server defaults apply if not set
+func (s *Server) newListener(id uuid.UUID, filter *eventFilter, req streamOptions) *listener {
+	size := int(req.GetBufferSize())
+	if size == 0 {
+		size = s.cfg.StreamBuffer
+	}
+	if size > maxStreamBuffer {
+		size = maxStreamBuffer
+	}
+	blockTimeout := time.Duration(req.GetBlockTimeoutMs()) * time.Millisecond
+	if blockTimeout == 0 {
+		blockTimeout = s.cfg.StreamBlockTimeout
+	}
+	return &listener{
+		id:           id,
+		ch:           make(chan *streamEvent, size),
+		filter:       filter,
+		policy:       req.GetBackpressure(),
+		blockTimeout: blockTimeout,
+		slow:         make(chan struct{}),
+	}
+}
+
+// deliver puts the event into the listener buffer, what happens when it's full depends on the policy
+func (l *listener) deliver(event *streamEvent) {
+	select {
+	case l.ch <- event:
+		return
+	default:
+	}
+
+	switch l.policy {
+	case __.BackpressurePolicy_DROP_OLDEST:
+		// Make room for the new event, the stream may be reading at the same time
+		select {
+		case oldest := <-l.ch:
+			l.drop(oldest)
+		default:
+		}
+		select {
+		case l.ch <- event:
+		default:
+			l.drop(event)
+		}
+	case __.BackpressurePolicy_BLOCK:
+		timer := time.NewTimer(l.blockTimeout)
+		defer timer.Stop()
+		select {
+		case l.ch <- event:
+		case <-l.slow:
+			l.drop(event)
+		case <-timer.C:
+			l.drop(event)
+		}
+	case __.BackpressurePolicy_DISCONNECT:
+		l.drop(event)
+		l.slowOnce.Do(func() {
+			close(l.slow)
+		})
+	default:
+		l.drop(event)
+	}
+}
+
+func (l *listener) drop(event *streamEvent) {
+	l.droppedLock.Lock()
+	defer l.droppedLock.Unlock()
+	if l.dropped == nil {
+		l.dropped = &EventsDropped{Types: map[string]int{}}
+	}
+	l.dropped.Count++
+	l.dropped.Types[event.Event]++
+	metrics.EventsDropped.WithLabelValues(event.Session, event.Event).Inc()
+	if l.sessions != nil {
+		// Sequences are per session, lost events can't be replayed
+		if l.dropped.Sessions == nil {
+			l.dropped.Sessions = map[string]int{}
+		}
+		l.dropped.Sessions[event.Session]++
+		l.dropped.unsequenced++
+	} else if event.Sequence == 0 {
+		l.dropped.unsequenced++
+	} else {
+		if l.dropped.FromSequence == 0 || event.Sequence < l.dropped.FromSequence {
+			l.dropped.FromSequence = event.Sequence
+		}
+		if event.Sequence > l.dropped.ToSequence {
+			l.dropped.ToSequence = event.Sequence
+		}
+	}
+}
+
+func (l *listener) hasDropped() bool {
+	l.droppedLock.Lock()
+	defer l.droppedLock.Unlock()
+	return l.dropped != nil
+}
+
+// takeDropped returns events lost since the last call, nil if nothing has been lost
+func (l *listener) takeDropped() *EventsDropped {
+	l.droppedLock.Lock()
+	defer l.droppedLock.Unlock()
+	dropped := l.dropped
+	l.dropped = nil
+	return dropped
+}
+
+// matchingListeners returns the session listeners whose filters pass the event
+func (s *Server) matchingListeners(session string, meta eventMeta) []*listener {
+	listeners := s.getListeners(session)
+	matching := listeners[:0]
+	for _, listener := range listeners {
+		if listener.filter.match(meta) {
+			matching = append(matching, listener)
+		}
+	}
+	return matching
+}
+
+func (s *Server) addListener(session string, l *listener) {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+
+	sessionListeners, ok := s.listeners[session]
+	if !ok {
+		sessionListeners = map[uuid.UUID]*listener{}
+		s.listeners[session] = sessionListeners
+	}
+	sessionListeners[l.id] = l
+}
+
+func (s *Server) removeListener(session string, id uuid.UUID) {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+	l, ok := s.listeners[session][id]
+	if !ok {
+		return
+	}
+	delete(s.listeners[session], id)
+	// if it's the last listener, remove the session
+	if len(s.listeners[session]) == 0 {
+		delete(s.listeners, session)
+	}
+	// Unblock the forwarder waiting on the listener (BLOCK policy)
+	l.slowOnce.Do(func() {
+		close(l.slow)
+	})
+}
+
+// addSessionsListener subscribes the multi-session stream,
+// sessions are matched when events are sent, so sessions started later are included
+func (s *Server) addSessionsListener(l *listener) {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+	s.sessionsListeners[l.id] = l
+}
+
+func (s *Server) removeSessionsListener(id uuid.UUID) {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+	l, ok := s.sessionsListeners[id]
+	if !ok {
+		return
+	}
+	delete(s.sessionsListeners, id)
+	l.slowOnce.Do(func() {
+		close(l.slow)
+	})
+}
+
+// getListeners returns streams of the session and multi-session streams subscribed to it
+func (s *Server) getListeners(session string) []*listener {
+	s.listenersLock.RLock()
+	defer s.listenersLock.RUnlock()
+	sessionListeners := s.listeners[session]
+	listeners := make([]*listener, 0, len(sessionListeners)+len(s.sessionsListeners))
+	for _, l := range sessionListeners {
+		listeners = append(listeners, l)
+	}
+	for _, l := range s.sessionsListeners {
+		if l.sessions.match(session) {
+			listeners = append(listeners, l)
+		}
+	}
+	return listeners
+}
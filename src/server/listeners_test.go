@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/devlikeapro/gows/gows"
+	"github.com/devlikeapro/gows/proto"
+	"github.com/devlikeapro/gows/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStreamEvent(event string, sequence uint64) *streamEvent {
+	return &streamEvent{EventJson: &__.EventJson{Session: "default", Event: event, Data: "{}", Sequence: sequence}}
+}
+
+func testListener(policy __.BackpressurePolicy, size int) *listener {
+	return &listener{
+		id:           uuid.New(),
+		ch:           make(chan *streamEvent, size),
+		policy:       policy,
+		blockTimeout: 20 * time.Millisecond,
+		slow:         make(chan struct{}),
+	}
+}
+
+func buffered(l *listener) []uint64 {
+	var sequences []uint64
+	for {
+		select {
+		case event := <-l.ch:
+			sequences = append(sequences, event.Sequence)
+		default:
+			return sequences
+		}
+	}
+}
+
+func TestListenerDeliver(t *testing.T) {
+	cases := []struct {
+		name     string
+		policy   __.BackpressurePolicy
+		buffered []uint64
+		dropped  []uint64
+		slow     bool
+	}{
+		{"drop newest", __.BackpressurePolicy_DROP_NEWEST, []uint64{1, 2}, []uint64{3, 4}, false},
+		{"drop oldest", __.BackpressurePolicy_DROP_OLDEST, []uint64{3, 4}, []uint64{1, 2}, false},
+		{"block timeout", __.BackpressurePolicy_BLOCK, []uint64{1, 2}, []uint64{3, 4}, false},
+		{"disconnect", __.BackpressurePolicy_DISCONNECT, []uint64{1, 2}, []uint64{3, 4}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			l := testListener(c.policy, 2)
+			for sequence := uint64(1); sequence <= 4; sequence++ {
+				l.deliver(testStreamEvent("events.Message", sequence))
+			}
+			assert.Equal(t, c.buffered, buffered(l))
+
+			dropped := l.takeDropped()
+			require.NotNil(t, dropped)
+			assert.Equal(t, len(c.dropped), dropped.Count)
+			assert.Equal(t, map[string]int{"events.Message": len(c.dropped)}, dropped.Types)
+			assert.Equal(t, c.dropped[0], dropped.FromSequence)
+			assert.Equal(t, c.dropped[len(c.dropped)-1], dropped.ToSequence)
+			assert.Zero(t, dropped.unsequenced)
+			assert.Nil(t, l.takeDropped())
+
+			select {
+			case <-l.slow:
+				assert.True(t, c.slow, "the listener must not be disconnected")
+			default:
+				assert.False(t, c.slow, "the listener must be disconnected")
+			}
+		})
+	}
+}
+
+func TestListenerDeliverBlock(t *testing.T) {
+	l := testListener(__.BackpressurePolicy_BLOCK, 1)
+	l.blockTimeout = 5 * time.Second
+	l.deliver(testStreamEvent("events.Message", 1))
+
+	// The stream reads while the session waits
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		<-l.ch
+	}()
+	l.deliver(testStreamEvent("events.Message", 2))
+	assert.Equal(t, []uint64{2}, buffered(l))
+	assert.False(t, l.hasDropped())
+
+	// The stream is gone - the session is not held anymore
+	close(l.slow)
+	l.deliver(testStreamEvent("events.Message", 3))
+	l.deliver(testStreamEvent("events.Message", 4))
+	assert.Equal(t, []uint64{3}, buffered(l))
+	assert.Equal(t, 1, l.takeDropped().Count)
+}
+
+func TestListenerDropUnsequenced(t *testing.T) {
+	l := testListener(__.BackpressurePolicy_DROP_NEWEST, 0)
+	l.deliver(testStreamEvent("events.Receipt", 5))
+	l.deliver(testStreamEvent("session.status", 0))
+	dropped := l.takeDropped()
+	assert.Equal(t, 2, dropped.Count)
+	assert.Equal(t, map[string]int{"events.Receipt": 1, "session.status": 1}, dropped.Types)
+	assert.Equal(t, uint64(5), dropped.FromSequence)
+	assert.Equal(t, 1, dropped.unsequenced)
+
+	// Multi-session streams can't replay - sequences are per session
+	l = testListener(__.BackpressurePolicy_DROP_NEWEST, 0)
+	l.sessions = newSessionMatcher(nil, "")
+	l.deliver(testStreamEvent("events.Receipt", 5))
+	dropped = l.takeDropped()
+	assert.Equal(t, map[string]int{"default": 1}, dropped.Sessions)
+	assert.Equal(t, 1, dropped.unsequenced)
+	assert.Zero(t, dropped.FromSequence)
+}
+
+type recordingStream struct {
+	events []*streamEvent
+}
+
+func (s *recordingStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *recordingStream) Send(event *streamEvent) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestCatchUp(t *testing.T) {
+	s := NewServer(Config{UploadDir: t.TempDir()})
+	defer s.Shutdown()
+	cli, err := s.Sm.Build("default", gows.SessionConfig{
+		Store: gows.StoreConfig{Dialect: "sqlite3", Address: "file:" + filepath.Join(t.TempDir(), "store.db") + "?_foreign_keys=on"},
+		Log:   gows.LogConfig{Level: "ERROR"},
+	})
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err = cli.Storage.Events.Append(&storage.JournalEvent{Event: "events.Message", Data: "{}"})
+		require.NoError(t, err)
+	}
+
+	t.Run("nothing dropped", func(t *testing.T) {
+		stream := &recordingStream{}
+		last := uint64(5)
+		require.NoError(t, s.catchUp("default", testListener(__.BackpressurePolicy_DROP_NEWEST, 0), &last, stream))
+		assert.Empty(t, stream.events)
+	})
+
+	t.Run("replayed from the journal", func(t *testing.T) {
+		l := testListener(__.BackpressurePolicy_DROP_NEWEST, 0)
+		l.deliver(testStreamEvent("events.Message", 3))
+		l.deliver(testStreamEvent("events.Message", 4))
+		stream := &recordingStream{}
+		last := uint64(1)
+		require.NoError(t, s.catchUp("default", l, &last, stream))
+		var sequences []uint64
+		for _, event := range stream.events {
+			sequences = append(sequences, event.Sequence)
+		}
+		// From the first dropped one, the stream has not asked for 2
+		assert.Equal(t, []uint64{3, 4, 5}, sequences)
+		assert.Equal(t, uint64(5), last)
+		assert.False(t, l.hasDropped())
+	})
+
+	t.Run("not journaled", func(t *testing.T) {
+		l := testListener(__.BackpressurePolicy_DROP_NEWEST, 0)
+		l.deliver(testStreamEvent("events.Message", 4))
+		l.deliver(testStreamEvent("session.status", 0))
+		stream := &recordingStream{}
+		last := uint64(3)
+		require.NoError(t, s.catchUp("default", l, &last, stream))
+		require.Len(t, stream.events, 1)
+		assert.Equal(t, "events.dropped", stream.events[0].Event)
+		assert.JSONEq(t, `{"Count":2,"Types":{"events.Message":1,"session.status":1},"FromSequence":4,"ToSequence":4}`, stream.events[0].Data)
+		assert.Equal(t, uint64(3), last)
+	})
+
+	t.Run("trimmed from the journal", func(t *testing.T) {
+		l := testListener(__.BackpressurePolicy_DROP_NEWEST, 0)
+		l.deliver(testStreamEvent("events.Message", 5))
+		stream := &recordingStream{}
+		last := uint64(0)
+		// Another session - its journal has nothing
+		_, err := s.Sm.Build("empty", gows.SessionConfig{
+			Store: gows.StoreConfig{Dialect: "sqlite3", Address: "file:" + filepath.Join(t.TempDir(), "empty.db") + "?_foreign_keys=on"},
+			Log:   gows.LogConfig{Level: "ERROR"},
+		})
+		require.NoError(t, err)
+		require.NoError(t, s.catchUp("empty", l, &last, stream))
+		require.Len(t, stream.events, 1)
+		assert.Equal(t, "events.dropped", stream.events[0].Event)
+	})
+}
@@ -3,10 +3,13 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"github.com/devlikeapro/gows/gows"
 	"github.com/devlikeapro/gows/proto"
 	"go.mau.fi/whatsmeow/proto/waE2E"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"io"
 	"os"
 	"time"
 )
@@ -21,6 +24,40 @@ func (s *Server) DownloadMedia(ctx context.Context, req *__.DownloadMediaRequest
 	if err != nil {
 		return nil, err
 	}
+	msg, err := messageToDownload(cli, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.Err() != nil {
+		return nil, status.Error(codes.DeadlineExceeded, "download media timed out before start")
+	}
+
+	resp, err := cli.DownloadAnyMedia(ctx, msg)
+	if err != nil {
+		if ctx.Err() != nil {
+			cli.Log.Warnf("Media download for '%s' canceled: %v", req.MessageId, ctx.Err())
+			return nil, status.Error(codes.DeadlineExceeded, "download media timed out")
+		}
+		cli.Log.Errorf("Failed to download media for '%s' message: %v", req.MessageId, err)
+		return nil, status.Errorf(codes.Internal, "failed to download media: %v", err)
+	}
+	if req.GetContentPath() != "" {
+		if err := os.WriteFile(req.GetContentPath(), resp, 0644); err != nil {
+			// Fallback to returning the content in the response
+			cli.Log.Errorf("Failed to write media to '%s': %v", req.GetContentPath(), err)
+			return &__.DownloadMediaResponse{Content: resp}, nil
+		}
+		return &__.DownloadMediaResponse{
+			Content:     []byte{},
+			ContentPath: req.GetContentPath(),
+		}, nil
+	}
+	return &__.DownloadMediaResponse{Content: resp}, nil
+}
+
+// messageToDownload returns the message from the request JSON or from the storage
+func messageToDownload(cli *gows.GoWS, req *__.DownloadMediaRequest) (*waE2E.Message, error) {
 	// Parse Message from JSON provided
 	msg, buildMessageError := BuildMessage(req.GetMessage())
 	if buildMessageError != nil {
@@ -53,40 +90,70 @@ func (s *Server) DownloadMedia(ctx context.Context, req *__.DownloadMediaRequest
 		}
 		return nil, status.Error(codes.InvalidArgument, "message is empty")
 	}
+	return msg, nil
+}
 
-	if ctx.Err() != nil {
-		return nil, status.Error(codes.DeadlineExceeded, "download media timed out before start")
+// BuildMessage builds a message from the given JSON data
+func BuildMessage(data string) (*waE2E.Message, error) {
+	var message waE2E.Message
+	err := json.Unmarshal([]byte(data), &message)
+	if err != nil {
+		return nil, err
 	}
+	return &message, nil
+}
 
-	resp, err := cli.DownloadAnyMedia(ctx, msg)
+// DownloadMediaStream downloads the media to a temporary file and sends it in chunks,
+// so large files are not held in memory
+func (s *Server) DownloadMediaStream(req *__.DownloadMediaRequest, stream __.MessageService_DownloadMediaStreamServer) error {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return err
+	}
+	msg, err := messageToDownload(cli, req)
+	if err != nil {
+		return err
+	}
+
+	file, err := s.uploads.createFile(downloadFilePrefix)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to create download file: %v", err)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+
+	ctx, cancel := context.WithTimeout(stream.Context(), downloadMediaTimeout)
+	err = cli.DownloadAnyMediaToFile(ctx, msg, file)
+	cancel()
 	if err != nil {
 		if ctx.Err() != nil {
 			cli.Log.Warnf("Media download for '%s' canceled: %v", req.MessageId, ctx.Err())
-			return nil, status.Error(codes.DeadlineExceeded, "download media timed out")
+			return status.Error(codes.DeadlineExceeded, "download media timed out")
 		}
 		cli.Log.Errorf("Failed to download media for '%s' message: %v", req.MessageId, err)
-		return nil, status.Errorf(codes.Internal, "failed to download media: %v", err)
+		return status.Errorf(codes.Internal, "failed to download media: %v", err)
 	}
-	if req.GetContentPath() != "" {
-		if err := os.WriteFile(req.GetContentPath(), resp, 0644); err != nil {
-			// Fallback to returning the content in the response
-			cli.Log.Errorf("Failed to write media to '%s': %v", req.GetContentPath(), err)
-			return &__.DownloadMediaResponse{Content: resp}, nil
-		}
-		return &__.DownloadMediaResponse{
-			Content:     []byte{},
-			ContentPath: req.GetContentPath(),
-		}, nil
-	}
-	return &__.DownloadMediaResponse{Content: resp}, nil
-}
 
-// BuildMessage builds a message from the given JSON data
-func BuildMessage(data string) (*waE2E.Message, error) {
-	var message waE2E.Message
-	err := json.Unmarshal([]byte(data), &message)
+	_, err = file.Seek(0, io.SeekStart)
 	if err != nil {
-		return nil, err
+		return status.Errorf(codes.Internal, "failed to read downloaded media: %v", err)
+	}
+	buf := make([]byte, mediaChunkSize)
+	for {
+		n, err := io.ReadFull(file, buf)
+		if n > 0 {
+			sendErr := stream.Send(&__.MediaChunk{Data: buf[:n]})
+			if sendErr != nil {
+				return sendErr
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to read downloaded media: %v", err)
+		}
 	}
-	return &message, nil
 }
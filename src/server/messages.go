@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"github.com/devlikeapro/gows/gows"
 	waBinary "go.mau.fi/whatsmeow/binary"
-	"os"
 	"strconv"
 	"time"
 
@@ -45,6 +44,12 @@ func (s *Server) SendMessage(ctx context.Context, req *__.MessageRequest) (*__.M
 	if err != nil {
 		return nil, err
 	}
+	return s.idempotent(ctx, cli, req.GetIdempotencyKey(), __.MessageService_SendMessage_FullMethodName, req, func() (*__.MessageResponse, error) {
+		return s.sendMessage(ctx, cli, req)
+	})
+}
+
+func (s *Server) sendMessage(ctx context.Context, cli *gows.GoWS, req *__.MessageRequest) (*__.MessageResponse, error) {
 	jid, err := types.ParseJID(req.GetJid())
 	if err != nil {
 		return nil, err
@@ -59,7 +64,7 @@ func (s *Server) SendMessage(ctx context.Context, req *__.MessageRequest) (*__.M
 	}
 
 	if requireDisappearingSettings {
-		contextInfo, err = cli.PopulateContextInfoDisappearingSettings(contextInfo, jid)
+		contextInfo, err = cli.PopulateContextInfoDisappearingSettings(ctx, contextInfo, jid)
 		if err != nil {
 			cli.Log.Warnf("Failed to get disappearing settings: %v", err)
 		}
@@ -76,13 +81,14 @@ func (s *Server) SendMessage(ctx context.Context, req *__.MessageRequest) (*__.M
 		contextInfo = cli.PopulateContextInfoWithMentions(contextInfo, req.GetMentions())
 	}
 
-	if req.Media != nil && req.Media.GetContentPath() != "" {
-		content, err := os.ReadFile(req.Media.GetContentPath())
+	var content *mediaContent
+	if req.Media != nil {
+		content, err = s.openMediaContent(req.GetSession().GetId(), req.Media)
 		if err != nil {
-			cli.Log.Errorf("Failed to read media from '%s': %v", req.Media.GetContentPath(), err)
-			return nil, fmt.Errorf("failed to read media from file: %w", err)
+			cli.Log.Errorf("Failed to read media: %v", err)
+			return nil, err
 		}
-		req.Media.Content = content
+		defer content.Close()
 	}
 
 	var message *waE2E.Message
@@ -277,7 +283,7 @@ func (s *Server) SendMessage(ctx context.Context, req *__.MessageRequest) (*__.M
 					Image:       req.Preview.Image,
 				}
 			}
-			cli.AddLinkPreviewSafe(jid, message.ExtendedTextMessage, req.LinkPreviewHighQuality, preview)
+			cli.AddLinkPreviewSafe(ctx, jid, message.ExtendedTextMessage, req.LinkPreviewHighQuality, preview)
 		}
 
 		message.ExtendedTextMessage.ContextInfo = contextInfo
@@ -304,13 +310,13 @@ func (s *Server) SendMessage(ctx context.Context, req *__.MessageRequest) (*__.M
 		case __.MediaType_IMAGE:
 			// Upload
 			mediaType = whatsmeow.MediaImage
-			mediaResponse, err = cli.UploadMedia(ctx, jid, req.Media.Content, mediaType)
+			mediaResponse, err = content.upload(ctx, cli, jid, mediaType)
 			if err != nil {
 				return nil, err
 			}
 
 			// Generate Thumbnail
-			thumbnail, err := media.ImageThumbnail(req.Media.Content)
+			thumbnail, err := media.ImageThumbnail(content.bytes())
 			if err != nil {
 				cli.Log.Errorf("Failed to generate thumbnail: %v", err)
 			}
@@ -339,14 +345,14 @@ func (s *Server) SendMessage(ctx context.Context, req *__.MessageRequest) (*__.M
 
 			if waveform == nil || len(waveform) == 0 {
 				// Generate waveform
-				waveform, err = media.Waveform(req.Media.Content)
+				waveform, err = media.Waveform(content.bytes())
 				if err != nil {
 					cli.Log.Errorf("Failed to generate waveform: %v", err)
 				}
 			}
 			if duration == 0 {
 				// Get duration
-				duration, err = media.Duration(req.Media.Content)
+				duration, err = media.Duration(content.bytes())
 				if err != nil {
 					cli.Log.Errorf("Failed to get duration of audio: %v", err)
 				}
@@ -354,7 +360,7 @@ func (s *Server) SendMessage(ctx context.Context, req *__.MessageRequest) (*__.M
 			durationSeconds := uint32(duration)
 
 			// Upload
-			mediaResponse, err = cli.UploadMedia(ctx, jid, req.Media.Content, mediaType)
+			mediaResponse, err = content.upload(ctx, cli, jid, mediaType)
 			if err != nil {
 				return nil, err
 			}
@@ -377,14 +383,14 @@ func (s *Server) SendMessage(ctx context.Context, req *__.MessageRequest) (*__.M
 		case __.MediaType_VIDEO:
 			mediaType = whatsmeow.MediaVideo
 			// Upload
-			mediaResponse, err = cli.UploadMedia(ctx, jid, req.Media.Content, mediaType)
+			mediaResponse, err = content.upload(ctx, cli, jid, mediaType)
 			if err != nil {
 				return nil, err
 			}
 
 			// Generate Thumbnail
-			thumbnail, err := media.VideoThumbnail(
-				req.Media.Content,
+			thumbnail, err := media.VideoThumbnailReader(
+				content.reader(),
 				0,
 				struct{ Width int }{Width: 72},
 			)
@@ -409,13 +415,13 @@ func (s *Server) SendMessage(ctx context.Context, req *__.MessageRequest) (*__.M
 		case __.MediaType_DOCUMENT:
 			mediaType = whatsmeow.MediaDocument
 			// Upload
-			mediaResponse, err = cli.UploadMedia(ctx, jid, req.Media.Content, mediaType)
+			mediaResponse, err = content.upload(ctx, cli, jid, mediaType)
 			if err != nil {
 				return nil, err
 			}
 
 			// Generate Thumbnail if possible
-			thumbnail, err := media.ImageThumbnail(req.Media.Content)
+			thumbnail, err := media.ImageThumbnail(content.bytes())
 			if err != nil {
 				cli.Log.Infof("Failed to generate thumbnail: %v", err)
 			}
@@ -474,6 +480,12 @@ func (s *Server) SendReaction(ctx context.Context, req *__.MessageReaction) (*__
 	if err != nil {
 		return nil, err
 	}
+	return s.idempotent(ctx, cli, req.GetIdempotencyKey(), __.MessageService_SendReaction_FullMethodName, req, func() (*__.MessageResponse, error) {
+		return s.sendReaction(ctx, cli, req)
+	})
+}
+
+func (s *Server) sendReaction(ctx context.Context, cli *gows.GoWS, req *__.MessageReaction) (*__.MessageResponse, error) {
 	jid, err := types.ParseJID(req.Jid)
 	if err != nil {
 		return nil, err
@@ -625,6 +637,12 @@ func (s *Server) EditMessage(ctx context.Context, req *__.EditMessageRequest) (*
 	if err != nil {
 		return nil, err
 	}
+	return s.idempotent(ctx, cli, req.GetIdempotencyKey(), __.MessageService_EditMessage_FullMethodName, req, func() (*__.MessageResponse, error) {
+		return s.editMessage(ctx, cli, req)
+	})
+}
+
+func (s *Server) editMessage(ctx context.Context, cli *gows.GoWS, req *__.EditMessageRequest) (*__.MessageResponse, error) {
 	jid, err := types.ParseJID(req.Jid)
 	if err != nil {
 		return nil, err
@@ -634,7 +652,7 @@ func (s *Server) EditMessage(ctx context.Context, req *__.EditMessageRequest) (*
 	if req.LinkPreview && media.ExtractUrlFromText(req.Text) != "" {
 		// Switch to text message if it has URL and link preview is requested
 		message = cli.BuildTextMessage(req.Text)
-		cli.AddLinkPreviewSafe(jid, message.ExtendedTextMessage, req.LinkPreviewHighQuality, nil)
+		cli.AddLinkPreviewSafe(ctx, jid, message.ExtendedTextMessage, req.LinkPreviewHighQuality, nil)
 	}
 
 	editMessage := cli.BuildEdit(jid, req.MessageId, message)
@@ -660,6 +678,12 @@ func (s *Server) SendButtonReply(ctx context.Context, req *__.ButtonReplyRequest
 	if err != nil {
 		return nil, err
 	}
+	return s.idempotent(ctx, cli, req.GetIdempotencyKey(), __.MessageService_SendButtonReply_FullMethodName, req, func() (*__.MessageResponse, error) {
+		return s.sendButtonReply(ctx, cli, req)
+	})
+}
+
+func (s *Server) sendButtonReply(ctx context.Context, cli *gows.GoWS, req *__.ButtonReplyRequest) (*__.MessageResponse, error) {
 	jid, err := types.ParseJID(req.GetJid())
 	if err != nil {
 		return nil, err
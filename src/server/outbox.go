@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/devlikeapro/gows/gows"
+	"github.com/devlikeapro/gows/proto"
+	"github.com/devlikeapro/gows/storage"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func (s *Server) EnqueueMessage(ctx context.Context, req *__.EnqueueMessageRequest) (*__.QueuedMessage, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetMessage() == nil {
+		return nil, status.Error(codes.InvalidArgument, "message is required")
+	}
+	jid, err := types.ParseJID(req.GetMessage().GetJid())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid jid: %v", err)
+	}
+	if req.GetMessage().GetMedia().GetUploadId() != "" {
+		return nil, status.Error(codes.InvalidArgument, "uploads expire, queued media must be in content or contentPath")
+	}
+
+	msg := proto.Clone(req.GetMessage()).(*__.MessageRequest)
+	msg.Session = nil
+	request, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	var sendAt time.Time
+	if req.GetSendAt() > 0 {
+		sendAt = time.Unix(req.GetSendAt(), 0)
+	}
+	queued, err := cli.EnqueueMessage(jid, string(request), sendAt)
+	if err != nil {
+		return nil, toOutboxError(err)
+	}
+	return toQueuedMessageProto(queued), nil
+}
+
+func (s *Server) ListQueuedMessages(ctx context.Context, req *__.ListQueuedMessagesRequest) (*__.QueuedMessageList, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	var pagination storage.Pagination
+	if req.GetPagination() != nil {
+		pagination = toPagination(req.GetPagination())
+	}
+	queued, err := cli.QueuedMessages(pagination)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]*__.QueuedMessage, 0, len(queued))
+	for _, msg := range queued {
+		messages = append(messages, toQueuedMessageProto(msg))
+	}
+	return &__.QueuedMessageList{Messages: messages}, nil
+}
+
+func (s *Server) CancelQueuedMessage(ctx context.Context, req *__.QueuedMessageRequest) (*__.Empty, error) {
+	cli, err := s.Sm.Get(req.GetSession().GetId())
+	if err != nil {
+		return nil, err
+	}
+	err = cli.CancelQueuedMessage(req.GetId())
+	if err != nil {
+		return nil, toOutboxError(err)
+	}
+	return &__.Empty{}, nil
+}
+
+func toOutboxError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return status.Error(codes.NotFound, "queued message not found")
+	case errors.Is(err, gows.ErrQueuedMessageSending), errors.Is(err, gows.ErrOutboxDisabled):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return err
+}
+
+func toQueuedMessageProto(msg *storage.QueuedMessage) *__.QueuedMessage {
+	queued := &__.QueuedMessage{
+		Id:        msg.ID,
+		Jid:       msg.Jid,
+		SendAt:    msg.SendAt.Unix(),
+		Attempts:  uint32(msg.Attempts),
+		LastError: msg.LastError,
+		CreatedAt: msg.CreatedAt.Unix(),
+		Message:   &__.MessageRequest{},
+	}
+	err := protojson.Unmarshal([]byte(msg.Request), queued.Message)
+	if err != nil {
+		queued.Message = nil
+	}
+	return queued
+}
+
+// sendQueuedMessage is the gows.OutboxSender - sends the queued request as SendMessage does.
+// It must not look up sessions in the manager - the session may be stopping, it is not registered anymore.
+func (s *Server) sendQueuedMessage(ctx context.Context, cli *gows.GoWS, msg *storage.QueuedMessage) (string, error) {
+	req := &__.MessageRequest{}
+	err := protojson.Unmarshal([]byte(msg.Request), req)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid request: %v", gows.ErrPermanentSend, err)
+	}
+	req.Session = &__.Session{Id: cli.Name()}
+	if req.IdempotencyKey == "" {
+		// Not sent twice if the message is sent, but it's not removed from the outbox
+		req.IdempotencyKey = "outbox-" + msg.ID
+	}
+	response, err := s.idempotent(ctx, cli, req.GetIdempotencyKey(), __.MessageService_SendMessage_FullMethodName, req, func() (*__.MessageResponse, error) {
+		return s.sendMessage(ctx, cli, req)
+	})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.InvalidArgument, codes.NotFound, codes.FailedPrecondition, codes.PermissionDenied, codes.Unimplemented:
+			return "", fmt.Errorf("%w: %v", gows.ErrPermanentSend, err)
+		}
+		return "", err
+	}
+	return response.GetId(), nil
+}
@@ -4,77 +4,304 @@ import (
 	"context"
 	"errors"
 	"github.com/devlikeapro/gows/gows"
+	gowsLog "github.com/devlikeapro/gows/log"
 	"github.com/devlikeapro/gows/proto"
 	"go.mau.fi/whatsmeow"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"net/url"
+	"regexp"
+	"time"
 )
 
-func addApplicationName(address string, name string) string {
-	parsedURL, err := url.Parse(address)
+func buildSessionConfig(config *__.SessionConfig) (*gows.SessionConfig, error) {
+	store, err := gows.BuildStoreConfig(config.Store.Dialect, config.Store.Address)
 	if err != nil {
-		return address
-	}
-	queryParams := parsedURL.Query()
-	queryParams.Set("application_name", name)
-	parsedURL.RawQuery = queryParams.Encode()
-	return parsedURL.String()
-}
-
-func (s *Server) StartSession(ctx context.Context, req *__.StartSessionRequest) (*__.Empty, error) {
-	dialect := req.Config.Store.Dialect
-	var address string
-	switch {
-	case dialect == "sqlite3" || dialect == "sqlite":
-		// busy_timeout to prevent "database is locked" errors
-		// DO NOT add cache=shared, it's not safe
-		address = req.Config.Store.Address + "?_foreign_keys=on&_busy_timeout=30000"
-	case dialect == "postgres":
-		address = addApplicationName(req.Config.Store.Address, "GOWS")
-	default:
-		return nil, errors.New("unsupported sql dialect: " + dialect)
+		return nil, err
 	}
 
 	cfg := gows.SessionConfig{
-		Store: gows.StoreConfig{
-			Dialect: dialect,
-			Address: address,
-		},
+		Store: store,
 		Log: gows.LogConfig{
-			Level: req.Config.Log.Level.String(),
+			Level: config.Log.Level.String(),
 		},
 		Proxy: gows.ProxyConfig{
-			Url: req.Config.Proxy.Url,
+			Url: config.Proxy.Url,
 		},
 	}
 
 	// Set ignore config if provided
-	if req.Config.Ignore != nil {
+	if config.Ignore != nil {
 		cfg.Ignore = &gows.IgnoreJidsConfig{
-			Status:      req.Config.Ignore.Status,
-			Groups:      req.Config.Ignore.Groups,
-			Newsletters: req.Config.Ignore.Newsletters,
-			Broadcast:   req.Config.Ignore.Broadcast,
+			Status:      config.Ignore.Status,
+			Groups:      config.Ignore.Groups,
+			Newsletters: config.Ignore.Newsletters,
+			Broadcast:   config.Ignore.Broadcast,
 		}
 	}
+	if config.Device != nil {
+		cfg.Device = gows.DeviceConfig{
+			OsName:       config.Device.OsName,
+			PlatformType: config.Device.PlatformType,
+			PairClient:   config.Device.PairClient,
+			DisplayName:  config.Device.DisplayName,
+		}
+	}
+	err = cfg.Device.Validate()
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range config.Webhooks {
+		webhookCfg := gows.WebhookConfig{
+			Url:        webhook.Url,
+			Events:     webhook.Events,
+			HmacKey:    webhook.HmacKey,
+			Retries:    int(webhook.Retries),
+			RetryDelay: time.Duration(webhook.RetryDelayMs) * time.Millisecond,
+			Timeout:    time.Duration(webhook.TimeoutMs) * time.Millisecond,
+		}
+		err = webhookCfg.Validate()
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		cfg.Webhooks = append(cfg.Webhooks, webhookCfg)
+	}
+	if config.SendRate != nil {
+		cfg.SendRate = buildSendRateConfig(config.SendRate)
+		err = cfg.SendRate.Validate()
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	return &cfg, nil
+}
+
+func buildSendRateConfig(config *__.SessionSendRateConfig) gows.SendRateConfig {
+	return gows.SendRateConfig{
+		PerMinute:     int(config.PerMinute),
+		Burst:         int(config.Burst),
+		ChatInterval:  time.Duration(config.ChatIntervalMs) * time.Millisecond,
+		Jitter:        time.Duration(config.JitterMs) * time.Millisecond,
+		Typing:        config.Typing,
+		TypingPerChar: time.Duration(config.TypingMsPerChar) * time.Millisecond,
+		TypingMax:     time.Duration(config.TypingMaxMs) * time.Millisecond,
+	}
+}
+
+// passwordParam - password in key=value connection string
+var passwordParam = regexp.MustCompile(`(?i)\b(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// redactAddress hides the password in the store address or proxy url, configs are returned to API clients
+func redactAddress(address string) string {
+	if u, err := url.Parse(address); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return passwordParam.ReplaceAllString(address, "${1}xxxxx")
+}
+
+func toSessionConfigProto(cfg gows.SessionConfig) *__.SessionConfig {
+	config := &__.SessionConfig{
+		Store: &__.SessionStoreConfig{
+			Dialect: cfg.Store.Dialect,
+			Address: redactAddress(cfg.Store.Address),
+		},
+		Log: &__.SessionLogConfig{
+			Level: __.LogLevel(__.LogLevel_value[cfg.Log.Level]),
+		},
+		Proxy: &__.SessionProxyConfig{
+			Url: redactAddress(cfg.Proxy.Url),
+		},
+	}
+	if cfg.Ignore != nil {
+		config.Ignore = &__.SessionIgnoreJidsConfig{
+			Status:      cfg.Ignore.Status,
+			Groups:      cfg.Ignore.Groups,
+			Newsletters: cfg.Ignore.Newsletters,
+			Broadcast:   cfg.Ignore.Broadcast,
+		}
+	}
+	if cfg.Device != (gows.DeviceConfig{}) {
+		config.Device = &__.SessionDeviceConfig{
+			OsName:       cfg.Device.OsName,
+			PlatformType: cfg.Device.PlatformType,
+			PairClient:   cfg.Device.PairClient,
+			DisplayName:  cfg.Device.DisplayName,
+		}
+	}
+	for _, webhook := range cfg.Webhooks {
+		config.Webhooks = append(config.Webhooks, &__.SessionWebhookConfig{
+			Url:          webhook.Url,
+			Events:       webhook.Events,
+			HasHmacKey:   webhook.HmacKey != "",
+			Retries:      int32(webhook.Retries),
+			RetryDelayMs: uint32(webhook.RetryDelay.Milliseconds()),
+			TimeoutMs:    uint32(webhook.Timeout.Milliseconds()),
+		})
+	}
+	if cfg.SendRate != (gows.SendRateConfig{}) {
+		config.SendRate = &__.SessionSendRateConfig{
+			PerMinute:       uint32(cfg.SendRate.PerMinute),
+			Burst:           uint32(cfg.SendRate.Burst),
+			ChatIntervalMs:  uint32(cfg.SendRate.ChatInterval.Milliseconds()),
+			JitterMs:        uint32(cfg.SendRate.Jitter.Milliseconds()),
+			Typing:          cfg.SendRate.Typing,
+			TypingMsPerChar: uint32(cfg.SendRate.TypingPerChar.Milliseconds()),
+			TypingMaxMs:     uint32(cfg.SendRate.TypingMax.Milliseconds()),
+		}
+	}
+	return config
+}
+
+func (s *Server) StartSession(ctx context.Context, req *__.StartSessionRequest) (*__.Empty, error) {
+	cfg, err := buildSessionConfig(req.Config)
+	if err != nil {
+		return nil, err
+	}
 
 	session := req.GetId()
-	cli, err := s.Sm.Build(session, cfg)
+	cli, err := s.Sm.Build(session, *cfg)
+	if errors.Is(err, gows.ErrStoreLocked) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
 	if err != nil {
 		return nil, err
 	}
+	s.runSession(session, cli)
+	return &__.Empty{}, nil
+}
 
+// runSession forwards session events to listeners and starts the session in the background
+func (s *Server) runSession(session string, cli *gows.GoWS) {
 	// Subscribe to events
+	s.setSessionStatus(session, gows.StatusStarting)
+	s.forwarders.Add(1)
 	go func() {
-		for evt := range cli.GetEventChannel() {
-			s.SendEventToAllListeners(session, evt)
+		defer s.forwarders.Done()
+		forwarded := cli.ForwardEvents(func(evt interface{}) {
+			s.forwardEvent(session, cli, evt)
+		})
+		if forwarded {
+			// The session has been stopped
+			s.setSessionStatus(session, "")
 		}
 	}()
 
-	// Start the session in the background
+	// Start the session in the background,
+	// errors end up in the session state (FAILED) and the session.status event
 	go func() {
-		err = s.Sm.Start(session)
+		_ = s.Sm.Start(session)
 	}()
+}
+
+// RestoreSessions starts all sessions recorded in the registry.
+// A session that fails to build is logged and skipped, it stays in the registry for the next boot.
+func (s *Server) RestoreSessions() error {
+	sessions, err := s.Sm.Registered()
+	if err != nil {
+		return err
+	}
+	s.log.Infof("Restoring %d session(s) from registry...", len(sessions))
+	for session, cfg := range sessions {
+		cli, err := s.Sm.Restore(session, cfg)
+		if err != nil {
+			s.log.Errorf("Failed to restore session '%s': %v", session, err)
+			continue
+		}
+		s.runSession(session, cli)
+	}
+	return nil
+}
+
+func (s *Server) ListSessions(ctx context.Context, req *__.Empty) (*__.SessionList, error) {
+	infos := s.Sm.List()
+	sessions := make([]*__.SessionInfo, 0, len(infos))
+	for _, info := range infos {
+		connected := false
+		if cli, err := s.Sm.Get(info.Name); err == nil {
+			connected = cli.IsConnected()
+		}
+		sessions = append(sessions, &__.SessionInfo{
+			Id:        info.Name,
+			Config:    toSessionConfigProto(info.Config),
+			Restored:  info.Restored,
+			Connected: connected,
+		})
+	}
+	return &__.SessionList{Sessions: sessions}, nil
+}
+
+func (s *Server) UpdateSessionConfig(ctx context.Context, req *__.UpdateSessionConfigRequest) (*__.UpdateSessionConfigResponse, error) {
+	update := gows.SessionConfigUpdate{}
+	if req.Log != nil {
+		update.Log = &gows.LogConfig{Level: req.Log.Level.String()}
+	}
+	if req.Proxy != nil {
+		update.Proxy = &gows.ProxyConfig{Url: req.Proxy.Url}
+	}
+	if req.Ignore != nil {
+		update.Ignore = &gows.IgnoreJidsConfig{
+			Status:      req.Ignore.Status,
+			Groups:      req.Ignore.Groups,
+			Newsletters: req.Ignore.Newsletters,
+			Broadcast:   req.Ignore.Broadcast,
+		}
+	}
+	if req.SendRate != nil {
+		sendRate := buildSendRateConfig(req.SendRate)
+		update.SendRate = &sendRate
+	}
+	result, err := s.Sm.Update(req.GetSession().GetId(), update)
+	if err != nil {
+		return nil, err
+	}
+	return &__.UpdateSessionConfigResponse{
+		Config:      toSessionConfigProto(result.Config),
+		Updated:     result.Updated,
+		Reconnected: result.Reconnected,
+	}, nil
+}
+
+func (s *Server) GetSendQueue(ctx context.Context, req *__.Session) (*__.SendQueue, error) {
+	cli, err := s.Sm.Get(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	queue := cli.SendQueue()
+	chats := make([]*__.SendQueueChat, 0, len(queue.Chats))
+	for _, chat := range queue.SortedChats() {
+		chats = append(chats, &__.SendQueueChat{Jid: chat.String(), Pending: uint32(queue.Chats[chat])})
+	}
+	return &__.SendQueue{Pending: uint32(queue.Pending), Chats: chats}, nil
+}
+
+// SetLogLevel changes the level of the session or, without the session, of the server and all sessions.
+// Session levels are saved in their config, so they're kept after restart.
+func (s *Server) SetLogLevel(ctx context.Context, req *__.SetLogLevelRequest) (*__.Empty, error) {
+	level := req.GetLevel().String()
+	update := gows.SessionConfigUpdate{Log: &gows.LogConfig{Level: level}}
+	if session := req.GetSession().GetId(); session != "" {
+		_, err := s.Sm.Update(session, update)
+		if err != nil {
+			return nil, err
+		}
+		return &__.Empty{}, nil
+	}
 
+	err := gowsLog.SetServerLevel(level)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	for _, info := range s.Sm.List() {
+		_, err = s.Sm.Update(info.Name, update)
+		if errors.Is(err, gows.ErrSessionNotFound) {
+			// Stopped meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.log.Infof("Log level set to %s", level)
 	return &__.Empty{}, nil
 }
 
@@ -91,7 +318,15 @@ func (s *Server) GetSessionState(ctx context.Context, req *__.Session) (*__.Sess
 	if err != nil {
 		return nil, err
 	}
-	return &__.SessionStateResponse{Found: true, Connected: cli.IsConnected()}, nil
+	state := cli.GetState()
+	return &__.SessionStateResponse{
+		Found:     true,
+		Connected: cli.IsConnected(),
+		Status:    __.SessionStatus(__.SessionStatus_value[string(state.Status)]),
+		LastError: state.LastError,
+		StartedAt: state.StartedAt.Unix(),
+		ChangedAt: state.ChangedAt.Unix(),
+	}, nil
 }
 
 func (s *Server) RequestCode(ctx context.Context, req *__.PairCodeRequest) (*__.PairCodeResponse, error) {
@@ -99,12 +334,13 @@ func (s *Server) RequestCode(ctx context.Context, req *__.PairCodeRequest) (*__.
 	if err != nil {
 		return nil, err
 	}
+	clientType, displayName := cli.PairClient()
 	code, err := cli.PairPhone(
 		ctx,
 		req.GetPhone(),
 		true,
-		whatsmeow.PairClientChrome,
-		"Chrome (Linux)",
+		clientType,
+		displayName,
 	)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/devlikeapro/gows/gows"
+	"github.com/devlikeapro/gows/proto"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// EventEnvelopeVersion - the version of the typed event envelope (Event), bumped on breaking changes
+const EventEnvelopeVersion = 1
+
+// typedEventTypes - events with typed payloads, used to decode them back from the journal on replay
+var typedEventTypes = map[string]func() interface{}{
+	"events.Message":            func() interface{} { return &events.Message{} },
+	"events.Receipt":            func() interface{} { return &events.Receipt{} },
+	"events.Presence":           func() interface{} { return &events.Presence{} },
+	"events.ChatPresence":       func() interface{} { return &events.ChatPresence{} },
+	"events.GroupInfo":          func() interface{} { return &events.GroupInfo{} },
+	"events.CallOffer":          func() interface{} { return &events.CallOffer{} },
+	"whatsmeow.QRChannelItem":   func() interface{} { return &whatsmeow.QRChannelItem{} },
+	"gows.ConnectedEventData":   func() interface{} { return &gows.ConnectedEventData{} },
+	"gows.PollVoteEvent":        func() interface{} { return &gows.PollVoteEvent{} },
+	"gows.EventMessageResponse": func() interface{} { return &gows.EventMessageResponse{} },
+}
+
+// toTypedEvent builds the typed envelope for the event.
+// raw is the event as emitted by the session, nil if it's known as JSON only (replayed from the journal).
+func toTypedEvent(event *__.EventJson, raw interface{}) *__.Event {
+	typed := &__.Event{
+		Version:  EventEnvelopeVersion,
+		Session:  event.Session,
+		Type:     event.Event,
+		Sequence: event.Sequence,
+	}
+	if raw == nil {
+		raw = decodeJournalEvent(event.Event, event.Data)
+	}
+	if !setTypedPayload(typed, raw) {
+		typed.Payload = &__.Event_Json{Json: event.Data}
+	}
+	return typed
+}
+
+// decodeJournalEvent restores the event from JSON, nil if it has no typed payload or can't be decoded
+func decodeJournalEvent(eventType string, data string) interface{} {
+	build, ok := typedEventTypes[eventType]
+	if !ok {
+		return nil
+	}
+	event := build()
+	err := json.Unmarshal([]byte(data), event)
+	if err != nil {
+		return nil
+	}
+	return event
+}
+
+// setTypedPayload sets the payload for the event, false if the event has no typed payload
+func setTypedPayload(typed *__.Event, raw interface{}) bool {
+	switch event := raw.(type) {
+	case *events.Message:
+		typed.Payload = &__.Event_Message{Message: toMessageEvent(event)}
+	case *events.Receipt:
+		typed.Payload = &__.Event_Receipt{Receipt: &__.ReceiptEvent{
+			Chat:          event.Chat.String(),
+			Sender:        event.Sender.String(),
+			FromMe:        event.IsFromMe,
+			IsGroup:       event.IsGroup,
+			MessageIds:    event.MessageIDs,
+			Timestamp:     toUnix(event.Timestamp),
+			Type:          string(event.Type),
+			MessageSender: jidString(event.MessageSender),
+		}}
+	case *events.Presence:
+		typed.Payload = &__.Event_Presence{Presence: &__.PresenceEvent{
+			From:        event.From.String(),
+			Unavailable: event.Unavailable,
+			LastSeen:    toUnix(event.LastSeen),
+		}}
+	case *events.ChatPresence:
+		typed.Payload = &__.Event_ChatPresence{ChatPresence: &__.ChatPresenceEvent{
+			Chat:    event.Chat.String(),
+			Sender:  event.Sender.String(),
+			FromMe:  event.IsFromMe,
+			IsGroup: event.IsGroup,
+			State:   string(event.State),
+			Media:   string(event.Media),
+		}}
+	case *events.GroupInfo:
+		typed.Payload = &__.Event_GroupInfo{GroupInfo: toGroupInfoEvent(event)}
+	case *events.CallOffer:
+		typed.Payload = &__.Event_CallOffer{CallOffer: &__.CallOfferEvent{
+			CallId:         event.CallID,
+			From:           event.From.String(),
+			CallCreator:    event.CallCreator.String(),
+			GroupJid:       jidString(event.GroupJID),
+			Timestamp:      toUnix(event.Timestamp),
+			RemotePlatform: event.RemotePlatform,
+			RemoteVersion:  event.RemoteVersion,
+		}}
+	case whatsmeow.QRChannelItem:
+		typed.Payload = &__.Event_Qr{Qr: toQRCodeEvent(&event)}
+	case *whatsmeow.QRChannelItem:
+		typed.Payload = &__.Event_Qr{Qr: toQRCodeEvent(event)}
+	case *gows.ConnectedEventData:
+		connected := &__.ConnectedEvent{PushName: event.PushName}
+		if event.ID != nil {
+			connected.Id = event.ID.String()
+		}
+		if event.LID != nil {
+			connected.Lid = jidString(*event.LID)
+		}
+		typed.Payload = &__.Event_Connected{Connected: connected}
+	case *gows.PollVoteEvent:
+		vote := &__.PollVoteEvent{}
+		if event.Message != nil {
+			vote.Info = toEventMessageInfo(&event.Message.Info)
+			vote.Message = marshalProto(event.Message.Message)
+		}
+		if event.Votes != nil {
+			vote.Votes = *event.Votes
+		}
+		typed.Payload = &__.Event_PollVote{PollVote: vote}
+	case *gows.EventMessageResponse:
+		response := &__.EventResponseEvent{}
+		if event.EventResponse != nil {
+			response.Response, _ = proto.Marshal(event.EventResponse)
+		}
+		if event.Message != nil {
+			response.Info = toEventMessageInfo(&event.Message.Info)
+			response.Message = marshalProto(event.Message.Message)
+		}
+		typed.Payload = &__.Event_EventResponse{EventResponse: response}
+	default:
+		return false
+	}
+	return true
+}
+
+func toMessageEvent(event *events.Message) *__.MessageEvent {
+	return &__.MessageEvent{
+		Info:                  toEventMessageInfo(&event.Info),
+		Message:               marshalProto(event.Message),
+		IsEphemeral:           event.IsEphemeral,
+		IsViewOnce:            event.IsViewOnce,
+		IsDocumentWithCaption: event.IsDocumentWithCaption,
+		IsEdit:                event.IsEdit,
+	}
+}
+
+func toEventMessageInfo(info *types.MessageInfo) *__.EventMessageInfo {
+	return &__.EventMessageInfo{
+		Id:        info.ID,
+		Chat:      info.Chat.String(),
+		Sender:    info.Sender.String(),
+		SenderAlt: jidString(info.SenderAlt),
+		FromMe:    info.IsFromMe,
+		IsGroup:   info.IsGroup,
+		Timestamp: toUnix(info.Timestamp),
+		PushName:  info.PushName,
+		Type:      info.Type,
+		MediaType: info.MediaType,
+		Category:  info.Category,
+		Edit:      string(info.Edit),
+	}
+}
+
+func toGroupInfoEvent(event *events.GroupInfo) *__.GroupInfoEvent {
+	info := &__.GroupInfoEvent{
+		Jid:           event.JID.String(),
+		Notify:        event.Notify,
+		Timestamp:     toUnix(event.Timestamp),
+		Join:          jidStrings(event.Join),
+		Leave:         jidStrings(event.Leave),
+		Promote:       jidStrings(event.Promote),
+		Demote:        jidStrings(event.Demote),
+		NewInviteLink: event.NewInviteLink,
+	}
+	if event.Sender != nil {
+		info.Sender = event.Sender.String()
+	}
+	if event.Name != nil {
+		info.Name = proto.String(event.Name.Name)
+	}
+	if event.Topic != nil {
+		info.Topic = proto.String(event.Topic.Topic)
+	}
+	if event.Locked != nil {
+		info.Locked = proto.Bool(event.Locked.IsLocked)
+	}
+	if event.Announce != nil {
+		info.Announce = proto.Bool(event.Announce.IsAnnounce)
+	}
+	if event.Ephemeral != nil {
+		timer := uint32(0)
+		if event.Ephemeral.IsEphemeral {
+			timer = event.Ephemeral.DisappearingTimer
+		}
+		info.Ephemeral = proto.Uint32(timer)
+	}
+	return info
+}
+
+func toQRCodeEvent(item *whatsmeow.QRChannelItem) *__.QRCodeEvent {
+	qr := &__.QRCodeEvent{
+		Event:     item.Event,
+		Code:      item.Code,
+		TimeoutMs: item.Timeout.Milliseconds(),
+	}
+	if item.Error != nil {
+		qr.Error = item.Error.Error()
+	}
+	return qr
+}
+
+func marshalProto(message *waE2E.Message) []byte {
+	if message == nil {
+		return nil
+	}
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func toUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func jidString(jid types.JID) string {
+	if jid.IsEmpty() {
+		return ""
+	}
+	return jid.String()
+}
+
+func jidStrings(jids []types.JID) []string {
+	if len(jids) == 0 {
+		return nil
+	}
+	result := make([]string, len(jids))
+	for i, jid := range jids {
+		result[i] = jid.String()
+	}
+	return result
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/devlikeapro/gows/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestToTypedEvent(t *testing.T) {
+	message := &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{
+				Chat:   types.NewJID("123", types.DefaultUserServer),
+				Sender: types.NewJID("123", types.DefaultUserServer),
+			},
+			ID:        "msg-1",
+			Timestamp: time.Unix(1700000000, 0),
+		},
+		Message: &waE2E.Message{Conversation: proto.String("hello")},
+	}
+	data, err := json.Marshal(message)
+	require.NoError(t, err)
+	event := &__.EventJson{Session: "default", Event: "events.Message", Data: string(data), Sequence: 5}
+
+	// From the session and replayed from the journal - the same payload
+	for _, raw := range []interface{}{message, nil} {
+		typed := toTypedEvent(event, raw)
+		assert.Equal(t, uint32(EventEnvelopeVersion), typed.Version)
+		assert.Equal(t, uint64(5), typed.Sequence)
+		payload := typed.GetMessage()
+		require.NotNil(t, payload)
+		assert.Equal(t, "msg-1", payload.Info.Id)
+		assert.Equal(t, "123@s.whatsapp.net", payload.Info.Chat)
+		assert.Equal(t, int64(1700000000), payload.Info.Timestamp)
+		var content waE2E.Message
+		require.NoError(t, proto.Unmarshal(payload.Message, &content))
+		assert.Equal(t, "hello", content.GetConversation())
+	}
+
+	// Events without typed payload are sent as JSON
+	typed := toTypedEvent(&__.EventJson{Event: "events.Picture", Data: `{"x":1}`}, &events.Picture{})
+	assert.Equal(t, `{"x":1}`, typed.GetJson())
+}
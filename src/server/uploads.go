@@ -0,0 +1,296 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devlikeapro/gows/gows"
+	"github.com/devlikeapro/gows/proto"
+	"github.com/google/uuid"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DefaultUploadTTL = time.Hour
+	// DefaultUploadMaxSize - the largest document WhatsApp accepts
+	DefaultUploadMaxSize = 2 * 1024 * 1024 * 1024
+	// mediaChunkSize - size of data in every MediaChunk
+	mediaChunkSize = 1024 * 1024
+	// maxInMemoryMediaSize - uploaded media up to it is read into memory for thumbnails,
+	// larger files are sent without them
+	maxInMemoryMediaSize  = 32 * 1024 * 1024
+	uploadCleanupInterval = time.Minute
+	uploadFilePrefix      = "upload-"
+	downloadFilePrefix    = "download-"
+)
+
+// mediaUpload is a file uploaded with UploadMedia, waiting to be sent
+type mediaUpload struct {
+	id        string
+	session   string
+	path      string
+	size      int64
+	expiresAt time.Time
+}
+
+// uploadSpool keeps uploaded media on disk until it expires.
+// Uploads are not persisted - they're removed on shutdown and unknown files are removed on cleanup.
+type uploadSpool struct {
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+
+	lock    sync.Mutex
+	uploads map[string]*mediaUpload
+}
+
+func newUploadSpool(dir string, ttl time.Duration, maxSize int64) *uploadSpool {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "gows-media")
+	}
+	if ttl <= 0 {
+		ttl = DefaultUploadTTL
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultUploadMaxSize
+	}
+	return &uploadSpool{dir: dir, ttl: ttl, maxSize: maxSize, uploads: map[string]*mediaUpload{}}
+}
+
+// createFile creates a file in the spool directory, the caller removes it
+func (u *uploadSpool) createFile(prefix string) (*os.File, error) {
+	err := os.MkdirAll(u.dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(u.dir, prefix+"*")
+}
+
+func (u *uploadSpool) add(upload *mediaUpload) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	upload.expiresAt = time.Now().Add(u.ttl)
+	u.uploads[upload.id] = upload
+}
+
+// open returns the upload of the session, uploads of other sessions are not found
+func (u *uploadSpool) open(session string, id string) (*os.File, *mediaUpload, error) {
+	u.lock.Lock()
+	upload, ok := u.uploads[id]
+	u.lock.Unlock()
+	if !ok || upload.session != session || time.Now().After(upload.expiresAt) {
+		return nil, nil, status.Errorf(codes.NotFound, "upload '%s' not found, it may have expired", id)
+	}
+	file, err := os.Open(upload.path)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.NotFound, "upload '%s' not found: %v", id, err)
+	}
+	return file, upload, nil
+}
+
+// cleanup removes expired uploads and files left from previous runs
+func (u *uploadSpool) cleanup(now time.Time) {
+	u.lock.Lock()
+	known := make(map[string]bool, len(u.uploads))
+	for id, upload := range u.uploads {
+		if now.After(upload.expiresAt) {
+			delete(u.uploads, id)
+			_ = os.Remove(upload.path)
+			continue
+		}
+		known[upload.path] = true
+	}
+	u.lock.Unlock()
+
+	entries, err := os.ReadDir(u.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, uploadFilePrefix) && !strings.HasPrefix(name, downloadFilePrefix) {
+			continue
+		}
+		path := filepath.Join(u.dir, name)
+		info, err := entry.Info()
+		if err != nil || known[path] || now.Sub(info.ModTime()) < u.ttl {
+			continue
+		}
+		_ = os.Remove(path)
+	}
+}
+
+func (u *uploadSpool) run(done <-chan struct{}) {
+	ticker := time.NewTicker(uploadCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			u.cleanup(now)
+		}
+	}
+}
+
+// removeAll removes all uploads, they can't be used after restart anyway
+func (u *uploadSpool) removeAll() {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	for id, upload := range u.uploads {
+		_ = os.Remove(upload.path)
+		delete(u.uploads, id)
+	}
+}
+
+// UploadMaxSize returns the largest media accepted by UploadMedia
+func (s *Server) UploadMaxSize() int64 {
+	return s.uploads.maxSize
+}
+
+func (s *Server) UploadMedia(stream __.MessageService_UploadMediaServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	session := req.GetSession().GetId()
+	_, err = s.Sm.Get(session)
+	if err != nil {
+		return err
+	}
+
+	file, err := s.uploads.createFile(uploadFilePrefix)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to create upload file: %v", err)
+	}
+	upload := &mediaUpload{id: uuid.NewString(), session: session, path: file.Name()}
+	added := false
+	defer func() {
+		_ = file.Close()
+		if !added {
+			_ = os.Remove(upload.path)
+		}
+	}()
+
+	hash := sha256.New()
+	writer := io.MultiWriter(file, hash)
+	for {
+		if id := req.GetSession().GetId(); id != "" && id != session {
+			return status.Error(codes.InvalidArgument, "all messages must be for the same session")
+		}
+		upload.size += int64(len(req.GetData()))
+		if upload.size > s.uploads.maxSize {
+			return status.Errorf(codes.ResourceExhausted, "media is larger than %d bytes", s.uploads.maxSize)
+		}
+		_, err = writer.Write(req.GetData())
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to write upload: %v", err)
+		}
+		req, err = stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if upload.size == 0 {
+		return status.Error(codes.InvalidArgument, "media is empty")
+	}
+	err = file.Sync()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to write upload: %v", err)
+	}
+
+	s.uploads.add(upload)
+	added = true
+	return stream.SendAndClose(&__.UploadMediaResponse{
+		UploadId:  upload.id,
+		Size:      uint64(upload.size),
+		Sha256:    hex.EncodeToString(hash.Sum(nil)),
+		ExpiresAt: upload.expiresAt.Unix(),
+	})
+}
+
+// mediaContent is the media of a message - in memory (Media.content) or in a file (Media.uploadId, Media.contentPath)
+type mediaContent struct {
+	data []byte
+	file *os.File
+	size int64
+}
+
+// openMediaContent finds the content of the media, the caller must close it
+func (s *Server) openMediaContent(session string, m *__.Media) (*mediaContent, error) {
+	var file *os.File
+	var err error
+	switch {
+	case m.GetUploadId() != "":
+		file, _, err = s.uploads.open(session, m.GetUploadId())
+		if err != nil {
+			return nil, err
+		}
+	case m.GetContentPath() != "":
+		file, err = os.Open(m.GetContentPath())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read media from file: %w", err)
+		}
+	default:
+		return &mediaContent{data: m.GetContent(), size: int64(len(m.GetContent()))}, nil
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to read media from file: %w", err)
+	}
+	return &mediaContent{file: file, size: info.Size()}, nil
+}
+
+func (c *mediaContent) Close() {
+	if c.file != nil {
+		_ = c.file.Close()
+	}
+}
+
+// bytes returns the whole content, nil if it's in a file larger than maxInMemoryMediaSize
+func (c *mediaContent) bytes() []byte {
+	if c.file == nil {
+		return c.data
+	}
+	if c.size > maxInMemoryMediaSize {
+		return nil
+	}
+	data, err := io.ReadAll(c.reader())
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// reader reads the content from the start, readers are independent
+func (c *mediaContent) reader() io.ReadSeeker {
+	if c.file == nil {
+		return bytes.NewReader(c.data)
+	}
+	return io.NewSectionReader(c.file, 0, c.size)
+}
+
+// upload sends the content to WhatsApp servers, files are streamed
+func (c *mediaContent) upload(ctx context.Context, cli *gows.GoWS, jid types.JID, mediaType whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	if c.file == nil {
+		return cli.UploadMedia(ctx, jid, c.data, mediaType)
+	}
+	return cli.UploadMediaReader(ctx, jid, c.reader(), c.size, mediaType)
+}
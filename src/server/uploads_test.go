@@ -0,0 +1,41 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUploadSpool(t *testing.T) {
+	spool := newUploadSpool(t.TempDir(), time.Hour, 0)
+	file, err := spool.createFile(uploadFilePrefix)
+	require.NoError(t, err)
+	_, err = file.WriteString("media")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	upload := &mediaUpload{id: "id", session: "default", path: file.Name(), size: 5}
+	spool.add(upload)
+
+	opened, _, err := spool.open("default", "id")
+	require.NoError(t, err)
+	_ = opened.Close()
+
+	// Other sessions can't use the upload
+	_, _, err = spool.open("other", "id")
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// Files left from previous runs are removed with expired uploads
+	stale := filepath.Join(spool.dir, uploadFilePrefix+"stale")
+	require.NoError(t, os.WriteFile(stale, []byte("media"), 0600))
+	spool.cleanup(time.Now().Add(2 * time.Hour))
+	assert.NoFileExists(t, stale)
+	assert.NoFileExists(t, upload.path)
+	_, _, err = spool.open("default", "id")
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
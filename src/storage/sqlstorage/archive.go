@@ -0,0 +1,365 @@
+package sqlstorage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+// ArchiveVersion - the version of the archive format written by Export
+const ArchiveVersion = 1
+
+// ArchiveTables - tables that make up a session, in the order they're restored (parents first).
+// whatsmeow device store first, then gows_* tables.
+var ArchiveTables = []string{
+	"whatsmeow_device",
+	"whatsmeow_identity_keys",
+	"whatsmeow_pre_keys",
+	"whatsmeow_sessions",
+	"whatsmeow_sender_keys",
+	"whatsmeow_app_state_sync_keys",
+	"whatsmeow_app_state_version",
+	"whatsmeow_app_state_mutation_macs",
+	"whatsmeow_contacts",
+	"whatsmeow_chat_settings",
+	"whatsmeow_message_secrets",
+	"whatsmeow_privacy_tokens",
+	"whatsmeow_lid_map",
+	"whatsmeow_event_buffer",
+	MessageTable.Name,
+	GroupTable.Name,
+	ChatEphemeralSettingsTable.Name,
+	LabelsTable.Name,
+	LabelAssociationsTable.Name,
+	EventsTable.Name,
+	WebhookQueueTable.Name,
+	IdempotencyKeysTable.Name,
+	OutboxTable.Name,
+}
+
+var ErrStoreNotEmpty = errors.New("store is not empty, import requires an empty store")
+
+// The archive is a gzipped stream of JSON lines:
+// a header, then for every table - the table line with columns followed by its rows
+type archiveLine struct {
+	Header *archiveHeader `json:"header,omitempty"`
+	Table  *archiveTable  `json:"table,omitempty"`
+	Row    []archiveValue `json:"row,omitempty"`
+}
+
+type archiveHeader struct {
+	Version    int       `json:"version"`
+	Dialect    string    `json:"dialect"`
+	ExportedAt time.Time `json:"exportedAt"`
+}
+
+type archiveTable struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+}
+
+// archiveValue keeps a column value portable between dialects.
+// Bytes and time are wrapped into objects, so they're not confused with strings on import.
+type archiveValue struct {
+	value interface{}
+}
+
+type archiveTypedValue struct {
+	Bytes *string `json:"b,omitempty"`
+	Time  *string `json:"t,omitempty"`
+}
+
+func (v archiveValue) MarshalJSON() ([]byte, error) {
+	switch value := v.value.(type) {
+	case []byte:
+		encoded := base64.StdEncoding.EncodeToString(value)
+		return json.Marshal(archiveTypedValue{Bytes: &encoded})
+	case time.Time:
+		encoded := value.UTC().Format(time.RFC3339Nano)
+		return json.Marshal(archiveTypedValue{Time: &encoded})
+	default:
+		return json.Marshal(value)
+	}
+}
+
+func (v *archiveValue) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return errors.New("empty value")
+	}
+	switch data[0] {
+	case 'n':
+		v.value = nil
+	case '{':
+		var typed archiveTypedValue
+		err := json.Unmarshal(data, &typed)
+		if err != nil {
+			return err
+		}
+		switch {
+		case typed.Bytes != nil:
+			v.value, err = base64.StdEncoding.DecodeString(*typed.Bytes)
+		case typed.Time != nil:
+			v.value, err = time.Parse(time.RFC3339Nano, *typed.Time)
+		default:
+			err = fmt.Errorf("unknown value: %s", data)
+		}
+		return err
+	case '"':
+		var value string
+		err := json.Unmarshal(data, &value)
+		v.value = value
+		return err
+	case 't', 'f':
+		var value bool
+		err := json.Unmarshal(data, &value)
+		v.value = value
+		return err
+	default:
+		number := json.Number(data)
+		if value, err := number.Int64(); err == nil {
+			v.value = value
+			return nil
+		}
+		value, err := number.Float64()
+		v.value = value
+		return err
+	}
+	return nil
+}
+
+// Export writes all session tables to w as a portable archive, which can be imported into any dialect
+func (c *GContainer) Export(ctx context.Context, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	buffered := bufio.NewWriter(gz)
+	encoder := json.NewEncoder(buffered)
+
+	err := encoder.Encode(archiveLine{Header: &archiveHeader{
+		Version:    ArchiveVersion,
+		Dialect:    c.dialect,
+		ExportedAt: time.Now().UTC(),
+	}})
+	if err != nil {
+		return err
+	}
+	for _, table := range ArchiveTables {
+		err = c.exportTable(ctx, table, encoder)
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %w", table, err)
+		}
+	}
+
+	err = buffered.Flush()
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func (c *GContainer) exportTable(ctx context.Context, table string, encoder *json.Encoder) error {
+	query, args, err := sq.Select("*").From(table).ToSql()
+	if err != nil {
+		return err
+	}
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	err = encoder.Encode(archiveLine{Table: &archiveTable{Name: table, Columns: columns}})
+	if err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	row := make([]archiveValue, len(columns))
+	for rows.Next() {
+		err = rows.Scan(pointers...)
+		if err != nil {
+			return err
+		}
+		for i, value := range values {
+			row[i] = archiveValue{value: value}
+		}
+		err = encoder.Encode(archiveLine{Row: row})
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Import restores an archive written by Export (from any dialect) into the store.
+// The store must be empty, everything is restored in one transaction.
+func (c *GContainer) Import(ctx context.Context, r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer gz.Close()
+	decoder := json.NewDecoder(bufio.NewReader(gz))
+
+	var line archiveLine
+	err = decoder.Decode(&line)
+	if err != nil {
+		return fmt.Errorf("failed to read archive header: %w", err)
+	}
+	if line.Header == nil {
+		return errors.New("failed to read archive header: not a session archive")
+	}
+	if line.Header.Version > ArchiveVersion {
+		return fmt.Errorf("unsupported archive version %d", line.Header.Version)
+	}
+
+	for _, table := range ArchiveTables {
+		empty, err := c.isEmpty(ctx, table)
+		if err != nil {
+			return fmt.Errorf("failed to check %s: %w", table, err)
+		}
+		if !empty {
+			return fmt.Errorf("%w: %s has rows", ErrStoreNotEmpty, table)
+		}
+	}
+
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var insert *sqlx.Stmt
+	var table *archiveTable
+	var columns []int
+	for {
+		line = archiveLine{}
+		err = decoder.Decode(&line)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		switch {
+		case line.Table != nil:
+			if insert != nil {
+				_ = insert.Close()
+			}
+			table = line.Table
+			insert, columns, err = c.prepareInsert(ctx, tx, table)
+			if err != nil {
+				return fmt.Errorf("failed to import %s: %w", table.Name, err)
+			}
+		case line.Row != nil:
+			if table == nil {
+				return errors.New("failed to read archive: row before table")
+			}
+			if len(line.Row) != len(table.Columns) {
+				return fmt.Errorf("failed to import %s: row has %d values, expected %d", table.Name, len(line.Row), len(table.Columns))
+			}
+			args := make([]interface{}, 0, len(columns))
+			for _, i := range columns {
+				args = append(args, line.Row[i].value)
+			}
+			_, err = insert.ExecContext(ctx, args...)
+			if err != nil {
+				return fmt.Errorf("failed to import %s: %w", table.Name, err)
+			}
+		}
+	}
+	if insert != nil {
+		_ = insert.Close()
+	}
+	return tx.Commit()
+}
+
+// prepareInsert prepares the insert for columns present in both the archive and the store,
+// returns indexes of these columns in the archive rows
+func (c *GContainer) prepareInsert(ctx context.Context, tx *sqlx.Tx, table *archiveTable) (*sqlx.Stmt, []int, error) {
+	known := false
+	for _, name := range ArchiveTables {
+		if name == table.Name {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return nil, nil, errors.New("unknown table")
+	}
+
+	existing, err := c.columns(ctx, tx, table.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	var indexes []int
+	for i, column := range table.Columns {
+		if existing[column] {
+			names = append(names, column)
+			indexes = append(indexes, i)
+		}
+	}
+	placeholders := make([]interface{}, len(names))
+	query, _, err := sq.Insert(table.Name).Columns(names...).Values(placeholders...).ToSql()
+	if err != nil {
+		return nil, nil, err
+	}
+	stmt, err := tx.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return stmt, indexes, nil
+}
+
+func (c *GContainer) columns(ctx context.Context, tx *sqlx.Tx, table string) (map[string]bool, error) {
+	query, args, err := sq.Select("*").From(table).Limit(1).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		existing[column] = true
+	}
+	return existing, nil
+}
+
+func (c *GContainer) isEmpty(ctx context.Context, table string) (bool, error) {
+	query, args, err := sq.Select("1").From(table).Limit(1).ToSql()
+	if err != nil {
+		return false, err
+	}
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	return !rows.Next(), rows.Err()
+}
@@ -0,0 +1,71 @@
+package sqlstorage
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+func newSqliteContainer(t *testing.T, name string) *GContainer {
+	address := "file:" + filepath.Join(t.TempDir(), name) + "?_foreign_keys=on"
+	container, err := New("sqlite3", address, waLog.Noop)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = container.Close() })
+	return container
+}
+
+func TestGContainerExportImport(t *testing.T) {
+	ctx := context.Background()
+	source := newSqliteContainer(t, "source.db")
+	timestamp := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	_, err := source.db.Exec(
+		"INSERT INTO gows_messages (jid, id, timestamp, from_me, is_real, data) VALUES ($1, $2, $3, $4, $5, $6)",
+		"123@s.whatsapp.net", "msg-1", timestamp, true, false, `{"text":"hello"}`,
+	)
+	require.NoError(t, err)
+	_, err = source.db.Exec("INSERT INTO gows_labels (id, data) VALUES ($1, $2)", "1", `{"name":"label"}`)
+	require.NoError(t, err)
+	_, err = source.db.Exec("INSERT INTO gows_label_associations (jid, label_id, data) VALUES ($1, $2, $3)", "123@s.whatsapp.net", "1", "{}")
+	require.NoError(t, err)
+	_, err = source.db.Exec("INSERT INTO whatsmeow_lid_map (lid, pn) VALUES ($1, $2)", "111", "123")
+	require.NoError(t, err)
+
+	archive := &bytes.Buffer{}
+	require.NoError(t, source.Export(ctx, archive))
+
+	target := newSqliteContainer(t, "target.db")
+	require.NoError(t, target.Import(ctx, bytes.NewReader(archive.Bytes())))
+
+	var message struct {
+		Jid       string    `db:"jid"`
+		Timestamp time.Time `db:"timestamp"`
+		FromMe    bool      `db:"from_me"`
+		IsReal    bool      `db:"is_real"`
+		Data      string    `db:"data"`
+	}
+	err = target.db.Get(&message, "SELECT jid, timestamp, from_me, is_real, data FROM gows_messages WHERE id = $1", "msg-1")
+	require.NoError(t, err)
+	assert.Equal(t, "123@s.whatsapp.net", message.Jid)
+	assert.True(t, timestamp.Equal(message.Timestamp))
+	assert.True(t, message.FromMe)
+	assert.False(t, message.IsReal)
+	assert.Equal(t, `{"text":"hello"}`, message.Data)
+
+	var count int
+	require.NoError(t, target.db.Get(&count, "SELECT COUNT(*) FROM gows_label_associations"))
+	assert.Equal(t, 1, count)
+	lids, err := target.NewLidmapStorage().GetAllLidMap()
+	require.NoError(t, err)
+	assert.Len(t, lids, 1)
+
+	// Import never merges into an existing session
+	err = target.Import(ctx, bytes.NewReader(archive.Bytes()))
+	assert.ErrorIs(t, err, ErrStoreNotEmpty)
+}
@@ -1,6 +1,7 @@
 package sqlstorage
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -25,8 +26,8 @@ type SqlChatEphemeralSettingStore struct {
 
 var _ storage.ChatEphemeralSettingStorage = (*SqlChatEphemeralSettingStore)(nil)
 
-func (s *SqlChatEphemeralSettingStore) GetChatEphemeralSetting(id types.JID) (*storage.StoredChatEphemeralSetting, error) {
-	return s.GetById(id.String())
+func (s *SqlChatEphemeralSettingStore) GetChatEphemeralSetting(ctx context.Context, id types.JID) (*storage.StoredChatEphemeralSetting, error) {
+	return s.GetByIdContext(ctx, id.String())
 }
 
 func (s *SqlChatEphemeralSettingStore) UpdateChatEphemeralSetting(setting *storage.StoredChatEphemeralSetting) error {
@@ -39,7 +40,7 @@ func (s *SqlChatEphemeralSettingStore) UpdateChatEphemeralSetting(setting *stora
 
 func (s *SqlChatEphemeralSettingStore) DeleteChatEphemeralSetting(id types.JID, deleteBefore time.Time) error {
 	// First get the current setting to check its timestamp
-	setting, err := s.GetChatEphemeralSetting(id)
+	setting, err := s.GetChatEphemeralSetting(context.Background(), id)
 	if errors.Is(err, storage.ErrNotFound) {
 		// Totally fine, already got removed
 		return nil
@@ -1,6 +1,7 @@
 package sqlstorage
 
 import (
+	"context"
 	sq "github.com/Masterminds/squirrel"
 	"github.com/devlikeapro/gows/storage"
 	"github.com/jmoiron/sqlx"
@@ -76,7 +77,9 @@ func (kv *EntityRepository[Entity]) UpsertOne(entity *Entity) error {
 	if err != nil {
 		return err
 	}
+	done := observeQuery(context.Background(), kv.table.Name, "upsert")
 	_, err = kv.db.Exec(query, args...)
+	done(err)
 	return err
 }
 
@@ -88,15 +91,30 @@ func (kv *EntityRepository[Entity]) FilterBy(
 	conditions []sq.Sqlizer,
 	sort []storage.Sort,
 	pagination storage.Pagination,
+) (entities []*Entity, err error) {
+	return kv.FilterByContext(context.Background(), conditions, sort, pagination)
+}
+
+// FilterByContext is FilterBy with the query traced in ctx
+func (kv *EntityRepository[Entity]) FilterByContext(
+	ctx context.Context,
+	conditions []sq.Sqlizer,
+	sort []storage.Sort,
+	pagination storage.Pagination,
 ) (entities []*Entity, err error) {
 	sql := sq.Select(kv.table.DataField).From(kv.table.Name)
 	for _, cond := range conditions {
 		sql = sql.Where(cond)
 	}
-	return kv.Retrieve(sql, pagination, sort)
+	return kv.RetrieveContext(ctx, sql, pagination, sort)
 }
 
 func (kv *EntityRepository[Entity]) Retrieve(sql sq.SelectBuilder, pagination storage.Pagination, sort []storage.Sort) (entities []*Entity, err error) {
+	return kv.RetrieveContext(context.Background(), sql, pagination, sort)
+}
+
+// RetrieveContext is Retrieve with the query traced in ctx
+func (kv *EntityRepository[Entity]) RetrieveContext(ctx context.Context, sql sq.SelectBuilder, pagination storage.Pagination, sort []storage.Sort) (entities []*Entity, err error) {
 	if pagination.Limit > 0 {
 		sql = sql.Limit(pagination.Limit)
 	}
@@ -111,7 +129,9 @@ func (kv *EntityRepository[Entity]) Retrieve(sql sq.SelectBuilder, pagination st
 		return nil, err
 	}
 	var data []string
-	err = kv.db.Select(&data, query, args...)
+	done := observeQuery(ctx, kv.table.Name, "select")
+	err = kv.db.SelectContext(ctx, &data, query, args...)
+	done(err)
 	if err != nil {
 		return nil, err
 	}
@@ -127,7 +147,12 @@ func (kv *EntityRepository[Entity]) Retrieve(sql sq.SelectBuilder, pagination st
 }
 
 func (kv *EntityRepository[Entity]) GetBy(conditions []sq.Sqlizer) (entity *Entity, err error) {
-	entities, err := kv.FilterBy(conditions, make([]storage.Sort, 0), storage.Pagination{0, 1})
+	return kv.GetByContext(context.Background(), conditions)
+}
+
+// GetByContext is GetBy with the query traced in ctx
+func (kv *EntityRepository[Entity]) GetByContext(ctx context.Context, conditions []sq.Sqlizer) (entity *Entity, err error) {
+	entities, err := kv.FilterByContext(ctx, conditions, make([]storage.Sort, 0), storage.Pagination{0, 1})
 	if err != nil {
 		return nil, err
 	}
@@ -138,7 +163,12 @@ func (kv *EntityRepository[Entity]) GetBy(conditions []sq.Sqlizer) (entity *Enti
 }
 
 func (kv *EntityRepository[Entity]) GetById(id string) (entity *Entity, err error) {
-	return kv.GetBy([]sq.Sqlizer{sq.Eq{"id": id}})
+	return kv.GetByIdContext(context.Background(), id)
+}
+
+// GetByIdContext is GetById with the query traced in ctx
+func (kv *EntityRepository[Entity]) GetByIdContext(ctx context.Context, id string) (entity *Entity, err error) {
+	return kv.GetByContext(ctx, []sq.Sqlizer{sq.Eq{"id": id}})
 }
 
 func (kv *EntityRepository[Entity]) DeleteBy(conditions []sq.Sqlizer) error {
@@ -150,7 +180,9 @@ func (kv *EntityRepository[Entity]) DeleteBy(conditions []sq.Sqlizer) error {
 	if err != nil {
 		return err
 	}
+	done := observeQuery(context.Background(), kv.table.Name, "delete")
 	_, err = kv.db.Exec(query, args...)
+	done(err)
 	return err
 }
 
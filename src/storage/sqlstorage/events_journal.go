@@ -0,0 +1,207 @@
+package sqlstorage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/devlikeapro/gows/storage"
+	"github.com/jmoiron/sqlx"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// EventJournalSize - how many recent events the journal keeps
+var EventJournalSize uint64 = 10_000
+
+// eventJournalTrimEvery - trim the journal every N appends, not on every one
+const eventJournalTrimEvery = 100
+
+// eventJournalFlushInterval - appended events are written in batches, at most this late
+const eventJournalFlushInterval = 100 * time.Millisecond
+
+// eventJournalBatchSize - a batch is written right away when it has this many events,
+// bigger batches are split into inserts of this size
+const eventJournalBatchSize = 100
+
+var _ storage.EventJournal = (*SqlEventJournal)(nil)
+
+func (gc *GContainer) NewEventJournal(log waLog.Logger) *SqlEventJournal {
+	return &SqlEventJournal{
+		db:  gc.db,
+		log: log,
+	}
+}
+
+// SqlEventJournal assigns sequences right away and writes events in background batches,
+// so a slow database doesn't hold up the events.
+// Reads write the pending events first, they always see everything appended before.
+type SqlEventJournal struct {
+	db  *sqlx.DB
+	log waLog.Logger
+
+	lock sync.Mutex
+	// last - the last assigned sequence, loaded from the database on the first append
+	last   uint64
+	loaded bool
+	// pending - appended events waiting to be written, in sequence order
+	pending []*storage.JournalEvent
+
+	// writeLock - batches are written one at a time, in order
+	writeLock sync.Mutex
+}
+
+// Append assigns the next sequence to the event and queues it to be written.
+// Fails only if the last sequence can't be loaded on the first append.
+func (j *SqlEventJournal) Append(event *storage.JournalEvent) (uint64, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if !j.loaded {
+		last, err := j.maxSequence()
+		if err != nil {
+			return 0, err
+		}
+		j.last = last
+		j.loaded = true
+	}
+	j.last++
+	event.Sequence = j.last
+	event.Timestamp = time.Now().UTC()
+	j.pending = append(j.pending, event)
+	switch {
+	case len(j.pending) == 1:
+		time.AfterFunc(eventJournalFlushInterval, j.flushInBackground)
+	case len(j.pending) == eventJournalBatchSize:
+		go j.flushInBackground()
+	case uint64(len(j.pending)) > EventJournalSize:
+		// The database doesn't keep up - the oldest events would be trimmed anyway
+		j.pending = j.pending[1:]
+	}
+	return event.Sequence, nil
+}
+
+func (j *SqlEventJournal) flushInBackground() {
+	err := j.Flush()
+	if err != nil {
+		j.log.Warnf("Failed to record events in the journal, they can't be replayed: %v", err)
+	}
+}
+
+// Flush writes the pending events. Events failed to be written are not retried -
+// their sequences are never reused, they're just missing in the journal.
+func (j *SqlEventJournal) Flush() error {
+	j.writeLock.Lock()
+	defer j.writeLock.Unlock()
+	j.lock.Lock()
+	batch := j.pending
+	j.pending = nil
+	j.lock.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := j.insert(batch)
+	if err != nil {
+		return fmt.Errorf("failed to record %d event(s): %w", len(batch), err)
+	}
+	first, last := batch[0].Sequence, batch[len(batch)-1].Sequence
+	if last > EventJournalSize && last/eventJournalTrimEvery > (first-1)/eventJournalTrimEvery {
+		return j.trim(last - EventJournalSize)
+	}
+	return nil
+}
+
+// insert writes the events in one transaction
+func (j *SqlEventJournal) insert(events []*storage.JournalEvent) error {
+	tx, err := j.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for len(events) > 0 {
+		size := min(len(events), eventJournalBatchSize)
+		sql := sq.Insert(EventsTable.Name).Columns(EventsTable.Columns...)
+		for _, event := range events[:size] {
+			sql = sql.Values(event.Sequence, event.Timestamp, event.Event, event.Jid, event.FromMe, event.Data)
+		}
+		query, args, err := sql.ToSql()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+		events = events[size:]
+	}
+	return tx.Commit()
+}
+
+func (j *SqlEventJournal) Since(sequence uint64, limit uint64) ([]*storage.JournalEvent, error) {
+	err := j.Flush()
+	if err != nil {
+		return nil, err
+	}
+	sql := sq.Select(EventsTable.Columns...).
+		From(EventsTable.Name).
+		Where(sq.Gt{"sequence": sequence}).
+		OrderBy("sequence ASC")
+	if limit > 0 {
+		sql = sql.Limit(limit)
+	}
+	query, args, err := sql.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var result []*storage.JournalEvent
+	err = j.db.Select(&result, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (j *SqlEventJournal) Bounds() (oldest uint64, last uint64, err error) {
+	err = j.Flush()
+	if err != nil {
+		return 0, 0, err
+	}
+	query, args, err := sq.Select("MIN(sequence)", "MAX(sequence)").From(EventsTable.Name).ToSql()
+	if err != nil {
+		return 0, 0, err
+	}
+	var min, max sql.NullInt64
+	err = j.db.QueryRow(query, args...).Scan(&min, &max)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint64(min.Int64), uint64(max.Int64), nil
+}
+
+func (j *SqlEventJournal) maxSequence() (uint64, error) {
+	query, args, err := sq.Select("MAX(sequence)").From(EventsTable.Name).ToSql()
+	if err != nil {
+		return 0, err
+	}
+	var max sql.NullInt64
+	err = j.db.QueryRow(query, args...).Scan(&max)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return uint64(max.Int64), nil
+}
+
+// trim removes events up to the sequence (inclusive)
+func (j *SqlEventJournal) trim(sequence uint64) error {
+	query, args, err := sq.Delete(EventsTable.Name).Where(sq.LtOrEq{"sequence": sequence}).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = j.db.Exec(query, args...)
+	return err
+}
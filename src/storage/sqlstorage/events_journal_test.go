@@ -0,0 +1,96 @@
+package sqlstorage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/devlikeapro/gows/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+func TestSqlEventJournal(t *testing.T) {
+	container := newSqliteContainer(t, "journal.db")
+	journal := container.NewEventJournal(waLog.Noop)
+
+	for i := 1; i <= 3; i++ {
+		sequence, err := journal.Append(&storage.JournalEvent{Event: "events.Message", Data: "{}"})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(i), sequence)
+	}
+	events, err := journal.Since(1, 0)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, uint64(2), events[0].Sequence)
+	assert.Equal(t, "events.Message", events[0].Event)
+
+	// Sequences continue after restart
+	journal = container.NewEventJournal(waLog.Noop)
+	sequence, err := journal.Append(&storage.JournalEvent{Event: "events.Receipt", Jid: "123@s.whatsapp.net", Data: "{}"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), sequence)
+
+	// Old events are trimmed
+	size := EventJournalSize
+	EventJournalSize = 10
+	defer func() { EventJournalSize = size }()
+	for i := 5; i <= eventJournalTrimEvery; i++ {
+		_, err = journal.Append(&storage.JournalEvent{Event: "events.Message", Data: "{}"})
+		require.NoError(t, err)
+	}
+	oldest, last, err := journal.Bounds()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(eventJournalTrimEvery-9), oldest)
+	assert.Equal(t, uint64(eventJournalTrimEvery), last)
+}
+
+func TestSqlEventJournalFailedAppend(t *testing.T) {
+	container := newSqliteContainer(t, "journal.db")
+	journal := container.NewEventJournal(waLog.Noop)
+	sequence, err := journal.Append(&storage.JournalEvent{Event: "events.Message", Data: "{}"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), sequence)
+	require.NoError(t, journal.Flush())
+
+	// Another journal takes the next sequence - the insert fails
+	other := container.NewEventJournal(waLog.Noop)
+	_, err = other.Append(&storage.JournalEvent{Event: "events.Message", Data: "{}"})
+	require.NoError(t, err)
+	require.NoError(t, other.Flush())
+	sequence, err = journal.Append(&storage.JournalEvent{Event: "events.Message", Data: "{}"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), sequence)
+	assert.Error(t, journal.Flush())
+
+	// The failed event is not recorded and its sequence is not reused
+	sequence, err = journal.Append(&storage.JournalEvent{Event: "events.Message", Data: "{}"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), sequence)
+	events, err := journal.Since(0, 0)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, []uint64{1, 2, 3}, []uint64{events[0].Sequence, events[1].Sequence, events[2].Sequence})
+}
+
+func TestSqlEventJournalBatches(t *testing.T) {
+	container := newSqliteContainer(t, "journal.db")
+	journal := container.NewEventJournal(waLog.Noop)
+	for i := 1; i <= eventJournalBatchSize*3+1; i++ {
+		sequence, err := journal.Append(&storage.JournalEvent{Event: "events.Message", Data: "{}"})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(i), sequence)
+	}
+	// Written in background
+	assert.Eventually(t, func() bool {
+		_, last, err := container.NewEventJournal(waLog.Noop).Bounds()
+		return err == nil && last == eventJournalBatchSize*3+1
+	}, time.Second, 10*time.Millisecond)
+
+	// Reads see events not written yet
+	_, err := journal.Append(&storage.JournalEvent{Event: "events.Message", Data: "{}"})
+	require.NoError(t, err)
+	_, last, err := journal.Bounds()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(eventJournalBatchSize*3+2), last)
+}
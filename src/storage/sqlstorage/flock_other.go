@@ -0,0 +1,8 @@
+//go:build !unix
+
+package sqlstorage
+
+// lockFile - file locks are supported on unix only, the store is not protected
+func lockFile(path string) (StoreLock, error) {
+	return noLock{}, nil
+}
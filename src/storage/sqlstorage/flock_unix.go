@@ -0,0 +1,47 @@
+//go:build unix
+
+package sqlstorage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+type fileLock struct {
+	file *os.File
+}
+
+// lockFile takes the exclusive flock on the file, it's released by the OS if the process dies
+func lockFile(path string) (StoreLock, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		_ = file.Close()
+		return nil, fmt.Errorf("%w: %s is held", ErrStoreLocked, path)
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return &fileLock{file: file}, nil
+}
+
+// Lost - the flock is held until the file is closed
+func (l *fileLock) Lost() <-chan struct{} {
+	return nil
+}
+
+func (l *fileLock) Unlock() error {
+	// Keep the file - removing it would let another process lock a different inode
+	err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	closeErr := l.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -1,6 +1,7 @@
 package sqlstorage
 
 import (
+	"context"
 	"fmt"
 	sq "github.com/Masterminds/squirrel"
 	"github.com/devlikeapro/gows/storage"
@@ -25,7 +26,7 @@ type SqlGroupStore struct {
 
 var _ storage.GroupStorage = (*SqlGroupStore)(nil)
 
-func (s SqlGroupStore) FetchGroups(force bool) error {
+func (s SqlGroupStore) FetchGroups(ctx context.Context, force bool) error {
 	return fmt.Errorf("not implemented, use GroupCacheStorage as a wrapper")
 }
 
@@ -45,8 +46,8 @@ func (s SqlGroupStore) GetAllGroups(sort storage.Sort, pagination storage.Pagina
 	return s.FilterBy(conditions, sorts, pagination)
 }
 
-func (s SqlGroupStore) GetGroup(jid types.JID) (group *types.GroupInfo, err error) {
-	return s.GetById(jid.String())
+func (s SqlGroupStore) GetGroup(ctx context.Context, jid types.JID) (group *types.GroupInfo, err error) {
+	return s.GetByIdContext(ctx, jid.String())
 }
 
 func (s SqlGroupStore) DeleteGroup(jid types.JID) error {
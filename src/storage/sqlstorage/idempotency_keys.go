@@ -0,0 +1,94 @@
+package sqlstorage
+
+import (
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/devlikeapro/gows/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+// IdempotencyKeyTTL - how long keys are kept, retries after it send the message again
+var IdempotencyKeyTTL = 24 * time.Hour
+
+// idempotencyKeysTrimEvery - remove expired keys every N saves, not on every one
+const idempotencyKeysTrimEvery = 100
+
+var _ storage.IdempotencyKeyStorage = (*SqlIdempotencyKeyStorage)(nil)
+
+func (gc *GContainer) NewIdempotencyKeyStorage() *SqlIdempotencyKeyStorage {
+	return &SqlIdempotencyKeyStorage{
+		db: gc.db,
+	}
+}
+
+type SqlIdempotencyKeyStorage struct {
+	db    *sqlx.DB
+	saves atomic.Uint64
+}
+
+func (s *SqlIdempotencyKeyStorage) GetIdempotencyKey(id string) (*storage.IdempotencyKey, error) {
+	query, args, err := sq.Select(IdempotencyKeysTable.Columns...).
+		From(IdempotencyKeysTable.Name).
+		Where(sq.Eq{"id": id}).
+		Where(sq.GtOrEq{"created_at": time.Now().Add(-IdempotencyKeyTTL).UTC()}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var key storage.IdempotencyKey
+	err = s.db.Get(&key, query, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// SaveIdempotencyKey records the key, an expired key with the same id is replaced
+func (s *SqlIdempotencyKeyStorage) SaveIdempotencyKey(key *storage.IdempotencyKey) error {
+	if s.saves.Add(1)%idempotencyKeysTrimEvery == 0 {
+		err := s.trim()
+		if err != nil {
+			return err
+		}
+	}
+	query, args, err := sq.Delete(IdempotencyKeysTable.Name).
+		Where(sq.Eq{"id": key.ID}).
+		Where(sq.Lt{"created_at": time.Now().Add(-IdempotencyKeyTTL).UTC()}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	query, args, err = sq.Insert(IdempotencyKeysTable.Name).
+		Columns(IdempotencyKeysTable.Columns...).
+		Values(key.ID, key.Method, key.RequestHash, key.Response, key.CreatedAt.UTC()).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(query, args...)
+	return err
+}
+
+// trim removes expired keys
+func (s *SqlIdempotencyKeyStorage) trim() error {
+	query, args, err := sq.Delete(IdempotencyKeysTable.Name).
+		Where(sq.Lt{"created_at": time.Now().Add(-IdempotencyKeyTTL).UTC()}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(query, args...)
+	return err
+}
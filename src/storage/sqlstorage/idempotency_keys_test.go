@@ -0,0 +1,35 @@
+package sqlstorage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/devlikeapro/gows/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSqlIdempotencyKeyStorage(t *testing.T) {
+	keys := newSqliteContainer(t, "keys.db").NewIdempotencyKeyStorage()
+
+	_, err := keys.GetIdempotencyKey("key")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	key := &storage.IdempotencyKey{ID: "key", Method: "SendMessage", RequestHash: "hash", Response: `{"id":"1"}`, CreatedAt: time.Now()}
+	require.NoError(t, keys.SaveIdempotencyKey(key))
+	recorded, err := keys.GetIdempotencyKey("key")
+	require.NoError(t, err)
+	assert.Equal(t, "SendMessage", recorded.Method)
+	assert.Equal(t, `{"id":"1"}`, recorded.Response)
+
+	// Expired keys are not found and can be used again
+	key.CreatedAt = time.Now().Add(-IdempotencyKeyTTL - time.Minute)
+	key.ID = "expired"
+	require.NoError(t, keys.SaveIdempotencyKey(key))
+	_, err = keys.GetIdempotencyKey("expired")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	key.CreatedAt = time.Now()
+	require.NoError(t, keys.SaveIdempotencyKey(key))
+	_, err = keys.GetIdempotencyKey("expired")
+	assert.NoError(t, err)
+}
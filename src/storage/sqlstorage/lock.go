@@ -0,0 +1,176 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrStoreLocked - the session store is used by another process
+var ErrStoreLocked = errors.New("session store is locked by another process")
+
+// ErrStoreLockLost - the lock has been released behind our back, another process can take the store
+var ErrStoreLockLost = errors.New("session store lock has been lost")
+
+// lockRetryInterval - how often we try to take the lock while waiting for it
+const lockRetryInterval = time.Second
+
+// lockCheckInterval - how often we check the connection holding the Postgres advisory lock
+var lockCheckInterval = 10 * time.Second
+
+// StoreLock is an exclusive lock on the session store, held while the session is running,
+// so two processes never connect the same session.
+type StoreLock interface {
+	Unlock() error
+	// Lost is closed when the lock is released without Unlock, nil if the lock can't be lost
+	Lost() <-chan struct{}
+}
+
+// LockStore takes the exclusive lock on the store -
+// Postgres advisory lock for postgres, a file lock next to the database for sqlite.
+// Fails with ErrStoreLocked right away if wait is 0,
+// otherwise waits up to wait for the lock to be released (takeover).
+func LockStore(ctx context.Context, dialect string, address string, wait time.Duration) (StoreLock, error) {
+	var try func() (StoreLock, error)
+	switch {
+	case dialect == "sqlite3" || dialect == "sqlite":
+		path := sqlitePath(address)
+		if path == "" {
+			// In-memory database, nobody else can use it
+			return noLock{}, nil
+		}
+		try = func() (StoreLock, error) {
+			return lockFile(path + ".lock")
+		}
+	case dialect == "postgres":
+		try = func() (StoreLock, error) {
+			return lockPostgres(ctx, address)
+		}
+	default:
+		return nil, errors.New("unsupported sql dialect: " + dialect)
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		lock, err := try()
+		if !errors.Is(err, ErrStoreLocked) {
+			return lock, err
+		}
+		if !time.Now().Before(deadline) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+type noLock struct{}
+
+func (noLock) Unlock() error { return nil }
+
+func (noLock) Lost() <-chan struct{} { return nil }
+
+// sqlitePath extracts the database file path from the address, empty for in-memory databases
+func sqlitePath(address string) string {
+	path, query, _ := strings.Cut(address, "?")
+	path = strings.TrimPrefix(path, "file:")
+	params, _ := url.ParseQuery(query)
+	if path == "" || path == ":memory:" || params.Get("mode") == "memory" {
+		return ""
+	}
+	return path
+}
+
+type postgresLock struct {
+	db   *sql.DB
+	conn *sql.Conn
+	key  int64
+
+	lost chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// lockPostgres takes the session-level advisory lock on a dedicated connection,
+// the lock is held until the connection is closed - or dropped, so we keep checking it
+func lockPostgres(ctx context.Context, address string) (StoreLock, error) {
+	db, err := sql.Open("postgres", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Sessions live in different databases or schemas - lock the one the store uses
+	var database, schema string
+	err = conn.QueryRowContext(ctx, "SELECT current_database(), current_schema()").Scan(&database, &schema)
+	if err == nil {
+		hash := fnv.New64a()
+		_, _ = hash.Write([]byte("gows:" + database + "." + schema))
+		lock := &postgresLock{
+			db:   db,
+			conn: conn,
+			key:  int64(hash.Sum64()),
+			lost: make(chan struct{}),
+			done: make(chan struct{}),
+		}
+		var locked bool
+		err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", lock.key).Scan(&locked)
+		if err == nil && locked {
+			go lock.watch()
+			return lock, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("%w: advisory lock on %s.%s is held", ErrStoreLocked, database, schema)
+		}
+	}
+	_ = conn.Close()
+	_ = db.Close()
+	return nil, err
+}
+
+// watch pings the connection holding the lock, the lock is gone together with the connection
+func (l *postgresLock) watch() {
+	ticker := time.NewTicker(lockCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), lockCheckInterval)
+		err := l.conn.PingContext(ctx)
+		cancel()
+		if err != nil {
+			close(l.lost)
+			return
+		}
+	}
+}
+
+func (l *postgresLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *postgresLock) Unlock() error {
+	l.once.Do(func() { close(l.done) })
+	_, err := l.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", l.key)
+	// Closing the connection releases the lock anyway
+	_ = l.conn.Close()
+	_ = l.db.Close()
+	return err
+}
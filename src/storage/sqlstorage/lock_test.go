@@ -0,0 +1,68 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockStoreSqlite(t *testing.T) {
+	ctx := context.Background()
+	address := "file:" + filepath.Join(t.TempDir(), "session.db") + "?_foreign_keys=on"
+
+	lock, err := LockStore(ctx, "sqlite3", address, 0)
+	require.NoError(t, err)
+
+	// Another process (or the same one) can't take it
+	_, err = LockStore(ctx, "sqlite3", address, 0)
+	assert.ErrorIs(t, err, ErrStoreLocked)
+
+	// Takeover - waits until the lock is released
+	first := lock
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = first.Unlock()
+	}()
+	lock, err = LockStore(ctx, "sqlite3", address, 5*time.Second)
+	require.NoError(t, err)
+	assert.Nil(t, lock.Lost())
+	assert.NoError(t, lock.Unlock())
+
+	// In-memory databases are never shared
+	lock, err = LockStore(ctx, "sqlite3", "file::memory:", 0)
+	require.NoError(t, err)
+	assert.NoError(t, lock.Unlock())
+}
+
+func TestPostgresLockLost(t *testing.T) {
+	lockCheckInterval = 10 * time.Millisecond
+	defer func() { lockCheckInterval = 10 * time.Second }()
+
+	// Any connection works for the watcher - it only pings the one holding the lock
+	db, err := sql.Open("sqlite3", "file::memory:")
+	require.NoError(t, err)
+	conn, err := db.Conn(context.Background())
+	require.NoError(t, err)
+	lock := &postgresLock{db: db, conn: conn, lost: make(chan struct{}), done: make(chan struct{})}
+	go lock.watch()
+
+	select {
+	case <-lock.Lost():
+		t.Fatal("lock lost while the connection is alive")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The connection has dropped
+	_ = conn.Close()
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lock loss not detected")
+	}
+	_ = lock.Unlock()
+}
@@ -0,0 +1,23 @@
+package sqlstorage
+
+import (
+	"context"
+	"time"
+
+	"github.com/devlikeapro/gows/metrics"
+	"github.com/devlikeapro/gows/tracing"
+)
+
+// observeQuery starts measuring and tracing the query, call the returned function when it's done:
+//
+//	done := observeQuery(ctx, table, "select")
+//	err = db.SelectContext(ctx, ...)
+//	done(err)
+func observeQuery(ctx context.Context, table string, operation string) func(err error) {
+	start := time.Now()
+	span := tracing.StartQuery(ctx, table, operation)
+	return func(err error) {
+		metrics.StorageQueryDuration.WithLabelValues(table, operation).Observe(time.Since(start).Seconds())
+		tracing.End(span, err)
+	}
+}
@@ -0,0 +1,14 @@
+-- Create the gows_events table - the journal of recent session events
+CREATE TABLE gows_events
+(
+    -- Monotonic per-session sequence number
+    sequence BIGINT NOT NULL,
+    -- When the event has been emitted
+    timestamp TIMESTAMP NOT NULL,
+    -- Event type
+    event VARCHAR(100) NOT NULL,
+    -- Event data (JSON)
+    data TEXT NOT NULL,
+    -- Primary key
+    PRIMARY KEY (sequence)
+);
@@ -0,0 +1,5 @@
+-- gows_events - chat and from_me fields for stream filters on replay
+-- Empty for events not about a chat
+ALTER TABLE gows_events ADD COLUMN jid VARCHAR(100) NOT NULL DEFAULT '';
+-- Set for message events only
+ALTER TABLE gows_events ADD COLUMN from_me BOOLEAN;
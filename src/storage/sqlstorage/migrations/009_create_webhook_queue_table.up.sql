@@ -0,0 +1,25 @@
+-- Create the gows_webhook_queue table - failed webhook deliveries waiting for a retry
+CREATE TABLE gows_webhook_queue
+(
+    -- Delivery ID (uuid)
+    id VARCHAR(36) NOT NULL,
+    -- Webhook URL
+    url TEXT NOT NULL,
+    -- Event type
+    event VARCHAR(100) NOT NULL,
+    -- Request body (JSON)
+    body TEXT NOT NULL,
+    -- Failed attempts so far
+    attempts INTEGER NOT NULL,
+    -- When to retry
+    next_attempt_at TIMESTAMP NOT NULL,
+    -- The error of the last attempt
+    last_error TEXT NOT NULL DEFAULT '',
+    -- When the event has been emitted
+    created_at TIMESTAMP NOT NULL,
+    -- Primary key
+    PRIMARY KEY (id)
+);
+
+-- Index for next_attempt_at (retries due)
+CREATE INDEX gows_webhook_queue_next_attempt_at_idx ON gows_webhook_queue (next_attempt_at);
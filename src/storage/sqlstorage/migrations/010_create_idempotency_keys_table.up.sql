@@ -0,0 +1,19 @@
+-- Create the gows_idempotency_keys table - responses of send requests, so retries don't send again
+CREATE TABLE gows_idempotency_keys
+(
+    -- Idempotency key given by the client
+    id VARCHAR(255) NOT NULL,
+    -- RPC the key has been used for
+    method VARCHAR(255) NOT NULL,
+    -- Hash of the request, the key can't be reused for another request
+    request_hash VARCHAR(64) NOT NULL,
+    -- The response (JSON)
+    response TEXT NOT NULL,
+    -- When the request has been completed
+    created_at TIMESTAMP NOT NULL,
+    -- Primary key
+    PRIMARY KEY (id)
+);
+
+-- Index for created_at (expired keys)
+CREATE INDEX gows_idempotency_keys_created_at_idx ON gows_idempotency_keys (created_at);
@@ -0,0 +1,23 @@
+-- Create the gows_outbox table - messages queued to be sent later
+CREATE TABLE gows_outbox
+(
+    -- Queued message ID (uuid)
+    id VARCHAR(36) NOT NULL,
+    -- Chat JID
+    jid VARCHAR(100) NOT NULL,
+    -- Send request (JSON)
+    request TEXT NOT NULL,
+    -- When to send (or retry)
+    send_at TIMESTAMP NOT NULL,
+    -- Failed attempts so far
+    attempts INTEGER NOT NULL,
+    -- The error of the last attempt
+    last_error TEXT NOT NULL DEFAULT '',
+    -- When the message has been queued
+    created_at TIMESTAMP NOT NULL,
+    -- Primary key
+    PRIMARY KEY (id)
+);
+
+-- Index for send_at (messages due)
+CREATE INDEX gows_outbox_send_at_idx ON gows_outbox (send_at);
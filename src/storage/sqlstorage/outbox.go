@@ -0,0 +1,128 @@
+package sqlstorage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/devlikeapro/gows/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+var _ storage.Outbox = (*SqlOutbox)(nil)
+
+func (gc *GContainer) NewOutbox() *SqlOutbox {
+	return &SqlOutbox{
+		db: gc.db,
+	}
+}
+
+type SqlOutbox struct {
+	db *sqlx.DB
+}
+
+func (o *SqlOutbox) Enqueue(msg *storage.QueuedMessage) error {
+	query, args, err := sq.Insert(OutboxTable.Name).
+		Columns(OutboxTable.Columns...).
+		Values(
+			msg.ID,
+			msg.Jid,
+			msg.Request,
+			msg.SendAt.UTC(),
+			msg.Attempts,
+			msg.LastError,
+			msg.CreatedAt.UTC(),
+		).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = o.db.Exec(query, args...)
+	return err
+}
+
+func (o *SqlOutbox) Due(now time.Time, limit uint64) ([]*storage.QueuedMessage, error) {
+	return o.list(sq.LtOrEq{"send_at": now.UTC()}, storage.Pagination{Limit: limit})
+}
+
+func (o *SqlOutbox) List(pagination storage.Pagination) ([]*storage.QueuedMessage, error) {
+	return o.list(nil, pagination)
+}
+
+func (o *SqlOutbox) list(condition sq.Sqlizer, pagination storage.Pagination) ([]*storage.QueuedMessage, error) {
+	sql := sq.Select(OutboxTable.Columns...).
+		From(OutboxTable.Name).
+		OrderBy("send_at ASC", "created_at ASC")
+	if condition != nil {
+		sql = sql.Where(condition)
+	}
+	if pagination.Limit > 0 {
+		sql = sql.Limit(pagination.Limit)
+	}
+	if pagination.Offset > 0 {
+		sql = sql.Offset(pagination.Offset)
+	}
+	query, args, err := sql.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var result []*storage.QueuedMessage
+	err = o.db.Select(&result, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (o *SqlOutbox) Get(id string) (*storage.QueuedMessage, error) {
+	query, args, err := sq.Select(OutboxTable.Columns...).
+		From(OutboxTable.Name).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var msg storage.QueuedMessage
+	err = o.db.Get(&msg, query, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (o *SqlOutbox) Reschedule(id string, attempts int, next time.Time, lastError string) error {
+	query, args, err := sq.Update(OutboxTable.Name).
+		Set("attempts", attempts).
+		Set("send_at", next.UTC()).
+		Set("last_error", lastError).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = o.db.Exec(query, args...)
+	return err
+}
+
+func (o *SqlOutbox) Delete(id string) error {
+	query, args, err := sq.Delete(OutboxTable.Name).Where(sq.Eq{"id": id}).ToSql()
+	if err != nil {
+		return err
+	}
+	result, err := o.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
@@ -91,3 +91,53 @@ var LabelAssociationsTable = Table{
 		"data",
 	},
 }
+
+var EventsTable = Table{
+	Name: "gows_events",
+	Columns: []string{
+		"sequence",
+		"timestamp",
+		"event",
+		"jid",
+		"from_me",
+		"data",
+	},
+}
+
+var WebhookQueueTable = Table{
+	Name: "gows_webhook_queue",
+	Columns: []string{
+		"id",
+		"url",
+		"event",
+		"body",
+		"attempts",
+		"next_attempt_at",
+		"last_error",
+		"created_at",
+	},
+}
+
+var IdempotencyKeysTable = Table{
+	Name: "gows_idempotency_keys",
+	Columns: []string{
+		"id",
+		"method",
+		"request_hash",
+		"response",
+		"created_at",
+	},
+}
+
+var OutboxTable = Table{
+	Name: "gows_outbox",
+	Columns: []string{
+		"id",
+		"jid",
+		"request",
+		"send_at",
+		"attempts",
+		"last_error",
+		"created_at",
+	},
+}
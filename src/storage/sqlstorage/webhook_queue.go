@@ -0,0 +1,85 @@
+package sqlstorage
+
+import (
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/devlikeapro/gows/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+var _ storage.WebhookQueue = (*SqlWebhookQueue)(nil)
+
+func (gc *GContainer) NewWebhookQueue() *SqlWebhookQueue {
+	return &SqlWebhookQueue{
+		db: gc.db,
+	}
+}
+
+type SqlWebhookQueue struct {
+	db *sqlx.DB
+}
+
+func (q *SqlWebhookQueue) Enqueue(delivery *storage.WebhookDelivery) error {
+	query, args, err := sq.Insert(WebhookQueueTable.Name).
+		Columns(WebhookQueueTable.Columns...).
+		Values(
+			delivery.ID,
+			delivery.Url,
+			delivery.Event,
+			delivery.Body,
+			delivery.Attempts,
+			delivery.NextAttemptAt.UTC(),
+			delivery.LastError,
+			delivery.CreatedAt.UTC(),
+		).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = q.db.Exec(query, args...)
+	return err
+}
+
+func (q *SqlWebhookQueue) Due(now time.Time, limit uint64) ([]*storage.WebhookDelivery, error) {
+	sql := sq.Select(WebhookQueueTable.Columns...).
+		From(WebhookQueueTable.Name).
+		Where(sq.LtOrEq{"next_attempt_at": now.UTC()}).
+		OrderBy("created_at ASC")
+	if limit > 0 {
+		sql = sql.Limit(limit)
+	}
+	query, args, err := sql.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var result []*storage.WebhookDelivery
+	err = q.db.Select(&result, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (q *SqlWebhookQueue) Reschedule(id string, attempts int, next time.Time, lastError string) error {
+	query, args, err := sq.Update(WebhookQueueTable.Name).
+		Set("attempts", attempts).
+		Set("next_attempt_at", next.UTC()).
+		Set("last_error", lastError).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = q.db.Exec(query, args...)
+	return err
+}
+
+func (q *SqlWebhookQueue) Delete(id string) error {
+	query, args, err := sq.Delete(WebhookQueueTable.Name).Where(sq.Eq{"id": id}).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = q.db.Exec(query, args...)
+	return err
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"time"
 
 	"go.mau.fi/whatsmeow/types"
@@ -16,6 +17,10 @@ type Storage struct {
 	Labels               LabelStorage
 	LabelAssociations    LabelAssociationStorage
 	Lidmap               LidmapStorage
+	Events               EventJournal
+	Webhooks             WebhookQueue
+	IdempotencyKeys      IdempotencyKeyStorage
+	Outbox               Outbox
 }
 
 type MessageStorage interface {
@@ -29,11 +34,12 @@ type MessageStorage interface {
 }
 
 type GroupStorage interface {
-	FetchGroups(force bool) error
+	// FetchGroups refreshes groups from WhatsApp, ctx carries the trace
+	FetchGroups(ctx context.Context, force bool) error
 	UpdateGroup(update *events.GroupInfo) error
 	UpsertOneGroup(group *types.GroupInfo) error
 	GetAllGroups(sort Sort, pagination Pagination) ([]*types.GroupInfo, error)
-	GetGroup(jid types.JID) (*types.GroupInfo, error)
+	GetGroup(ctx context.Context, jid types.JID) (*types.GroupInfo, error)
 	DeleteGroup(jid types.JID) error
 	DeleteGroups() error
 }
@@ -48,7 +54,7 @@ type ChatStorage interface {
 }
 
 type ChatEphemeralSettingStorage interface {
-	GetChatEphemeralSetting(id types.JID) (*StoredChatEphemeralSetting, error)
+	GetChatEphemeralSetting(ctx context.Context, id types.JID) (*StoredChatEphemeralSetting, error)
 	UpdateChatEphemeralSetting(setting *StoredChatEphemeralSetting) error
 	DeleteChatEphemeralSetting(id types.JID, deleteBefore time.Time) error
 }
@@ -73,3 +79,51 @@ type LidmapStorage interface {
 	// GetLidCount returns the count of lids in the database
 	GetLidCount() (int, error)
 }
+
+// EventJournal keeps recent session events, so event streams can be resumed
+type EventJournal interface {
+	// Append records the event with the next sequence number (Sequence and Timestamp are set by the journal).
+	// The event may be written later, reads see it right away.
+	// The sequence is 0 if recording fails - the event has no sequence then and is not replayable.
+	Append(event *JournalEvent) (uint64, error)
+	// Flush writes the appended events still waiting to be written
+	Flush() error
+	// Since returns events after the sequence in order, up to limit
+	Since(sequence uint64, limit uint64) ([]*JournalEvent, error)
+	// Bounds returns the oldest and the last event sequence in the journal
+	Bounds() (oldest uint64, last uint64, err error)
+}
+
+// WebhookQueue keeps failed webhook deliveries until they're retried
+type WebhookQueue interface {
+	// Enqueue records the delivery to be retried at NextAttemptAt
+	Enqueue(delivery *WebhookDelivery) error
+	// Due returns deliveries to retry at the time, the oldest first, up to limit
+	Due(now time.Time, limit uint64) ([]*WebhookDelivery, error)
+	// Reschedule records the failed attempt and when to retry next time
+	Reschedule(id string, attempts int, next time.Time, lastError string) error
+	Delete(id string) error
+}
+
+// IdempotencyKeyStorage remembers responses of send requests by client keys,
+// so a retried request returns the same response instead of sending again
+type IdempotencyKeyStorage interface {
+	// GetIdempotencyKey returns the recorded key, ErrNotFound if it's unknown or expired
+	GetIdempotencyKey(id string) (*IdempotencyKey, error)
+	SaveIdempotencyKey(key *IdempotencyKey) error
+}
+
+// Outbox keeps messages queued to be sent later, until they're sent
+type Outbox interface {
+	Enqueue(msg *QueuedMessage) error
+	// Due returns messages to send at the time, the earliest first, up to limit
+	Due(now time.Time, limit uint64) ([]*QueuedMessage, error)
+	// List returns all queued messages, the earliest first
+	List(pagination Pagination) ([]*QueuedMessage, error)
+	// Get returns the message, ErrNotFound if it's not queued
+	Get(id string) (*QueuedMessage, error)
+	// Reschedule records the failed attempt and when to retry next time
+	Reschedule(id string, attempts int, next time.Time, lastError string) error
+	// Delete removes the message, ErrNotFound if it's not queued
+	Delete(id string) error
+}
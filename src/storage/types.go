@@ -106,3 +106,53 @@ type LidmapEntry struct {
 	Lid types.JID `json:"lid"`
 	Pn  types.JID `json:"pn"`
 }
+
+// JournalEvent is an event recorded in the session events journal
+type JournalEvent struct {
+	Sequence  uint64    `db:"sequence"`
+	Timestamp time.Time `db:"timestamp"`
+	Event     string    `db:"event"`
+	// Jid - the chat the event belongs to, empty if the event is not about a chat
+	Jid string `db:"jid"`
+	// FromMe - set for events about messages
+	FromMe *bool  `db:"from_me"`
+	Data   string `db:"data"`
+}
+
+// WebhookDelivery is an event delivery to a webhook waiting for a retry
+type WebhookDelivery struct {
+	ID  string `db:"id"`
+	Url string `db:"url"`
+	// Event - event type
+	Event string `db:"event"`
+	// Body - the request body, the signature is calculated when sending
+	Body          string    `db:"body"`
+	Attempts      int       `db:"attempts"`
+	NextAttemptAt time.Time `db:"next_attempt_at"`
+	LastError     string    `db:"last_error"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+// IdempotencyKey is the response of a completed send request with the key
+type IdempotencyKey struct {
+	ID string `db:"id"`
+	// Method - the RPC, the key can't be reused for another one
+	Method string `db:"method"`
+	// RequestHash - the key can't be reused for another request
+	RequestHash string `db:"request_hash"`
+	// Response - the response (JSON)
+	Response  string    `db:"response"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// QueuedMessage is a message in the outbox, waiting for SendAt and the session to be connected
+type QueuedMessage struct {
+	ID  string `db:"id"`
+	Jid string `db:"jid"`
+	// Request - the send request (JSON), the storage doesn't look into it
+	Request   string    `db:"request"`
+	SendAt    time.Time `db:"send_at"`
+	Attempts  int       `db:"attempts"`
+	LastError string    `db:"last_error"`
+	CreatedAt time.Time `db:"created_at"`
+}
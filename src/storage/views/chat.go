@@ -1,6 +1,8 @@
 package views
 
 import (
+	"context"
+
 	"github.com/devlikeapro/gows/storage"
 	"go.mau.fi/whatsmeow/types"
 )
@@ -35,7 +37,7 @@ func (s ChatView) GetChats(filter storage.ChatFilter, sortBy storage.Sort, pagin
 	for i, msg := range messages {
 		var name string
 		if msg.Info.Chat.Server == types.GroupServer {
-			group, _ := s.Groups.GetGroup(msg.Info.Chat)
+			group, _ := s.Groups.GetGroup(context.Background(), msg.Info.Chat)
 			if group != nil {
 				name = group.Name
 			}
@@ -0,0 +1,118 @@
+// Package tracing - OpenTelemetry tracing exported over OTLP (gRPC)
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/devlikeapro/gows"
+
+// Config configures the OTLP exporter.
+// OTEL_EXPORTER_OTLP_* environment variables apply too (e.g. headers, certificates).
+type Config struct {
+	// Endpoint - the collector address (host:port), e.g. localhost:4317
+	Endpoint string
+	// Insecure - send spans without TLS, e.g. to a local collector
+	Insecure bool
+	// SampleRatio - share of new traces to record (0-1), traces started by the caller follow its decision
+	SampleRatio float64
+	// SQL - record spans for storage queries.
+	// Queries are traced in the RPC trace that made them, queries outside any trace are not recorded.
+	SQL bool
+
+	ServiceName    string
+	ServiceVersion string
+}
+
+var sqlEnabled atomic.Bool
+
+// Setup installs the global tracer provider and the W3C trace context propagator.
+// Call the returned function on shutdown to flush spans.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	if cfg.Endpoint == "" {
+		return nil, errors.New("OTLP endpoint is required")
+	}
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, fmt.Errorf("sample ratio must be between 0 and 1, got %v", cfg.SampleRatio)
+	}
+	options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithAttributes(
+			attribute.String("service.name", cfg.ServiceName),
+			attribute.String("service.version", cfg.ServiceVersion),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build tracing resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	sqlEnabled.Store(cfg.SQL)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span, it's a no-op until Setup is called
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records the error, if any, and ends the span
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// StartQuery starts a span for the storage query in the trace of ctx.
+// A no-op span if SQL tracing is disabled or ctx has no span - background writes (e.g. history sync) are not traced.
+func StartQuery(ctx context.Context, table string, operation string) trace.Span {
+	if !sqlEnabled.Load() || !trace.SpanContextFromContext(ctx).IsValid() {
+		return noop.Span{}
+	}
+	_, span := otel.Tracer(tracerName).Start(
+		ctx,
+		"sql "+operation+" "+table,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.operation.name", operation),
+			attribute.String("db.collection.name", table),
+		),
+	)
+	return span
+}
+
+// WithSpanOf returns ctx with the current span of from,
+// so spans of work bound to another context (e.g. the session one) stay in the caller's trace
+func WithSpanOf(ctx context.Context, from context.Context) context.Context {
+	return trace.ContextWithSpan(ctx, trace.SpanFromContext(from))
+}
@@ -0,0 +1,34 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStartQuery(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	tracer := provider.Tracer("test")
+	sqlEnabled.Store(true)
+	defer sqlEnabled.Store(false)
+
+	// Background queries don't start traces
+	StartQuery(context.Background(), "gows_groups", "select").End()
+	assert.Empty(t, recorder.Ended())
+
+	// Queries made in a trace are its children
+	ctx, parent := tracer.Start(context.Background(), "gows.SendMessage")
+	StartQuery(ctx, "gows_groups", "select").End()
+	parent.End()
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "sql select gows_groups", spans[0].Name())
+		assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	}
+}
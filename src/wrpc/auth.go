@@ -0,0 +1,297 @@
+package wrpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Group is a set of RPCs a token can be allowed to call
+type Group string
+
+const (
+	// GroupRead - RPCs reading the session data
+	GroupRead Group = "read"
+	// GroupSend - RPCs sending messages and changing the account data on WhatsApp
+	GroupSend Group = "send"
+	// GroupAdmin - session management (start, stop, logout, export, etc). Admin tokens can call any RPC.
+	GroupAdmin Group = "admin"
+	// GroupPublic - RPCs available without a token (e.g. health checks).
+	// Public RPCs about a session (e.g. the session health) require GroupRead - session names are not public.
+	GroupPublic Group = "public"
+)
+
+// AuthToken is a token entry in the auth config file
+type AuthToken struct {
+	// Name - shown in logs instead of the token
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	// Sessions - session names the token can access, "prefix*" matches by prefix, "*" - all sessions
+	Sessions []string `json:"sessions"`
+	Groups   []Group  `json:"groups"`
+}
+
+// AuthFile is the auth config file, JSON
+type AuthFile struct {
+	Tokens []AuthToken `json:"tokens"`
+}
+
+type authToken struct {
+	name     string
+	sessions []string
+	groups   map[Group]bool
+}
+
+func (t *authToken) allowsGroup(group Group) bool {
+	return t.groups[GroupAdmin] || t.groups[group]
+}
+
+// allowsSession tells if the token can access the session, empty session - all sessions
+func (t *authToken) allowsSession(session string) bool {
+	for _, pattern := range t.sessions {
+		if pattern == "*" {
+			return true
+		}
+		if session == "" {
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(session, prefix) {
+				return true
+			}
+		} else if pattern == session {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorizer checks bearer tokens from the "authorization" metadata.
+// A token is allowed to call RPCs of its groups for its sessions,
+// RPCs not about a session (e.g. ListSessions) require a token for all sessions ("*").
+type Authorizer struct {
+	path string
+	log  waLog.Logger
+	// methods - full method name -> group, methods not listed require GroupAdmin
+	methods map[string]Group
+	// sessionOf returns the session the request is about, empty if none
+	sessionOf func(req interface{}) string
+
+	// tokens - sha256 of the token -> token
+	tokens   atomic.Pointer[map[[sha256.Size]byte]*authToken]
+	lock     sync.Mutex
+	modified time.Time
+}
+
+// NewAuthorizer loads tokens from the file, see AuthFile
+func NewAuthorizer(log waLog.Logger, path string, methods map[string]Group, sessionOf func(req interface{}) string) (*Authorizer, error) {
+	a := &Authorizer{
+		path:      path,
+		log:       log,
+		methods:   methods,
+		sessionOf: sessionOf,
+	}
+	err := a.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reload reads the tokens from the file again, the current tokens are kept if the file is invalid
+func (a *Authorizer) Reload() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return fmt.Errorf("failed to read auth config: %w", err)
+	}
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return fmt.Errorf("failed to read auth config: %w", err)
+	}
+	tokens, err := parseAuthFile(data)
+	if err != nil {
+		return fmt.Errorf("invalid auth config %s: %w", a.path, err)
+	}
+	a.tokens.Store(&tokens)
+	a.modified = info.ModTime()
+	a.log.Infof("Loaded %d token(s) from %s", len(tokens), a.path)
+	return nil
+}
+
+func parseAuthFile(data []byte) (map[[sha256.Size]byte]*authToken, error) {
+	var file AuthFile
+	err := json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make(map[[sha256.Size]byte]*authToken, len(file.Tokens))
+	for i, entry := range file.Tokens {
+		name := entry.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if entry.Token == "" {
+			return nil, fmt.Errorf("token %s is empty", name)
+		}
+		if len(entry.Sessions) == 0 {
+			return nil, fmt.Errorf("token %s has no sessions", name)
+		}
+		token := &authToken{name: name, sessions: entry.Sessions, groups: map[Group]bool{}}
+		for _, group := range entry.Groups {
+			switch group {
+			case GroupRead, GroupSend, GroupAdmin:
+				token.groups[group] = true
+			default:
+				return nil, fmt.Errorf("token %s has unknown group '%s'", name, group)
+			}
+		}
+		key := sha256.Sum256([]byte(entry.Token))
+		if _, ok := tokens[key]; ok {
+			return nil, fmt.Errorf("token %s is a duplicate", name)
+		}
+		tokens[key] = token
+	}
+	return tokens, nil
+}
+
+// Watch reloads the tokens when the file is modified, until ctx is done
+func (a *Authorizer) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(a.path)
+		if err != nil {
+			a.log.Warnf("Failed to check auth config: %v", err)
+			continue
+		}
+		a.lock.Lock()
+		changed := !info.ModTime().Equal(a.modified)
+		a.lock.Unlock()
+		if !changed {
+			continue
+		}
+		err = a.Reload()
+		if err != nil {
+			a.log.Errorf("Failed to reload auth config, keeping the previous tokens: %v", err)
+		}
+	}
+}
+
+// groupOf returns the group required to call the method with the request, nil request - any request
+func (a *Authorizer) groupOf(method string, req interface{}) Group {
+	group, ok := a.methods[method]
+	if !ok {
+		return GroupAdmin
+	}
+	if group == GroupPublic && req != nil && a.sessionOf(req) != "" {
+		return GroupRead
+	}
+	return group
+}
+
+// authenticate finds the token of the call and checks it's allowed to call the method
+func (a *Authorizer) authenticate(ctx context.Context, method string, group Group) (*authToken, error) {
+	if group == GroupPublic {
+		return nil, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "authorization token is required")
+	}
+	value, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authorization must be a bearer token")
+	}
+	token := (*a.tokens.Load())[sha256.Sum256([]byte(strings.TrimSpace(value)))]
+	if token == nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	if !token.allowsGroup(group) {
+		return nil, status.Errorf(codes.PermissionDenied, "token %s is not allowed to call %s (%s)", token.name, method, group)
+	}
+	return token, nil
+}
+
+// authorize checks the token can access the session of the request
+func (a *Authorizer) authorize(token *authToken, method string, req interface{}) error {
+	if token == nil {
+		return nil
+	}
+	session := a.sessionOf(req)
+	if token.allowsSession(session) {
+		return nil
+	}
+	if session == "" {
+		return status.Errorf(codes.PermissionDenied, "token %s is not allowed to call %s - it requires access to all sessions", token.name, method)
+	}
+	return status.Errorf(codes.PermissionDenied, "token %s is not allowed to access session '%s'", token.name, session)
+}
+
+func (a *Authorizer) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		token, err := a.authenticate(ctx, info.FullMethod, a.groupOf(info.FullMethod, req))
+		if err != nil {
+			return nil, err
+		}
+		err = a.authorize(token, info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor checks the token on the stream start and the session of received messages.
+// Messages after the first one may omit the session (e.g. chunks of an upload).
+func (a *Authorizer) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		token, err := a.authenticate(stream.Context(), info.FullMethod, a.groupOf(info.FullMethod, nil))
+		if err != nil {
+			return err
+		}
+		if token == nil {
+			return handler(srv, stream)
+		}
+		return handler(srv, &authorizedStream{ServerStream: stream, authorizer: a, token: token, method: info.FullMethod})
+	}
+}
+
+type authorizedStream struct {
+	grpc.ServerStream
+	authorizer *Authorizer
+	token      *authToken
+	method     string
+	received   bool
+}
+
+func (s *authorizedStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err != nil {
+		return err
+	}
+	if s.received && s.authorizer.sessionOf(m) == "" {
+		return nil
+	}
+	s.received = true
+	return s.authorizer.authorize(s.token, s.method, m)
+}
@@ -0,0 +1,68 @@
+package wrpc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthorizer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"tokens": [
+		{"name": "admin", "token": "admin-token", "sessions": ["*"], "groups": ["admin"]},
+		{"name": "tenant", "token": "tenant-token", "sessions": ["tenant-*"], "groups": ["read"]}
+	]}`), 0600))
+	methods := map[string]Group{"/read": GroupRead, "/send": GroupSend, "/health": GroupPublic}
+	sessionOf := func(req interface{}) string { return req.(string) }
+	authorizer, err := NewAuthorizer(waLog.Noop, path, methods, sessionOf)
+	require.NoError(t, err)
+
+	interceptor := authorizer.UnaryInterceptor()
+	call := func(token string, method string, session string) codes.Code {
+		ctx := context.Background()
+		if token != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+		}
+		info := &grpc.UnaryServerInfo{FullMethod: method}
+		_, err := interceptor(ctx, session, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		return status.Code(err)
+	}
+
+	assert.Equal(t, codes.OK, call("", "/health", ""))
+	// Public methods about a session require a read token for it
+	assert.Equal(t, codes.Unauthenticated, call("", "/health", "tenant-1"))
+	assert.Equal(t, codes.OK, call("tenant-token", "/health", "tenant-1"))
+	assert.Equal(t, codes.PermissionDenied, call("tenant-token", "/health", "other"))
+	assert.Equal(t, codes.Unauthenticated, call("", "/read", "tenant-1"))
+	assert.Equal(t, codes.Unauthenticated, call("wrong", "/read", "tenant-1"))
+	assert.Equal(t, codes.OK, call("tenant-token", "/read", "tenant-1"))
+	assert.Equal(t, codes.PermissionDenied, call("tenant-token", "/read", "other"))
+	assert.Equal(t, codes.PermissionDenied, call("tenant-token", "/read", ""))
+	assert.Equal(t, codes.PermissionDenied, call("tenant-token", "/send", "tenant-1"))
+	// Not listed methods require admin
+	assert.Equal(t, codes.PermissionDenied, call("tenant-token", "/logout", "tenant-1"))
+	assert.Equal(t, codes.OK, call("admin-token", "/logout", "any"))
+
+	// Reload replaces tokens, invalid files keep the previous ones
+	require.NoError(t, os.WriteFile(path, []byte(`{"tokens": [
+		{"name": "tenant", "token": "tenant-token", "sessions": ["tenant-*"], "groups": ["read", "send"]}
+	]}`), 0600))
+	require.NoError(t, authorizer.Reload())
+	assert.Equal(t, codes.OK, call("tenant-token", "/send", "tenant-1"))
+	assert.Equal(t, codes.Unauthenticated, call("admin-token", "/logout", "any"))
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"tokens": [{"token": "x", "sessions": ["*"], "groups": ["root"]}]}`), 0600))
+	require.Error(t, authorizer.Reload())
+	assert.Equal(t, codes.OK, call("tenant-token", "/send", "tenant-1"))
+}
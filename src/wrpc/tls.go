@@ -0,0 +1,163 @@
+package wrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// TLSConfig configures TLS for TCP listeners.
+// ClientCAFile enables mutual TLS - clients must present a certificate signed by one of the CAs.
+type TLSConfig struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// Build loads the certificate and the client CA bundle.
+// The certificate is reloaded when the files change, so rotated certificates are picked up without a restart.
+func (c TLSConfig) Build() (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("both TLS certificate and key are required")
+	}
+	cert := &reloadingCertificate{certFile: c.CertFile, keyFile: c.KeyFile}
+	_, err := cert.get()
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return cert.get()
+		},
+		// gRPC requires HTTP/2 negotiated over ALPN
+		NextProtos: []string{"h2"},
+	}
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA bundle %s", c.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// reloadingCertificate keeps the key pair loaded, reloads it when the files are modified
+type reloadingCertificate struct {
+	certFile string
+	keyFile  string
+
+	lock     sync.Mutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+func (r *reloadingCertificate) get() (*tls.Certificate, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	modified, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			// Keep serving the last good certificate while files are being replaced
+			return r.cert, nil
+		}
+		return nil, err
+	}
+	if r.cert != nil && !modified.After(r.modified) {
+		return r.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	r.cert = &cert
+	r.modified = modified
+	return r.cert, nil
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// NewListenerCredentials returns transport credentials doing TLS for TCP connections,
+// connections on the unix socket are local and stay plaintext.
+// If tlsConfig is nil, all connections are plaintext.
+func NewListenerCredentials(tlsConfig *tls.Config) credentials.TransportCredentials {
+	creds := &listenerCredentials{plain: insecure.NewCredentials()}
+	if tlsConfig != nil {
+		creds.tls = credentials.NewTLS(tlsConfig)
+	}
+	return creds
+}
+
+type listenerCredentials struct {
+	plain credentials.TransportCredentials
+	// tls - nil if TLS is disabled
+	tls credentials.TransportCredentials
+}
+
+func (c *listenerCredentials) forConn(conn net.Conn) credentials.TransportCredentials {
+	if c.tls == nil || conn.LocalAddr().Network() == "unix" {
+		return c.plain
+	}
+	return c.tls
+}
+
+func (c *listenerCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return c.forConn(conn).ServerHandshake(conn)
+}
+
+func (c *listenerCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return c.forConn(conn).ClientHandshake(ctx, authority, conn)
+}
+
+func (c *listenerCredentials) Info() credentials.ProtocolInfo {
+	if c.tls != nil {
+		return c.tls.Info()
+	}
+	return c.plain.Info()
+}
+
+func (c *listenerCredentials) Clone() credentials.TransportCredentials {
+	clone := &listenerCredentials{plain: c.plain.Clone()}
+	if c.tls != nil {
+		clone.tls = c.tls.Clone()
+	}
+	return clone
+}
+
+func (c *listenerCredentials) OverrideServerName(name string) error {
+	return nil
+}
@@ -0,0 +1,235 @@
+package wrpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// testCert is a key pair signed by the parent, self-signed if there's no parent
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+	// keyPem - PKCS8 private key
+	keyPem []byte
+}
+
+func newTestCert(t *testing.T, serial int64, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "gows-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return &testCert{
+		cert:   cert,
+		key:    key,
+		pem:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPem: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}),
+	}
+}
+
+// write saves the key pair, the files are modified at the time
+func (c *testCert) write(t *testing.T, certFile string, keyFile string, modified time.Time) {
+	require.NoError(t, os.WriteFile(certFile, c.pem, 0600))
+	require.NoError(t, os.WriteFile(keyFile, c.keyPem, 0600))
+	require.NoError(t, os.Chtimes(certFile, modified, modified))
+	require.NoError(t, os.Chtimes(keyFile, modified, modified))
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(c.pem, c.keyPem)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestTLSConfigBuild(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, 1, nil, true)
+	server := newTestCert(t, 2, ca, false)
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	server.write(t, certFile, keyFile, time.Now())
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, ca.pem, 0600))
+	emptyFile := filepath.Join(dir, "empty.crt")
+	require.NoError(t, os.WriteFile(emptyFile, []byte("not a certificate"), 0600))
+
+	assert.False(t, TLSConfig{}.Enabled())
+	assert.True(t, TLSConfig{CertFile: certFile}.Enabled())
+
+	_, err := TLSConfig{CertFile: certFile}.Build()
+	assert.Error(t, err)
+	_, err = TLSConfig{CertFile: certFile, KeyFile: filepath.Join(dir, "missing.key")}.Build()
+	assert.Error(t, err)
+	_, err = TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: filepath.Join(dir, "missing.crt")}.Build()
+	assert.Error(t, err)
+	_, err = TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: emptyFile}.Build()
+	assert.Error(t, err)
+
+	config, err := TLSConfig{CertFile: certFile, KeyFile: keyFile}.Build()
+	require.NoError(t, err)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+	assert.Equal(t, []string{"h2"}, config.NextProtos)
+
+	config, err = TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}.Build()
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+	assert.NotNil(t, config.ClientCAs)
+}
+
+func TestTLSConfigReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	modified := time.Now().Add(-time.Minute)
+	newTestCert(t, 1, nil, false).write(t, certFile, keyFile, modified)
+	config, err := TLSConfig{CertFile: certFile, KeyFile: keyFile}.Build()
+	require.NoError(t, err)
+	serial := func() int64 {
+		cert, err := config.GetCertificate(nil)
+		require.NoError(t, err)
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return parsed.SerialNumber.Int64()
+	}
+	assert.Equal(t, int64(1), serial())
+
+	// Rotated certificate is picked up
+	newTestCert(t, 2, nil, false).write(t, certFile, keyFile, modified.Add(time.Second))
+	assert.Equal(t, int64(2), serial())
+
+	// Broken or missing files - the last good certificate is served
+	require.NoError(t, os.WriteFile(certFile, []byte("broken"), 0600))
+	require.NoError(t, os.Chtimes(certFile, modified.Add(2*time.Second), modified.Add(2*time.Second)))
+	assert.Equal(t, int64(2), serial())
+	require.NoError(t, os.Remove(certFile))
+	assert.Equal(t, int64(2), serial())
+}
+
+// acceptedConn returns the server side of a connection to the listener
+func acceptedConn(t *testing.T, listener net.Listener) net.Conn {
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		assert.NoError(t, err)
+		accepted <- conn
+	}()
+	client, err := net.Dial(listener.Addr().Network(), listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	conn := <-accepted
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestListenerCredentialsForConn(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = tcp.Close() }()
+	unix, err := net.Listen("unix", filepath.Join(t.TempDir(), "gows.sock"))
+	require.NoError(t, err)
+	defer func() { _ = unix.Close() }()
+	tcpConn, unixConn := acceptedConn(t, tcp), acceptedConn(t, unix)
+
+	creds := NewListenerCredentials(&tls.Config{}).(*listenerCredentials)
+	assert.Equal(t, "tls", creds.forConn(tcpConn).Info().SecurityProtocol)
+	assert.Equal(t, "insecure", creds.forConn(unixConn).Info().SecurityProtocol)
+	assert.Equal(t, "tls", creds.Info().SecurityProtocol)
+
+	// TLS disabled - everything is plaintext
+	creds = NewListenerCredentials(nil).(*listenerCredentials)
+	assert.Equal(t, "insecure", creds.forConn(tcpConn).Info().SecurityProtocol)
+	assert.Equal(t, "insecure", creds.forConn(unixConn).Info().SecurityProtocol)
+}
+
+func TestListenerCredentialsMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, 1, nil, true)
+	server := newTestCert(t, 2, ca, false)
+	client := newTestCert(t, 3, ca, false)
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	server.write(t, certFile, keyFile, time.Now())
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, ca.pem, 0600))
+	config, err := TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}.Build()
+	require.NoError(t, err)
+
+	grpcServer := grpc.NewServer(grpc.Creds(NewListenerCredentials(config)))
+	healthpb.RegisterHealthServer(grpcServer, health.NewServer())
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	socket := filepath.Join(dir, "gows.sock")
+	unix, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	go func() { _ = grpcServer.Serve(tcp) }()
+	go func() { _ = grpcServer.Serve(unix) }()
+	defer grpcServer.Stop()
+
+	check := func(target string, creds credentials.TransportCredentials) error {
+		conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		return err
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	// A client with the certificate signed by the CA
+	err = check(tcp.Addr().String(), credentials.NewTLS(&tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{client.tlsCertificate(t)},
+	}))
+	assert.NoError(t, err)
+
+	// A client without a certificate is rejected
+	err = check(tcp.Addr().String(), credentials.NewTLS(&tls.Config{RootCAs: roots}))
+	assert.Error(t, err)
+
+	// A plaintext client is rejected on TCP
+	err = check(tcp.Addr().String(), insecure.NewCredentials())
+	assert.Error(t, err)
+
+	// The unix socket is local - plaintext
+	err = check("unix://"+socket, insecure.NewCredentials())
+	assert.NoError(t, err)
+}